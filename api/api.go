@@ -1,7 +1,9 @@
 package api
 
 import (
+	"net"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/jose-lico/go-plate/config"
 	"github.com/jose-lico/go-plate/middleware"
@@ -16,6 +18,22 @@ type APIServer struct {
 	Server *http.Server
 	Router *chi.Mux
 	cfg    *config.APIConfig
+
+	// Replaces listening on Server.Addr, used by tests
+	listener net.Listener
+
+	onStart    []hook
+	onShutdown []hook
+
+	healthChecks []healthCheck
+	shuttingDown atomic.Bool
+
+	jwks JWKSProvider
+
+	configReport      func() *config.Report
+	configMiddlewares []func(http.Handler) http.Handler
+
+	cors atomic.Pointer[cors.Cors]
 }
 
 func NewAPIServer(cfg *config.APIConfig) *APIServer {
@@ -25,30 +43,31 @@ func NewAPIServer(cfg *config.APIConfig) *APIServer {
 	return server
 }
 
+// CORS options come from the server config, see UpdateCORS to change them while running
 func (s *APIServer) UseCORS() {
-	cors := cors.New(cors.Options{
-		AllowedOrigins:   s.cfg.AllowedOrigins,
-		AllowedMethods:   s.cfg.AllowedMethods,
-		AllowedHeaders:   s.cfg.AllowedHeaders,
-		ExposedHeaders:   s.cfg.AllowedHeaders,
-		AllowCredentials: s.cfg.AllowCredentials,
-		MaxAge:           s.cfg.MaxAge,
+	s.UpdateCORS(s.cfg)
+
+	s.Router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.cors.Load().Handler(next).ServeHTTP(w, r)
+		})
 	})
+}
 
-	s.Router.Use(cors.Handler)
+// Replaces the CORS options of UseCORS, e.g. when the config is reloaded. Safe to call while serving.
+func (s *APIServer) UpdateCORS(cfg *config.APIConfig) {
+	s.cors.Store(cors.New(cors.Options{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}))
 }
 
 func (s *APIServer) UseDefaultMiddleware(env string, logger *zap.Logger) {
-	cors := cors.New(cors.Options{
-		AllowedOrigins:   s.cfg.AllowedOrigins,
-		AllowedMethods:   s.cfg.AllowedMethods,
-		AllowedHeaders:   s.cfg.AllowedHeaders,
-		ExposedHeaders:   s.cfg.AllowedHeaders,
-		AllowCredentials: s.cfg.AllowCredentials,
-		MaxAge:           s.cfg.MaxAge,
-	})
-
-	s.Router.Use(cors.Handler)
+	s.UseCORS()
 
 	s.Router.Use(chiMiddleware.RequestID)
 	s.Router.Use(chiMiddleware.RealIP)
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/jose-lico/go-plate/config"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+)
+
+// Serves the effective configuration at /debug/config: every variable with its parsed value, the layer that set it,
+// unknown variables and warnings. Secrets are redacted, but the rest still describes the deployment,
+// so middlewares must only let admins through.
+func (s *APIServer) UseConfigEndpoint(report func() *config.Report, middlewares ...func(http.Handler) http.Handler) {
+	if report == nil || len(middlewares) == 0 {
+		zap.L().Fatal("The config endpoint requires a report and middleware restricting it to admins")
+	}
+
+	s.configReport = report
+	s.configMiddlewares = middlewares
+}
+
+func (s *APIServer) mountConfigEndpoint() {
+	if s.configReport == nil {
+		return
+	}
+
+	s.Router.With(s.configMiddlewares...).Get("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		utils.WriteJSON(w, http.StatusOK, s.configReport())
+	})
+}
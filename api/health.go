@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jose-lico/go-plate/utils"
+)
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type healthCheck struct {
+	checker HealthChecker
+	timeout time.Duration
+}
+
+type HealthCheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// Registers a dependency check for /readyz. A timeout <= 0 uses HEALTH_CHECK_TIMEOUT.
+func (s *APIServer) AddHealthCheck(checker HealthChecker, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = s.cfg.HealthCheckTimeout
+	}
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	s.healthChecks = append(s.healthChecks, healthCheck{checker: checker, timeout: timeout})
+}
+
+func (s *APIServer) mountHealthEndpoints() {
+	s.Router.Get("/healthz", s.healthz)
+	s.Router.Get("/readyz", s.readyz)
+}
+
+// Liveness only reports that the process is serving requests, dependencies are not checked.
+func (s *APIServer) healthz(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, &HealthReport{Status: "ok"})
+}
+
+func (s *APIServer) readyz(w http.ResponseWriter, r *http.Request) {
+	if s.shuttingDown.Load() {
+		utils.WriteJSON(w, http.StatusServiceUnavailable, &HealthReport{Status: "shutting down"})
+		return
+	}
+
+	report := &HealthReport{Status: "ok", Checks: make(map[string]HealthCheckResult, len(s.healthChecks))}
+	status := http.StatusOK
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, hc := range s.healthChecks {
+		wg.Add(1)
+		go func(hc healthCheck) {
+			defer wg.Done()
+
+			result := runHealthCheck(r.Context(), hc)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[hc.checker.Name()] = result
+			if result.Error != "" {
+				report.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+			}
+		}(hc)
+	}
+
+	wg.Wait()
+
+	utils.WriteJSON(w, status, report)
+}
+
+func runHealthCheck(ctx context.Context, hc healthCheck) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	t1 := time.Now()
+	err := hc.checker.Check(ctx)
+	latency := time.Since(t1)
+
+	if err != nil {
+		return HealthCheckResult{Status: "fail", Latency: latency.String(), Error: err.Error()}
+	}
+
+	return HealthCheckResult{Status: "ok", Latency: latency.String()}
+}
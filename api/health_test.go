@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+type mockHealthChecker struct {
+	name string
+	err  error
+	// Blocks until the check's context is done instead of returning
+	hang bool
+}
+
+func (c *mockHealthChecker) Name() string {
+	return c.name
+}
+
+func (c *mockHealthChecker) Check(ctx context.Context) error {
+	if c.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.err
+}
+
+func getHealth(t *testing.T, server *APIServer, path string) (int, *HealthReport) {
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report HealthReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, &report
+}
+
+func TestHealthz(t *testing.T) {
+	server := NewAPIServer(&config.APIConfig{})
+	server.AddHealthCheck(&mockHealthChecker{name: "redis", err: errors.New("connection refused")}, 0)
+	server.mountHealthEndpoints()
+
+	// Liveness doesn't depend on the checks
+	if status, report := getHealth(t, server, "/healthz"); status != http.StatusOK || report.Status != "ok" || len(report.Checks) != 0 {
+		t.Errorf("expected a plain ok, got %d %+v", status, report)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		checkers []*mockHealthChecker
+		status   int
+		report   string
+		failed   string
+	}{
+		{name: "No checks", status: http.StatusOK, report: "ok"},
+		{name: "Passing", checkers: []*mockHealthChecker{{name: "redis"}, {name: "postgres"}}, status: http.StatusOK, report: "ok"},
+		{name: "Failing", checkers: []*mockHealthChecker{{name: "redis"}, {name: "postgres", err: errors.New("connection refused")}}, status: http.StatusServiceUnavailable, report: "unavailable", failed: "postgres"},
+		{name: "Timing out", checkers: []*mockHealthChecker{{name: "redis", hang: true}, {name: "postgres"}}, status: http.StatusServiceUnavailable, report: "unavailable", failed: "redis"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewAPIServer(&config.APIConfig{HealthCheckTimeout: 20 * time.Millisecond})
+			for _, checker := range tt.checkers {
+				server.AddHealthCheck(checker, 0)
+			}
+			server.mountHealthEndpoints()
+
+			status, report := getHealth(t, server, "/readyz")
+			if status != tt.status || report.Status != tt.report {
+				t.Fatalf("expected %d %s, got %d %s", tt.status, tt.report, status, report.Status)
+			}
+			if len(report.Checks) != len(tt.checkers) {
+				t.Fatalf("expected a result per check, got %+v", report.Checks)
+			}
+
+			for name, result := range report.Checks {
+				if failed := name == tt.failed; failed != (result.Status == "fail") || failed != (result.Error != "") {
+					t.Errorf("%s: unexpected result %+v", name, result)
+				}
+			}
+		})
+	}
+}
+
+func TestAddHealthCheck_Timeout(t *testing.T) {
+	server := NewAPIServer(&config.APIConfig{HealthCheckTimeout: time.Hour})
+	server.AddHealthCheck(&mockHealthChecker{name: "slow", hang: true}, 20*time.Millisecond)
+	server.AddHealthCheck(&mockHealthChecker{name: "default"}, 0)
+
+	defaults := NewAPIServer(&config.APIConfig{})
+	defaults.AddHealthCheck(&mockHealthChecker{name: "default"}, 0)
+
+	for server, expected := range map[*APIServer][]time.Duration{
+		server:   {20 * time.Millisecond, time.Hour},
+		defaults: {defaultHealthCheckTimeout},
+	} {
+		for i, hc := range server.healthChecks {
+			if hc.timeout != expected[i] {
+				t.Errorf("%s: expected %v, got %v", hc.checker.Name(), expected[i], hc.timeout)
+			}
+		}
+	}
+
+	// A hanging check is cut off by its own timeout, not the request's
+	server.mountHealthEndpoints()
+
+	t1 := time.Now()
+	status, report := getHealth(t, server, "/readyz")
+	if elapsed := time.Since(t1); elapsed > time.Second {
+		t.Errorf("expected the check to time out, took %v", elapsed)
+	}
+	if status != http.StatusServiceUnavailable || report.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("expected the slow check to fail with a timeout, got %d %+v", status, report.Checks["slow"])
+	}
+}
+
+// Readiness fails while the server still accepts requests, for SHUTDOWN_DRAIN, before the listeners close
+func TestRun_ReadinessFlipsBeforeShutdown(t *testing.T) {
+	server := newTestServer(t, &config.APIConfig{ShutdownDrain: 300 * time.Millisecond})
+	url := "http://" + server.listener.Addr().String() + "/readyz"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	serving := make(chan struct{})
+	server.OnStart("serving", func(ctx context.Context) error {
+		close(serving)
+		return nil
+	})
+	go func() {
+		done <- server.Run(ctx)
+	}()
+	<-serving
+
+	readyz := func() int {
+		resp, err := http.Get(url)
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The listener is open before Run starts, but routes are mounted once start hooks ran
+	for status := readyz(); status != http.StatusOK; status = readyz() {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+
+	for status := readyz(); status != http.StatusServiceUnavailable; status = readyz() {
+		if status != http.StatusOK {
+			t.Fatalf("expected the server to keep serving while draining, got %d", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if status := readyz(); status != 0 {
+		t.Errorf("expected the server to be closed after draining, got %d", status)
+	}
+}
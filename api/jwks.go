@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/utils"
+)
+
+type JWKSProvider interface {
+	JWKS() *jwt.JWKS
+}
+
+// Publishes the public signing keys at /.well-known/jwks.json so downstream services can verify issued tokens
+func (s *APIServer) UseJWKS(provider JWKSProvider) {
+	s.jwks = provider
+}
+
+func (s *APIServer) mountJWKSEndpoint() {
+	if s.jwks == nil {
+		return
+	}
+
+	s.Router.Get("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		utils.WriteJSON(w, http.StatusOK, s.jwks.JWKS())
+	})
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultShutdownTimeout = 3 * time.Second
+
+type Hook func(ctx context.Context) error
+
+type hook struct {
+	name string
+	fn   Hook
+}
+
+// Hooks run in registration order. A failing start hook prevents the server from starting.
+func (s *APIServer) OnStart(name string, fn Hook) {
+	s.onStart = append(s.onStart, hook{name: name, fn: fn})
+}
+
+// Shutdown hooks run after in-flight requests have been drained, e.g. to close connection pools.
+// If a start hook fails, shutdown hooks sharing the name of a start hook that did not complete are skipped,
+// hooks of components set up before Run, without a start hook, still run.
+func (s *APIServer) OnShutdown(name string, fn Hook) {
+	s.onShutdown = append(s.onShutdown, hook{name: name, fn: fn})
+}
+
+// Blocks until ctx is cancelled, SIGINT/SIGTERM is received or the server fails, then shuts down gracefully.
+func (s *APIServer) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := zap.L()
+
+	for i, h := range s.onStart {
+		if err := h.fn(ctx); err != nil {
+			logger.Error("Start hook returned an error", zap.String("Hook", h.name), zap.Error(err))
+			s.shutdownHooks(logger, s.notStarted(i))
+			return fmt.Errorf("start hook %s failed: %w", h.name, err)
+		}
+	}
+
+	s.mountHealthEndpoints()
+	s.mountJWKSEndpoint()
+	s.mountConfigEndpoint()
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		logger.Info("Starting API server", zap.String("Address", s.Server.Addr))
+		if err := s.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+			return
+		}
+
+		logger.Info("Stopped serving new connections")
+	}()
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Received termination signal, shutting down...")
+	case err = <-serverErr:
+		logger.Error("Failed ListenAndServe()", zap.Error(err))
+	}
+
+	stop()
+
+	// Fail readiness while still serving, so load balancers see it before the listeners close
+	s.shuttingDown.Store(true)
+	if err == nil && s.cfg.ShutdownDrain > 0 {
+		logger.Info("Draining before shutdown", zap.Duration("Delay", s.cfg.ShutdownDrain))
+		time.Sleep(s.cfg.ShutdownDrain)
+	}
+
+	shutdownContext, shutdownCancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer shutdownCancel()
+
+	if err := s.Server.Shutdown(shutdownContext); err != nil {
+		logger.Error("Server shutdown returned an error", zap.Error(err))
+	}
+
+	s.shutdownHooks(logger, nil)
+
+	logger.Info("Server shutdown")
+
+	return err
+}
+
+// Serves on the listener set by tests, or on the configured address
+func (s *APIServer) serve() error {
+	if s.listener != nil {
+		return s.Server.Serve(s.listener)
+	}
+
+	return s.Server.ListenAndServe()
+}
+
+// Names of the components whose start hook did not complete, from the failed hook at index failed onwards
+func (s *APIServer) notStarted(failed int) map[string]bool {
+	started := make(map[string]bool, failed)
+	for _, h := range s.onStart[:failed] {
+		started[h.name] = true
+	}
+
+	skip := make(map[string]bool)
+	for _, h := range s.onStart[failed:] {
+		if !started[h.name] {
+			skip[h.name] = true
+		}
+	}
+
+	return skip
+}
+
+func (s *APIServer) shutdownHooks(logger *zap.Logger, skip map[string]bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+
+	for _, h := range s.onShutdown {
+		if skip[h.name] {
+			logger.Debug("Skipping shutdown hook of a component that did not start", zap.String("Hook", h.name))
+			continue
+		}
+
+		if err := h.fn(ctx); err != nil {
+			logger.Error("Shutdown hook returned an error", zap.String("Hook", h.name), zap.Error(err))
+		}
+	}
+}
+
+func (s *APIServer) shutdownTimeout() time.Duration {
+	if s.cfg.ShutdownTimeout > 0 {
+		return s.cfg.ShutdownTimeout
+	}
+
+	return defaultShutdownTimeout
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+// Serves on a free local port instead of the configured one
+func newTestServer(t *testing.T, cfg *config.APIConfig) *APIServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewAPIServer(cfg)
+	server.listener = listener
+	return server
+}
+
+// Records the hooks that ran, in order
+type hookRecorder struct {
+	calls []string
+}
+
+func (r *hookRecorder) hook(name string, err error) Hook {
+	return func(ctx context.Context) error {
+		r.calls = append(r.calls, name)
+		return err
+	}
+}
+
+func TestRun_HookOrder(t *testing.T) {
+	server := newTestServer(t, &config.APIConfig{})
+	recorder := &hookRecorder{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server.OnStart("first", recorder.hook("start first", nil))
+	server.OnStart("second", func(ctx context.Context) error {
+		recorder.calls = append(recorder.calls, "start second")
+		// Stops the server as soon as it is serving
+		cancel()
+		return nil
+	})
+	server.OnShutdown("first", recorder.hook("shutdown first", nil))
+	server.OnShutdown("second", recorder.hook("shutdown second", errors.New("already closed")))
+	server.OnShutdown("third", recorder.hook("shutdown third", nil))
+
+	if err := server.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failing shutdown hooks don't stop the ones after them
+	expected := []string{"start first", "start second", "shutdown first", "shutdown second", "shutdown third"}
+	if !slices.Equal(recorder.calls, expected) {
+		t.Errorf("expected %v, got %v", expected, recorder.calls)
+	}
+}
+
+func TestRun_StartHookFails(t *testing.T) {
+	server := newTestServer(t, &config.APIConfig{})
+	recorder := &hookRecorder{}
+	hookErr := errors.New("cannot connect")
+
+	server.OnStart("started", recorder.hook("start started", nil))
+	server.OnStart("failing", recorder.hook("start failing", hookErr))
+	server.OnStart("never", recorder.hook("start never", nil))
+	server.OnShutdown("pool", recorder.hook("shutdown pool", nil))
+	server.OnShutdown("started", recorder.hook("shutdown started", nil))
+	server.OnShutdown("failing", recorder.hook("shutdown failing", nil))
+	server.OnShutdown("never", recorder.hook("shutdown never", nil))
+
+	if err := server.Run(context.Background()); !errors.Is(err, hookErr) {
+		t.Fatalf("expected %v, got %v", hookErr, err)
+	}
+
+	// Components without a start hook were set up before Run, so they are closed too
+	expected := []string{"start started", "start failing", "shutdown pool", "shutdown started"}
+	if !slices.Equal(recorder.calls, expected) {
+		t.Errorf("expected %v, got %v", expected, recorder.calls)
+	}
+}
+
+func TestRun_ShutdownTimeout(t *testing.T) {
+	server := newTestServer(t, &config.APIConfig{ShutdownTimeout: 50 * time.Millisecond})
+
+	// A request that never finishes on its own
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server.Router.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	var hookErr error
+	server.OnShutdown("pool", func(ctx context.Context) error {
+		<-ctx.Done()
+		hookErr = ctx.Err()
+		return hookErr
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	go http.Get("http://" + server.listener.Addr().String() + "/slow")
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to give up draining once the shutdown timeout passed")
+	}
+
+	if !errors.Is(hookErr, context.DeadlineExceeded) {
+		t.Errorf("expected shutdown hooks to be bound by the shutdown timeout, got %v", hookErr)
+	}
+}
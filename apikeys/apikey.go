@@ -0,0 +1,48 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+)
+
+// Only the hash of the secret part of a key is stored, the full key is shown once when it is issued
+type APIKey struct {
+	gorm.Model
+
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"type:varchar(64);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(32);not null;uniqueIndex" json:"prefix"` // Public part of the key, used to look it up
+	SecretHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	Scopes     []string   `gorm:"type:text;serializer:json" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Reports whether the key can be used at t, i.e. it is neither revoked nor expired
+func (k *APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// GetByPrefix returns ErrAPIKeyNotFound for unknown prefixes.
+// Revoke returns ErrAPIKeyNotFound if the user has no such key.
+type APIKeyStore interface {
+	Create(ctx context.Context, key *APIKey) error
+	GetByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	ListForUser(ctx context.Context, userID uint) ([]*APIKey, error)
+	Revoke(ctx context.Context, userID, id uint, at time.Time) error
+	TouchLastUsed(ctx context.Context, id uint, at time.Time) error
+}
@@ -0,0 +1,72 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) APIKeyStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Create(ctx context.Context, key *APIKey) error {
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *GormStore) GetByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	var key APIKey
+
+	err := s.db.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (s *GormStore) ListForUser(ctx context.Context, userID uint) ([]*APIKey, error) {
+	var keys []*APIKey
+
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *GormStore) Revoke(ctx context.Context, userID, id uint, at time.Time) error {
+	result := s.db.WithContext(ctx).Model(&APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", at)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke api key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *GormStore) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	if err := s.db.WithContext(ctx).Model(&APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error; err != nil {
+		return fmt.Errorf("failed to update api key last used: %w", err)
+	}
+
+	return nil
+}
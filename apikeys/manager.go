@@ -0,0 +1,120 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/config"
+
+	"go.uber.org/zap"
+)
+
+var idEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// APIKeyManager issues and authenticates API keys for machine clients.
+// Keys look like <prefix>_<id>_<secret>: <prefix>_<id> is stored in the clear to look the key up and show it to users,
+// the secret is only stored hashed.
+type APIKeyManager struct {
+	store APIKeyStore
+	cfg   *config.APIKeyConfig
+}
+
+func NewAPIKeyManager(store APIKeyStore, cfg *config.APIKeyConfig) *APIKeyManager {
+	return &APIKeyManager{store: store, cfg: cfg}
+}
+
+// Issues a key for the user, returning the full key, which can not be recovered later, and its stored record.
+// A nil expiresAt creates a key that never expires.
+func (m *APIKeyManager) Issue(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (string, *APIKey, error) {
+	var id [5]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key id: %w", err)
+	}
+
+	secret, err := auth.GenerateToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key secret: %w", err)
+	}
+
+	key := &APIKey{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     m.cfg.Prefix + "_" + idEncoding.EncodeToString(id[:]),
+		SecretHash: hashSecret(secret),
+		Scopes:     scopes,
+		ExpiresAt:  expiresAt,
+	}
+
+	if err := m.store.Create(ctx, key); err != nil {
+		return "", nil, err
+	}
+
+	return key.Prefix + "_" + secret, key, nil
+}
+
+// Reports whether value looks like one of our keys, so it can be told apart from other bearer credentials
+func (m *APIKeyManager) IsAPIKey(value string) bool {
+	return strings.HasPrefix(value, m.cfg.Prefix+"_")
+}
+
+// Returns the record of value if it is a valid, active key, or ErrInvalidAPIKey.
+func (m *APIKeyManager) Authenticate(ctx context.Context, value string) (*APIKey, error) {
+	if !m.IsAPIKey(value) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	i := strings.LastIndexByte(value, '_')
+	prefix, secret := value[:i], value[i+1:]
+
+	key, err := m.store.GetByPrefix(ctx, prefix)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+
+	if !key.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Failing to track usage should not fail the request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= m.cfg.TouchInterval {
+		if err := m.store.TouchLastUsed(ctx, key.ID, now); err != nil {
+			zap.L().Warn("Error updating api key last used", zap.Error(err), zap.String("prefix", key.Prefix))
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return key, nil
+}
+
+func (m *APIKeyManager) ListForUser(ctx context.Context, userID uint) ([]*APIKey, error) {
+	return m.store.ListForUser(ctx, userID)
+}
+
+// Revokes one of the user's keys. Returns ErrAPIKeyNotFound if the user has no such active key.
+func (m *APIKeyManager) Revoke(ctx context.Context, userID, id uint) error {
+	return m.store.Revoke(ctx, userID, id, time.Now())
+}
+
+// Secrets are random 256 bit values, so a fast unkeyed hash is enough
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,182 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+type mockStore struct {
+	keys     []*APIKey
+	touches  int
+	touchErr error
+}
+
+func (s *mockStore) Create(ctx context.Context, key *APIKey) error {
+	key.ID = uint(len(s.keys) + 1)
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+func (s *mockStore) GetByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	for _, key := range s.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (s *mockStore) ListForUser(ctx context.Context, userID uint) ([]*APIKey, error) {
+	return s.keys, nil
+}
+
+func (s *mockStore) Revoke(ctx context.Context, userID, id uint, at time.Time) error {
+	for _, key := range s.keys {
+		if key.ID == id && key.UserID == userID && key.RevokedAt == nil {
+			key.RevokedAt = &at
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (s *mockStore) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	if s.touchErr != nil {
+		return s.touchErr
+	}
+
+	s.touches++
+	s.keys[id-1].LastUsedAt = &at
+	return nil
+}
+
+func newTestManager() (*APIKeyManager, *mockStore) {
+	store := &mockStore{}
+	return NewAPIKeyManager(store, &config.APIKeyConfig{Prefix: "gp", TouchInterval: time.Minute}), store
+}
+
+func TestAPIKeyManager_Authenticate(t *testing.T) {
+	manager, _ := newTestManager()
+	ctx := context.Background()
+
+	value, issued, err := manager.Issue(ctx, 1, "ci", []string{"posts:read"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, issued.Prefix+"_") || strings.Count(issued.Prefix, "_") != 1 {
+		t.Fatalf("unexpected key %s with prefix %s", value, issued.Prefix)
+	}
+
+	secret := value[len(issued.Prefix)+1:]
+
+	tests := []struct {
+		name  string
+		value string
+		err   error
+	}{
+		{name: "Valid", value: value},
+		{name: "Other prefix", value: "xx" + value[2:], err: ErrInvalidAPIKey},
+		{name: "Wrong secret", value: issued.Prefix + "_" + strings.Repeat("0", len(secret)), err: ErrInvalidAPIKey},
+		{name: "Missing secret", value: issued.Prefix + "_", err: ErrInvalidAPIKey},
+		{name: "Missing id", value: "gp_" + secret, err: ErrInvalidAPIKey},
+		// Splitting on the last underscore makes anything appended part of the looked up prefix
+		{name: "Trailing segment", value: value + "_extra", err: ErrInvalidAPIKey},
+		{name: "Unknown id", value: "gp_aaaaaaaa_" + secret, err: ErrInvalidAPIKey},
+		{name: "Empty", value: "", err: ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := manager.Authenticate(ctx, tt.value)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if err == nil && (key.ID != issued.ID || key.UserID != 1 || !key.HasScope("posts:read")) {
+				t.Errorf("unexpected key %+v", key)
+			}
+		})
+	}
+}
+
+func TestAPIKeyManager_ExpiryAndRevocation(t *testing.T) {
+	manager, _ := newTestManager()
+	ctx := context.Background()
+
+	expired := time.Now().Add(-time.Second)
+	expiredValue, _, err := manager.Issue(ctx, 1, "expired", nil, &expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Authenticate(ctx, expiredValue); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected an expired key to be rejected, got %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	value, key, err := manager.Issue(ctx, 1, "ci", nil, &expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Authenticate(ctx, value); err != nil {
+		t.Fatalf("expected a key that has not expired yet to be accepted, got %v", err)
+	}
+
+	if err := manager.Revoke(ctx, 2, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected keys of other users not to be found, got %v", err)
+	}
+	if err := manager.Revoke(ctx, 1, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Authenticate(ctx, value); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected a revoked key to be rejected, got %v", err)
+	}
+	if err := manager.Revoke(ctx, 1, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected revoking twice to fail, got %v", err)
+	}
+}
+
+func TestAPIKeyManager_TouchInterval(t *testing.T) {
+	manager, store := newTestManager()
+	ctx := context.Background()
+
+	value, key, err := manager.Issue(ctx, 1, "ci", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		authenticated, err := manager.Authenticate(ctx, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authenticated.LastUsedAt == nil {
+			t.Error("expected the last used time to be set")
+		}
+	}
+	if store.touches != 1 {
+		t.Errorf("expected a single write within the touch interval, got %d", store.touches)
+	}
+
+	longAgo := time.Now().Add(-2 * time.Minute)
+	store.keys[key.ID-1].LastUsedAt = &longAgo
+
+	if _, err := manager.Authenticate(ctx, value); err != nil {
+		t.Fatal(err)
+	}
+	if store.touches != 2 {
+		t.Errorf("expected a write once the touch interval passed, got %d", store.touches)
+	}
+
+	// Failing to track usage does not fail the request
+	store.keys[key.ID-1].LastUsedAt = &longAgo
+	store.touchErr = errors.New("database is down")
+
+	if _, err := manager.Authenticate(ctx, value); err != nil {
+		t.Errorf("expected the key to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters, tests don't need a slow hash
+var testArgon2idParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2idParams)
+
+	hash, err := hasher.Hash("MyPassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") || !hasher.CanVerify(hash) {
+		t.Errorf("unexpected hash %s", hash)
+	}
+
+	if other, _ := hasher.Hash("MyPassword"); other == hash {
+		t.Error("expected every hash to use a new salt")
+	}
+
+	if ok, needsRehash, err := hasher.Verify(hash, "MyPassword"); !ok || needsRehash || err != nil {
+		t.Errorf("expected the password to verify, got ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+	if ok, _, err := hasher.Verify(hash, "WrongPassword"); ok || err != nil {
+		t.Errorf("expected a wrong password to be rejected, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestArgon2idHasher_NeedsRehash(t *testing.T) {
+	weak, err := NewArgon2idHasher(testArgon2idParams).Hash("MyPassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(params *Argon2idParams)
+		needsRehash bool
+	}{
+		{name: "Same parameters", modify: func(p *Argon2idParams) {}},
+		{name: "Weaker parameters", modify: func(p *Argon2idParams) { p.Memory, p.Iterations, p.SaltLength, p.KeyLength = 512, 1, 8, 16 }},
+		{name: "More memory", modify: func(p *Argon2idParams) { p.Memory *= 2 }, needsRehash: true},
+		{name: "More iterations", modify: func(p *Argon2idParams) { p.Iterations++ }, needsRehash: true},
+		{name: "Other parallelism", modify: func(p *Argon2idParams) { p.Parallelism++ }, needsRehash: true},
+		{name: "Longer salt", modify: func(p *Argon2idParams) { p.SaltLength *= 2 }, needsRehash: true},
+		{name: "Longer key", modify: func(p *Argon2idParams) { p.KeyLength *= 2 }, needsRehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := testArgon2idParams
+			tt.modify(&params)
+
+			ok, needsRehash, err := NewArgon2idHasher(params).Verify(weak, "MyPassword")
+			if !ok || err != nil {
+				t.Fatalf("expected the password to verify, got ok=%v err=%v", ok, err)
+			}
+			if needsRehash != tt.needsRehash {
+				t.Errorf("expected needsRehash %v, got %v", tt.needsRehash, needsRehash)
+			}
+		})
+	}
+}
+
+func TestArgon2idHasher_MalformedHash(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2idParams)
+
+	const salt, key = "c29tZXNhbHRzb21lc2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"
+
+	tests := []struct {
+		name    string
+		encoded string
+		err     error
+	}{
+		{name: "Missing parts", encoded: "$argon2id$v=19$m=1024,t=1,p=1$" + salt, err: ErrMalformedHash},
+		{name: "Other algorithm", encoded: "$argon2i$v=19$m=1024,t=1,p=1$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Other version", encoded: "$argon2id$v=16$m=1024,t=1,p=1$" + salt + "$" + key, err: ErrUnsupportedHash},
+		{name: "Bad parameters", encoded: "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Zero memory", encoded: "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Zero iterations", encoded: "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Zero parallelism", encoded: "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Parallelism overflow", encoded: "$argon2id$v=19$m=1024,t=1,p=256$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Oversized memory", encoded: "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Oversized iterations", encoded: "$argon2id$v=19$m=1024,t=4294967295,p=1$" + salt + "$" + key, err: ErrMalformedHash},
+		{name: "Bad salt", encoded: "$argon2id$v=19$m=1024,t=1,p=1$!!!$" + key, err: ErrMalformedHash},
+		{name: "Empty key", encoded: "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$", err: ErrMalformedHash},
+		{name: "Oversized key", encoded: "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$" + strings.Repeat("A", 2000), err: ErrMalformedHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, _, err := hasher.Verify(tt.encoded, "MyPassword"); ok || !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got ok=%v err=%v", tt.err, ok, err)
+			}
+		})
+	}
+}
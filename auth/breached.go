@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const hashPrefixLength = 5
+
+// Offline set of breached passwords, stored like the Have I Been Pwned k-anonymity range API: one `PREFIX.txt` file
+// per 5 character SHA-1 prefix, holding a `SUFFIX[:COUNT]` line for every hash in the bucket.
+// A check only reads the bucket of the password's prefix, the corpus is never loaded into memory.
+type BreachedPasswords struct {
+	dir string
+}
+
+func OpenBreachedPasswords(dir string) (*BreachedPasswords, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password corpus: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password corpus %s is not a directory of hash buckets", dir)
+	}
+
+	return &BreachedPasswords{dir: dir}, nil
+}
+
+// A bucket that can't be read is logged and the password treated as not breached, so a broken corpus doesn't lock users out
+func (b *BreachedPasswords) Contains(password string) bool {
+	found, err := b.contains(password)
+	if err != nil {
+		zap.L().Error("Error reading breached password corpus", zap.Error(err))
+	}
+
+	return found
+}
+
+func (b *BreachedPasswords) contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+
+	// No bucket means no breached hash has this prefix
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to open breached password bucket %s: %w", prefix, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(entry, suffix) {
+			return true, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached password bucket %s: %w", prefix, err)
+	}
+
+	return false, nil
+}
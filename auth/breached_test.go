@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8, of "qwerty" B1B3773A05C0ED0176787A4F1574FF0075F7521E
+	buckets := map[string]string{
+		"5BAA6": "003D68EB55068C33ACE09247EE4C639306B:3\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n",
+		"B1B37": "73a05c0ed0176787a4f1574ff0075f7521e\n",
+	}
+	for prefix, bucket := range buckets {
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(bucket), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	breached, err := OpenBreachedPasswords(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		expected bool
+	}{
+		{password: "password", expected: true},
+		{password: "qwerty", expected: true}, // lowercase hashes without a count
+		{password: "Password", expected: false},
+		{password: "correct horse battery staple", expected: false}, // no bucket for the prefix
+	}
+
+	for _, tt := range tests {
+		if found, err := breached.contains(tt.password); found != tt.expected || err != nil {
+			t.Errorf("%q: expected %v, got %v, %v", tt.password, tt.expected, found, err)
+		}
+	}
+}
+
+func TestOpenBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "breached_passwords.txt")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, filepath.Join(dir, "missing")} {
+		if _, err := OpenBreachedPasswords(path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package jwt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/config"
+	"github.com/jose-lico/go-plate/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidIssuer       = errors.New("invalid token issuer")
+	ErrInvalidAudience     = errors.New("invalid token audience")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+type TokenVerifier interface {
+	Verify(token string) (*Claims, error)
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh tokens are opaque and stored hashed in Redis. Every refresh token belongs to a family, started on login.
+// Refreshing consumes the token and issues a new one in the same family, presenting a consumed token revokes the whole family.
+type refreshToken struct {
+	Family string         `json:"family"`
+	UserID int            `json:"user_id"`
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+type Issuer struct {
+	keys  KeySource
+	redis database.RedisStore
+	cfg   *config.JWTConfig
+}
+
+func NewIssuer(keys KeySource, redis database.RedisStore, cfg *config.JWTConfig) *Issuer {
+	return &Issuer{keys: keys, redis: redis, cfg: cfg}
+}
+
+// Builds the key source described by cfg: a managed, rotating key set if a key store is configured, a single static key otherwise
+func NewKeySourceFromConfig(ctx context.Context, redis database.RedisStore, cfg *config.JWTConfig) (KeySource, error) {
+	switch cfg.KeyStore {
+	case "file":
+		return NewKeyManager(ctx, NewFileKeyStore(cfg.KeyStorePath), cfg)
+	case "redis":
+		return NewKeyManager(ctx, NewRedisKeyStore(redis, cfg.KeyPrefix+"keyset"), cfg)
+	case "":
+	default:
+		return nil, fmt.Errorf("unsupported JWT key store %q", cfg.KeyStore)
+	}
+
+	switch cfg.Algorithm {
+	case HS256:
+		if cfg.Secret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		return NewStaticKeySource(NewHS256Key([]byte(cfg.Secret))), nil
+	case EdDSA, RS256:
+		key, err := LoadPrivateKey(cfg.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm() != cfg.Algorithm {
+			return nil, fmt.Errorf("private key is for %s, expected %s", key.Algorithm(), cfg.Algorithm)
+		}
+		return NewStaticKeySource(key), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+}
+
+// Signs an access token for the user. Extra claims are added as is.
+func (i *Issuer) AccessToken(userID int, extra map[string]any) (string, error) {
+	id, err := auth.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := &Claims{
+		Issuer:    i.cfg.Issuer,
+		Subject:   strconv.Itoa(userID),
+		ExpiresAt: now.Add(i.cfg.AccessTokenTTL).Unix(),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ID:        id[:32],
+		Extra:     extra,
+	}
+
+	if i.cfg.Audience != "" {
+		claims.Audience = Audience{i.cfg.Audience}
+	}
+
+	kid, key := i.keys.SigningKey()
+	return Sign(claims, key, kid)
+}
+
+// Issues an access token and starts a new refresh token family, e.g. on login
+func (i *Issuer) Issue(ctx context.Context, userID int, extra map[string]any) (*TokenPair, error) {
+	family, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Families added to the index meanwhile are pruned on a later login
+	families, err := i.redis.SMembers(ctx, i.userKey(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refresh token families: %w", err)
+	}
+
+	keys := append([]string{i.familyKey(userID, family), i.userKey(userID)}, i.familyKeys(userID, families)...)
+	args := append([]any{userID, i.cfg.RefreshTokenTTL.Milliseconds(), family}, stringsToAny(families)...)
+	if err := issueFamilyScript.Run(ctx, i.client(), keys, args...).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token family: %w", err)
+	}
+
+	return i.issue(ctx, &refreshToken{Family: family, UserID: userID, Claims: extra})
+}
+
+// Exchanges a refresh token for a new token pair. The presented refresh token can not be used again.
+func (i *Issuer) Refresh(ctx context.Context, token string) (*TokenPair, error) {
+	hash := hashRefreshToken(token)
+
+	rt, err := i.refreshToken(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checking the family, consuming the token and extending the family are a single step,
+	// so a family revoked meanwhile is never brought back and concurrent refreshes with the same token count as reuse
+	keys := []string{i.familyKey(rt.UserID, rt.Family), i.usedKey(rt.UserID, hash), i.userKey(rt.UserID)}
+	result, err := refreshScript.Run(ctx, i.client(), keys, i.cfg.RefreshTokenTTL.Milliseconds(), rt.Family).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	switch result {
+	case refreshFamilyRevoked:
+		return nil, ErrInvalidRefreshToken
+	case refreshTokenReused:
+		return nil, ErrRefreshTokenReused
+	}
+
+	return i.issue(ctx, rt)
+}
+
+// Revokes the family of the refresh token, e.g. on logout
+func (i *Issuer) Revoke(ctx context.Context, token string) error {
+	rt, err := i.refreshToken(ctx, hashRefreshToken(token))
+	if err != nil {
+		return err
+	}
+
+	_, err = i.client().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, i.familyKey(rt.UserID, rt.Family))
+		pipe.SRem(ctx, i.userKey(rt.UserID), rt.Family)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// Revokes every refresh token family of the user, e.g. on password reset or when logging out everywhere.
+// Access tokens already issued stay valid until they expire. The families are read again if one was started meanwhile.
+func (i *Issuer) RevokeAllForUser(ctx context.Context, userID int) error {
+	userKey := i.userKey(userID)
+
+	for attempt := 0; attempt < maxRevokeAllAttempts; attempt++ {
+		families, err := i.redis.SMembers(ctx, userKey)
+		if err != nil {
+			return fmt.Errorf("failed to list refresh token families: %w", err)
+		}
+
+		keys := append([]string{userKey}, i.familyKeys(userID, families)...)
+		revoked, err := revokeAllScript.Run(ctx, i.client(), keys, stringsToAny(families)...).Int()
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh token families: %w", err)
+		}
+		if revoked == 1 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to revoke refresh token families: families kept being started after %d attempts", maxRevokeAllAttempts)
+}
+
+func (i *Issuer) refreshToken(ctx context.Context, hash string) (*refreshToken, error) {
+	data, err := i.redis.Get(ctx, i.tokenKey(hash))
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read refresh token: %w", err)
+	}
+
+	var rt refreshToken
+	if err := json.Unmarshal([]byte(data), &rt); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal refresh token: %w", err)
+	}
+
+	return &rt, nil
+}
+
+// Verifies an access token issued by this issuer
+func (i *Issuer) Verify(token string) (*Claims, error) {
+	claims, err := Parse(token, func(header *Header) (Key, error) {
+		return i.keys.VerificationKey(header.KeyID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, i.validate(claims)
+}
+
+func (i *Issuer) validate(claims *Claims) error {
+	if claims.Issuer != i.cfg.Issuer {
+		return ErrInvalidIssuer
+	}
+
+	if i.cfg.Audience != "" && !claims.Audience.Contains(i.cfg.Audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+func (i *Issuer) issue(ctx context.Context, rt *refreshToken) (*TokenPair, error) {
+	accessToken, err := i.AccessToken(rt.UserID, rt.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	marshalled, err := json.Marshal(rt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal refresh token: %w", err)
+	}
+
+	if err := i.redis.Set(ctx, i.tokenKey(hashRefreshToken(token)), marshalled, i.cfg.RefreshTokenTTL); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(i.cfg.AccessTokenTTL.Seconds()),
+		RefreshToken: token,
+	}, nil
+}
+
+func (i *Issuer) tokenKey(hash string) string {
+	return i.cfg.KeyPrefix + "token:" + hash
+}
+
+// Keys used together in a script share the user's hash tag, so Redis Cluster keeps them in one slot
+
+func (i *Issuer) usedKey(userID int, hash string) string {
+	return i.cfg.KeyPrefix + "used:" + userHashTag(userID) + ":" + hash
+}
+
+func (i *Issuer) familyKey(userID int, family string) string {
+	return i.cfg.KeyPrefix + "family:" + userHashTag(userID) + ":" + family
+}
+
+func (i *Issuer) familyKeys(userID int, families []string) []string {
+	keys := make([]string, len(families))
+	for n, family := range families {
+		keys[n] = i.familyKey(userID, family)
+	}
+	return keys
+}
+
+// Families of a user, expiring with the most recently used one
+func (i *Issuer) userKey(userID int) string {
+	return i.cfg.KeyPrefix + "user:" + userHashTag(userID)
+}
+
+func userHashTag(userID int) string {
+	return "{" + strconv.Itoa(userID) + "}"
+}
+
+func stringsToAny(values []string) []any {
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+func (i *Issuer) client() *redis.Client {
+	return i.redis.GetNativeInstance().(*redis.Client)
+}
+
+func hashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Results of refreshScript
+const (
+	refreshFamilyRevoked = 0
+	refreshConsumed      = 1
+	refreshTokenReused   = 2
+)
+
+const maxRevokeAllAttempts = 5
+
+var (
+	issueFamilyScript = redis.NewScript(luaIssueFamily)
+	refreshScript     = redis.NewScript(luaRefresh)
+	revokeAllScript   = redis.NewScript(luaRevokeAllFamilies)
+)
+
+var luaIssueFamily = `
+local user_key = KEYS[2]
+
+-- KEYS[3..] are the families of the index, named by ARGV[4..]
+for i = 3, #KEYS do
+    if redis.call("EXISTS", KEYS[i]) == 0 then
+        redis.call("SREM", user_key, ARGV[i + 1])
+    end
+end
+
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SADD", user_key, ARGV[3])
+redis.call("PEXPIRE", user_key, ARGV[2])
+
+return 1
+`
+
+var luaRefresh = `
+local family_key = KEYS[1]
+local user_key = KEYS[3]
+
+if redis.call("EXISTS", family_key) == 0 then
+    return 0
+end
+
+if not redis.call("SET", KEYS[2], 1, "NX", "PX", ARGV[1]) then
+    redis.call("DEL", family_key)
+    redis.call("SREM", user_key, ARGV[2])
+    return 2
+end
+
+redis.call("PEXPIRE", family_key, ARGV[1])
+redis.call("PEXPIRE", user_key, ARGV[1])
+
+return 1
+`
+
+var luaRevokeAllFamilies = `
+local read = {}
+for _, family in ipairs(ARGV) do
+    read[family] = true
+end
+
+-- A family started since the index was read has no key in KEYS
+for _, family in ipairs(redis.call("SMEMBERS", KEYS[1])) do
+    if not read[family] then
+        return 0
+    end
+end
+
+for i = 2, #KEYS do
+    redis.call("DEL", KEYS[i])
+end
+
+redis.call("DEL", KEYS[1])
+
+return 1
+`
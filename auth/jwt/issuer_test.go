@@ -0,0 +1,248 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+	"github.com/jose-lico/go-plate/database"
+	"github.com/jose-lico/go-plate/database/redistest"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestIssuer(t *testing.T) (*Issuer, *miniredis.Miniredis) {
+	redis, server := redistest.New(t)
+	return newTestIssuerWith(redis), server
+}
+
+func newTestIssuerWith(redis database.RedisStore) *Issuer {
+	cfg := &config.JWTConfig{
+		Issuer:          "go-plate",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		KeyPrefix:       "refresh:",
+	}
+
+	return NewIssuer(NewStaticKeySource(NewHS256Key([]byte("secret"))), redis, cfg)
+}
+
+func TestIssuer_Verify(t *testing.T) {
+	issuer, _ := newTestIssuer(t)
+
+	pair, err := issuer.Issue(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := issuer.Verify(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, _ := claims.UserID(); userID != 1 {
+		t.Errorf("expected user 1, got %d", userID)
+	}
+
+	other := NewIssuer(issuer.keys, issuer.redis, &config.JWTConfig{Issuer: "someone-else"})
+	if _, err := other.Verify(pair.AccessToken); !errors.Is(err, ErrInvalidIssuer) {
+		t.Errorf("expected %v, got %v", ErrInvalidIssuer, err)
+	}
+}
+
+func TestIssuer_RefreshRotation(t *testing.T) {
+	issuer, _ := newTestIssuer(t)
+	ctx := context.Background()
+
+	first, err := issuer.Issue(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := issuer.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying a consumed token revokes every token of the login
+	if _, err := issuer.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("expected %v, got %v", ErrRefreshTokenReused, err)
+	}
+	if _, err := issuer.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected the family to be revoked, got %v", err)
+	}
+
+	if _, err := issuer.Refresh(ctx, "unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected %v, got %v", ErrInvalidRefreshToken, err)
+	}
+}
+
+func TestIssuer_ConcurrentRefreshReuse(t *testing.T) {
+	issuer, _ := newTestIssuer(t)
+	ctx := context.Background()
+
+	pair, err := issuer.Issue(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		refreshed []*TokenPair
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			next, err := issuer.Refresh(ctx, pair.RefreshToken)
+			if err != nil {
+				if !errors.Is(err, ErrRefreshTokenReused) && !errors.Is(err, ErrInvalidRefreshToken) {
+					t.Error(err)
+				}
+				return
+			}
+
+			mu.Lock()
+			refreshed = append(refreshed, next)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(refreshed) != 1 {
+		t.Fatalf("expected exactly one refresh to succeed, got %d", len(refreshed))
+	}
+
+	if _, err := issuer.Refresh(ctx, refreshed[0].RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected the reuse to revoke the family, got %v", err)
+	}
+}
+
+func TestIssuer_Revoke(t *testing.T) {
+	issuer, server := newTestIssuer(t)
+	ctx := context.Background()
+
+	pair, err := issuer.Issue(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := issuer.Revoke(ctx, pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := issuer.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected %v, got %v", ErrInvalidRefreshToken, err)
+	}
+	if members, _ := server.Members("refresh:user:{1}"); len(members) != 0 {
+		t.Errorf("expected the family to be dropped from the user's index, got %v", members)
+	}
+}
+
+func TestIssuer_RevokeAllForUser(t *testing.T) {
+	issuer, server := newTestIssuer(t)
+	ctx := context.Background()
+
+	var pairs []*TokenPair
+	for _, userID := range []int{1, 1, 2} {
+		pair, err := issuer.Issue(ctx, userID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs = append(pairs, pair)
+	}
+
+	if err := issuer.RevokeAllForUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pair := range pairs[:2] {
+		if _, err := issuer.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("expected %v, got %v", ErrInvalidRefreshToken, err)
+		}
+	}
+	if _, err := issuer.Refresh(ctx, pairs[2].RefreshToken); err != nil {
+		t.Errorf("expected other users to keep their tokens, got %v", err)
+	}
+
+	if server.Exists("refresh:user:{1}") {
+		t.Error("expected the user's index to be deleted")
+	}
+}
+
+func TestIssuer_FamilyIndexExpires(t *testing.T) {
+	issuer, server := newTestIssuer(t)
+	ctx := context.Background()
+
+	if _, err := issuer.Issue(ctx, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("refresh:user:{1}"); ttl != time.Hour {
+		t.Errorf("expected the index to expire with its families, got %v", ttl)
+	}
+
+	server.FastForward(30 * time.Minute)
+	if _, err := issuer.Issue(ctx, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first family has expired
+	server.FastForward(45 * time.Minute)
+	if _, err := issuer.Issue(ctx, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if members, _ := server.Members("refresh:user:{1}"); len(members) != 2 {
+		t.Errorf("expected expired families to be pruned, got %v", members)
+	}
+}
+
+// Redis Cluster and key-aware proxies route scripts by their KEYS, so no script may touch another key,
+// and the keys of a user's families must share a slot
+func TestIssuer_ScriptKeys(t *testing.T) {
+	redis, server := redistest.NewCheckingScriptKeys(t)
+	issuer := newTestIssuerWith(redis)
+	ctx := context.Background()
+
+	first, err := issuer.Issue(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pruning the expired family from the index
+	server.FastForward(2 * time.Hour)
+	second, err := issuer.Issue(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected %v, got %v", ErrInvalidRefreshToken, err)
+	}
+
+	refreshed, err := issuer.Refresh(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Issue(ctx, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range server.Keys() {
+		if !strings.HasPrefix(key, "refresh:token:") && !strings.Contains(key, "{1}") {
+			t.Errorf("expected %s to carry the user's hash tag", key)
+		}
+	}
+
+	if err := issuer.RevokeAllForUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected %v, got %v", ErrInvalidRefreshToken, err)
+	}
+}
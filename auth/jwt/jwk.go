@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrUnsupportedJWK = errors.New("unsupported JWK")
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Use       string `json:"use,omitempty"`
+
+	// OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Public JWK of key. Symmetric keys can not be published.
+func NewJWK(kid string, key Key) (JWK, error) {
+	switch k := key.(type) {
+	case *edDSAKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     kid,
+			Algorithm: EdDSA,
+			Use:       "sig",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(k.public),
+		}, nil
+	case *rsaKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     kid,
+			Algorithm: RS256,
+			Use:       "sig",
+			N:         base64.RawURLEncoding.EncodeToString(k.public.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.public.E)).Bytes()),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("%w: %s keys can not be published", ErrUnsupportedJWK, key.Algorithm())
+	}
+}
+
+// Verify-only key from a public JWK
+func (j *JWK) Key() (Key, error) {
+	switch {
+	case j.KeyType == "OKP" && j.Curve == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 public key", ErrUnsupportedJWK)
+		}
+		return NewEdDSAPublicKey(ed25519.PublicKey(x)), nil
+	case j.KeyType == "RSA" && (j.Algorithm == "" || j.Algorithm == RS256):
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid RSA modulus", ErrUnsupportedJWK)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid RSA exponent", ErrUnsupportedJWK)
+		}
+		return NewRS256PublicKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}), nil
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedJWK, j.KeyType)
+	}
+}
@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJWK_RoundTrip(t *testing.T) {
+	for alg, key := range testKeys(t) {
+		t.Run(alg, func(t *testing.T) {
+			jwk, err := NewJWK("kid", key)
+			if alg == HS256 {
+				if !errors.Is(err, ErrUnsupportedJWK) {
+					t.Errorf("expected symmetric keys not to be published, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Published as JSON and parsed back by a verifier
+			data, err := json.Marshal(jwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var published JWK
+			if err := json.Unmarshal(data, &published); err != nil {
+				t.Fatal(err)
+			}
+
+			public, err := published.Key()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if public.Algorithm() != alg {
+				t.Errorf("expected %s, got %s", alg, public.Algorithm())
+			}
+
+			token, err := Sign(validClaims(), key, "kid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Parse(token, keyFunc(public)); err != nil {
+				t.Errorf("expected the public key to verify, got %v", err)
+			}
+
+			if _, err := public.Sign([]byte("data")); !errors.Is(err, ErrVerifyOnlyKey) {
+				t.Errorf("expected %v, got %v", ErrVerifyOnlyKey, err)
+			}
+		})
+	}
+}
+
+func TestJWK_Invalid(t *testing.T) {
+	tests := []JWK{
+		{KeyType: "oct"},
+		{KeyType: "OKP", Curve: "X25519", X: "AAAA"},
+		{KeyType: "OKP", Curve: "Ed25519", X: "AAAA"},
+		{KeyType: "RSA", Algorithm: "RS512", N: "AQAB", E: "AQAB"},
+		{KeyType: "RSA", N: "!!!", E: "AQAB"},
+	}
+
+	for _, jwk := range tests {
+		if _, err := jwk.Key(); !errors.Is(err, ErrUnsupportedJWK) {
+			t.Errorf("%+v: expected %v, got %v", jwk, ErrUnsupportedJWK, err)
+		}
+	}
+}
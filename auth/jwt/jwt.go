@@ -0,0 +1,218 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedToken    = errors.New("malformed token")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match key")
+	ErrTokenExpired      = errors.New("token is expired")
+	ErrMissingExpiration = errors.New("token has no expiration")
+	ErrTokenNotValidYet  = errors.New("token is not valid yet")
+)
+
+// Tolerated clock skew when validating exp and nbf
+const leeway = 30 * time.Second
+
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Accepts both the single string and array forms of the aud claim
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Registered claims, any other claim ends up in Extra
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+
+	Extra map[string]any `json:"-"`
+}
+
+type registeredClaims Claims
+
+func (c Claims) MarshalJSON() ([]byte, error) {
+	registered, err := json.Marshal(registeredClaims(c))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]any, len(c.Extra)+7)
+	for k, v := range c.Extra {
+		claims[k] = v
+	}
+
+	if err := json.Unmarshal(registered, &claims); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(claims)
+}
+
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*registeredClaims)(c)); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var claims map[string]any
+	if err := decoder.Decode(&claims); err != nil {
+		return err
+	}
+
+	for _, registered := range []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"} {
+		delete(claims, registered)
+	}
+
+	if len(claims) > 0 {
+		c.Extra = claims
+	}
+
+	return nil
+}
+
+func (c *Claims) ExpiresAtTime() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+func (c *Claims) IssuedAtTime() time.Time {
+	return time.Unix(c.IssuedAt, 0)
+}
+
+// Subject of tokens issued by Issuer is the user ID
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// Signs claims with key, setting kid in the header if not empty
+func Sign(claims *Claims, key Key, kid string) (string, error) {
+	header, err := json.Marshal(&Header{Algorithm: key.Algorithm(), Type: "JWT", KeyID: kid})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+
+	signature, err := key.Sign([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Returns the key used to verify a token with the given header
+type KeyFunc func(header *Header) (Key, error)
+
+// Verifies the signature and time based claims of token. Issuer and audience are left to the caller.
+// Tokens without exp are rejected, they would otherwise be valid forever.
+func Parse(token string, keyFunc KeyFunc) (*Claims, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header Header
+	if err := decodeSegment(segments[0], &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	key, err := keyFunc(&header)
+	if err != nil {
+		return nil, err
+	}
+
+	// Never let the token choose the algorithm, e.g. "none" or HS256 with a public key as secret
+	if header.Algorithm != key.Algorithm() {
+		return nil, ErrAlgorithmMismatch
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if err := key.Verify([]byte(segments[0]+"."+segments[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(segments[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	now := time.Now()
+
+	if claims.ExpiresAt == 0 {
+		return nil, ErrMissingExpiration
+	}
+
+	if now.After(claims.ExpiresAtTime().Add(leeway)) {
+		return nil, ErrTokenExpired
+	}
+
+	if claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrTokenNotValidYet
+	}
+
+	return &claims, nil
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,165 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeys(t *testing.T) map[string]Key {
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]Key{
+		HS256: NewHS256Key([]byte("secret")),
+		EdDSA: NewEdDSAKey(edPrivate),
+		RS256: NewRS256Key(rsaPrivate),
+	}
+}
+
+func keyFunc(key Key) KeyFunc {
+	return func(header *Header) (Key, error) { return key, nil }
+}
+
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{Subject: "1", IssuedAt: now.Unix(), NotBefore: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix(), Extra: map[string]any{"role": "admin"}}
+}
+
+func TestSignParse(t *testing.T) {
+	for alg, key := range testKeys(t) {
+		t.Run(alg, func(t *testing.T) {
+			token, err := Sign(validClaims(), key, "kid")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var header Header
+			if err := decodeSegment(strings.Split(token, ".")[0], &header); err != nil || header.Algorithm != alg || header.KeyID != "kid" {
+				t.Errorf("unexpected header %+v, %v", header, err)
+			}
+
+			claims, err := Parse(token, keyFunc(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "1" || claims.Extra["role"] != "admin" {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestParse_TamperedToken(t *testing.T) {
+	for alg, key := range testKeys(t) {
+		t.Run(alg, func(t *testing.T) {
+			token, err := Sign(validClaims(), key, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			segments := strings.Split(token, ".")
+
+			elevated := validClaims()
+			elevated.Subject = "2"
+			payload, _ := json.Marshal(elevated)
+
+			tampered := map[string]string{
+				"Payload":   segments[0] + "." + encodeSegment(payload) + "." + segments[2],
+				"Signature": segments[0] + "." + segments[1] + "." + encodeSegment([]byte("forged")),
+				"Stripped":  segments[0] + "." + segments[1] + ".",
+			}
+
+			for name, token := range tampered {
+				if _, err := Parse(token, keyFunc(key)); !errors.Is(err, ErrInvalidSignature) {
+					t.Errorf("%s: expected %v, got %v", name, ErrInvalidSignature, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_AlgorithmConfusion(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := NewRS256PublicKey(&rsaPrivate.PublicKey)
+
+	// The public key is public, an attacker can use it as an HMAC secret
+	der, err := x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	forged, err := Sign(validClaims(), NewHS256Key(pemKey), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(forged, keyFunc(public)); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("expected %v, got %v", ErrAlgorithmMismatch, err)
+	}
+
+	payload, _ := json.Marshal(validClaims())
+	unsigned := encodeSegment([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + encodeSegment(payload) + "."
+	if _, err := Parse(unsigned, keyFunc(public)); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("expected %v, got %v", ErrAlgorithmMismatch, err)
+	}
+}
+
+func TestParse_TimeClaims(t *testing.T) {
+	key := NewHS256Key([]byte("secret"))
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(claims *Claims)
+		err    error
+	}{
+		{name: "Expired within leeway", modify: func(c *Claims) { c.ExpiresAt = now.Add(-leeway / 2).Unix() }},
+		{name: "Expired", modify: func(c *Claims) { c.ExpiresAt = now.Add(-2 * leeway).Unix() }, err: ErrTokenExpired},
+		{name: "Missing exp", modify: func(c *Claims) { c.ExpiresAt = 0 }, err: ErrMissingExpiration},
+		{name: "Not valid yet within leeway", modify: func(c *Claims) { c.NotBefore = now.Add(leeway / 2).Unix() }},
+		{name: "Not valid yet", modify: func(c *Claims) { c.NotBefore = now.Add(2 * leeway).Unix() }, err: ErrTokenNotValidYet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+
+			token, err := Sign(claims, key, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Parse(token, keyFunc(key)); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestParse_Malformed(t *testing.T) {
+	key := NewHS256Key([]byte("secret"))
+
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!!!.e30.", encodeSegment([]byte(`{"alg":"HS256"}`)) + ".!!!.sig"} {
+		if _, err := Parse(token, keyFunc(key)); !errors.Is(err, ErrMalformedToken) && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%q: expected the token to be rejected as malformed, got %v", token, err)
+		}
+	}
+}
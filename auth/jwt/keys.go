@@ -0,0 +1,159 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrVerifyOnlyKey    = errors.New("key can only verify signatures")
+)
+
+// Signs and verifies tokens for a single algorithm. Public-key variants can only verify.
+type Key interface {
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+	Verify(data, signature []byte) error
+}
+
+type hmacKey struct {
+	secret []byte
+}
+
+func NewHS256Key(secret []byte) Key {
+	return &hmacKey{secret: secret}
+}
+
+func (k *hmacKey) Algorithm() string {
+	return HS256
+}
+
+func (k *hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k *hmacKey) Verify(data, signature []byte) error {
+	expected, _ := k.Sign(data)
+	if !hmac.Equal(expected, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type edDSAKey struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func NewEdDSAKey(private ed25519.PrivateKey) Key {
+	return &edDSAKey{private: private, public: private.Public().(ed25519.PublicKey)}
+}
+
+func NewEdDSAPublicKey(public ed25519.PublicKey) Key {
+	return &edDSAKey{public: public}
+}
+
+func (k *edDSAKey) Algorithm() string {
+	return EdDSA
+}
+
+func (k *edDSAKey) Sign(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, ErrVerifyOnlyKey
+	}
+	return ed25519.Sign(k.private, data), nil
+}
+
+func (k *edDSAKey) Verify(data, signature []byte) error {
+	if !ed25519.Verify(k.public, data, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type rsaKey struct {
+	private *rsa.PrivateKey
+	public  *rsa.PublicKey
+}
+
+func NewRS256Key(private *rsa.PrivateKey) Key {
+	return &rsaKey{private: private, public: &private.PublicKey}
+}
+
+func NewRS256PublicKey(public *rsa.PublicKey) Key {
+	return &rsaKey{public: public}
+}
+
+func (k *rsaKey) Algorithm() string {
+	return RS256
+}
+
+func (k *rsaKey) Sign(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, ErrVerifyOnlyKey
+	}
+	digest := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, digest[:])
+}
+
+func (k *rsaKey) Verify(data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Loads a PKCS#8 PEM encoded Ed25519 or RSA private key
+func LoadPrivateKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		return NewEdDSAKey(private), nil
+	case *rsa.PrivateKey:
+		return NewRS256Key(private), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+func newKeyID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,333 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+
+	"go.uber.org/zap"
+)
+
+var ErrUnknownKey = errors.New("unknown or expired signing key")
+
+// Provides the key new tokens are signed with, and the keys tokens are verified with
+type KeySource interface {
+	SigningKey() (string, Key)
+	VerificationKey(kid string) (Key, error)
+}
+
+type staticKeySource struct {
+	key Key
+}
+
+// Single key without a kid, e.g. an HS256 secret
+func NewStaticKeySource(key Key) KeySource {
+	return &staticKeySource{key: key}
+}
+
+func (s *staticKeySource) SigningKey() (string, Key) {
+	return "", s.key
+}
+
+func (s *staticKeySource) VerificationKey(kid string) (Key, error) {
+	return s.key, nil
+}
+
+type SigningKey struct {
+	ID         string    `json:"kid"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey []byte    `json:"private_key"` // PKCS#8 DER
+	CreatedAt  time.Time `json:"created_at"`
+	// Set once the key is rotated out. Retired keys no longer sign but keep verifying until they expire.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	key Key
+}
+
+func (k *SigningKey) expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+func (k *SigningKey) parse() error {
+	parsed, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse signing key %s: %w", k.ID, err)
+	}
+
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		k.key = NewEdDSAKey(private)
+	case *rsa.PrivateKey:
+		k.key = NewRS256Key(private)
+	default:
+		return fmt.Errorf("unsupported signing key type %T", parsed)
+	}
+
+	return nil
+}
+
+// First key is the active one, followed by retired keys. Version is incremented by every save, see KeyStore.
+type KeySet struct {
+	Version int64         `json:"version"`
+	Keys    []*SigningKey `json:"keys"`
+}
+
+// Manages a rotating set of asymmetric signing keys, persisted in a KeyStore and published as a JWKS.
+type KeyManager struct {
+	mu         sync.RWMutex
+	set        *KeySet
+	store      KeyStore
+	reloadedAt time.Time
+
+	algorithm   string
+	rotateEvery time.Duration
+	retention   time.Duration
+}
+
+// Loads the key set from store, creating it if needed. If cfg.KeyRotationInterval is set, keys are rotated in the background.
+func NewKeyManager(ctx context.Context, store KeyStore, cfg *config.JWTConfig) (*KeyManager, error) {
+	if cfg.Algorithm != EdDSA && cfg.Algorithm != RS256 {
+		return nil, fmt.Errorf("key rotation requires EdDSA or RS256, got %s", cfg.Algorithm)
+	}
+
+	m := &KeyManager{
+		store:       store,
+		algorithm:   cfg.Algorithm,
+		rotateEvery: cfg.KeyRotationInterval,
+		// Retired keys must outlive every access token they signed
+		retention: cfg.AccessTokenTTL + leeway,
+	}
+
+	set, err := store.Load(ctx)
+	if errors.Is(err, ErrKeySetNotFound) {
+		set = &KeySet{}
+	} else if err != nil {
+		return nil, err
+	}
+	m.set = set
+
+	// Another instance starting at the same time may create the set first, it is then adopted
+	if len(set.Keys) == 0 {
+		if err := m.Rotate(ctx); err != nil && !errors.Is(err, ErrKeySetConflict) {
+			return nil, err
+		}
+	}
+
+	if m.rotateEvery > 0 {
+		go m.rotateLoop()
+	}
+
+	return m, nil
+}
+
+func (m *KeyManager) SigningKey() (string, Key) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	active := m.set.Keys[0]
+	return active.ID, active.key
+}
+
+// Any key in the set that has not expired is accepted. An unknown kid reloads the set, at most every reloadInterval,
+// so tokens signed with a key another instance just rotated in verify right away.
+func (m *KeyManager) VerificationKey(kid string) (Key, error) {
+	if key := m.verificationKey(kid); key != nil {
+		return key, nil
+	}
+
+	if m.reloadDue() {
+		if err := m.reload(context.Background()); err != nil {
+			zap.L().Error("Error reloading signing keys", zap.Error(err))
+		} else if key := m.verificationKey(kid); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (m *KeyManager) verificationKey(kid string) Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+
+	for _, key := range m.set.Keys {
+		if key.ID == kid && !key.expired(now) {
+			return key.key
+		}
+	}
+
+	return nil
+}
+
+// Generates a new active key, retiring the current one and dropping expired keys.
+// If another instance saved the set meanwhile, that set is adopted instead and ErrKeySetConflict is returned.
+func (m *KeyManager) Rotate(ctx context.Context) error {
+	m.mu.RLock()
+	base := m.set
+	m.mu.RUnlock()
+
+	return m.rotate(ctx, base)
+}
+
+func (m *KeyManager) rotate(ctx context.Context, base *KeySet) error {
+	key, err := m.generate()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	set := &KeySet{Version: base.Version + 1, Keys: []*SigningKey{key}}
+
+	for i, old := range base.Keys {
+		retired := *old
+		if i == 0 && retired.ExpiresAt.IsZero() {
+			retired.ExpiresAt = now.Add(m.retention)
+		}
+		if !retired.expired(now) {
+			set.Keys = append(set.Keys, &retired)
+		}
+	}
+
+	if err := m.store.Save(ctx, set); errors.Is(err, ErrKeySetConflict) {
+		if err := m.reload(ctx); err != nil {
+			return err
+		}
+		return ErrKeySetConflict
+	} else if err != nil {
+		return err
+	}
+
+	m.adopt(set)
+
+	return nil
+}
+
+// Replaces the set with the stored one
+func (m *KeyManager) reload(ctx context.Context) error {
+	set, err := m.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.adopt(set)
+
+	return nil
+}
+
+// Older sets, e.g. from a load that raced a rotation, never replace newer ones
+func (m *KeyManager) adopt(set *KeySet) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(set.Keys) > 0 && (len(m.set.Keys) == 0 || set.Version >= m.set.Version) {
+		m.set = set
+	}
+}
+
+// Minimum time between reloads caused by unknown kids
+const reloadInterval = 5 * time.Second
+
+func (m *KeyManager) reloadDue() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.reloadedAt) < reloadInterval {
+		return false
+	}
+
+	m.reloadedAt = time.Now()
+	return true
+}
+
+func (m *KeyManager) JWKS() *JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jwks := &JWKS{Keys: make([]JWK, 0, len(m.set.Keys))}
+	now := time.Now()
+
+	for _, key := range m.set.Keys {
+		if key.expired(now) {
+			continue
+		}
+
+		jwk, err := NewJWK(key.ID, key.key)
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+func (m *KeyManager) generate() (*SigningKey, error) {
+	var private any
+	var err error
+
+	switch m.algorithm {
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+
+	id, err := newKeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: id, Algorithm: m.algorithm, PrivateKey: der, CreatedAt: time.Now()}
+	if err := key.parse(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Reloads the key set so rotations made by other instances are picked up, and rotates once the active key is due.
+// When several instances rotate at once, only the first save wins and the others adopt its set.
+func (m *KeyManager) rotateLoop() {
+	for range time.Tick(min(m.rotateEvery, time.Minute)) {
+		ctx := context.Background()
+
+		if err := m.reload(ctx); err != nil {
+			zap.L().Error("Error reloading signing keys", zap.Error(err))
+			continue
+		}
+
+		m.mu.RLock()
+		set := m.set
+		m.mu.RUnlock()
+
+		if time.Since(set.Keys[0].CreatedAt) < m.rotateEvery {
+			continue
+		}
+
+		if err := m.rotate(ctx, set); errors.Is(err, ErrKeySetConflict) {
+			zap.L().Info("Signing keys were rotated by another instance")
+		} else if err != nil {
+			zap.L().Error("Error rotating signing keys", zap.Error(err))
+		} else {
+			zap.L().Info("Rotated signing keys")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+	"github.com/jose-lico/go-plate/database/redistest"
+)
+
+func newTestKeyManager(t *testing.T, store KeyStore) *KeyManager {
+	manager, err := NewKeyManager(context.Background(), store, &config.JWTConfig{Algorithm: EdDSA, AccessTokenTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func signWith(t *testing.T, source KeySource) string {
+	kid, key := source.SigningKey()
+
+	token, err := Sign(validClaims(), key, kid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func verifyWith(source KeySource, token string) error {
+	_, err := Parse(token, func(header *Header) (Key, error) {
+		return source.VerificationKey(header.KeyID)
+	})
+	return err
+}
+
+func TestNewKeyManager(t *testing.T) {
+	if _, err := NewKeyManager(context.Background(), nil, &config.JWTConfig{Algorithm: HS256}); err == nil {
+		t.Error("expected HS256 to be rejected")
+	}
+
+	redis, _ := redistest.New(t)
+	store := NewRedisKeyStore(redis, "jwt:keyset")
+
+	first := newTestKeyManager(t, store)
+	second := newTestKeyManager(t, store)
+
+	firstKid, _ := first.SigningKey()
+	secondKid, _ := second.SigningKey()
+	if firstKid != secondKid {
+		t.Errorf("expected instances to share the stored key, got %s and %s", firstKid, secondKid)
+	}
+}
+
+func TestKeyManager_Rotate(t *testing.T) {
+	redis, _ := redistest.New(t)
+	store := NewRedisKeyStore(redis, "jwt:keyset")
+	manager := newTestKeyManager(t, store)
+	ctx := context.Background()
+
+	before := signWith(t, manager)
+	oldKid, _ := manager.SigningKey()
+
+	if err := manager.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	newKid, _ := manager.SigningKey()
+	if newKid == oldKid {
+		t.Fatal("expected a new active key")
+	}
+
+	// The retired key keeps verifying tokens it signed
+	if err := verifyWith(manager, before); err != nil {
+		t.Errorf("expected tokens of the retired key to verify, got %v", err)
+	}
+	if err := verifyWith(manager, signWith(t, manager)); err != nil {
+		t.Errorf("expected tokens of the new key to verify, got %v", err)
+	}
+
+	if keys := manager.JWKS().Keys; len(keys) != 2 || keys[0].KeyID != newKid || keys[1].KeyID != oldKid {
+		t.Errorf("expected both keys published, active first, got %+v", keys)
+	}
+
+	// Once its retention has passed the retired key is gone
+	retired := *manager.set.Keys[1]
+	retired.ExpiresAt = time.Now().Add(-time.Second)
+	expired := &KeySet{Version: manager.set.Version + 1, Keys: []*SigningKey{manager.set.Keys[0], &retired}}
+	if err := store.Save(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyWith(manager, before); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected %v, got %v", ErrUnknownKey, err)
+	}
+	if keys := manager.JWKS().Keys; len(keys) != 1 {
+		t.Errorf("expected expired keys not to be published, got %+v", keys)
+	}
+
+	if err := manager.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(manager.set.Keys) != 2 {
+		t.Errorf("expected expired keys to be dropped on rotation, got %d keys", len(manager.set.Keys))
+	}
+}
+
+// Replicas rotating the same set must not overwrite each other's active key
+func TestKeyManager_RotateConflict(t *testing.T) {
+	redis, _ := redistest.New(t)
+	store := NewRedisKeyStore(redis, "jwt:keyset")
+	ctx := context.Background()
+
+	first := newTestKeyManager(t, store)
+	second := newTestKeyManager(t, store)
+
+	if err := first.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Rotate(ctx); !errors.Is(err, ErrKeySetConflict) {
+		t.Fatalf("expected %v, got %v", ErrKeySetConflict, err)
+	}
+
+	firstKid, _ := first.SigningKey()
+	secondKid, _ := second.SigningKey()
+	if firstKid != secondKid {
+		t.Errorf("expected the losing instance to adopt the stored key, got %s and %s", secondKid, firstKid)
+	}
+
+	stored, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != 2 || stored.Keys[0].ID != firstKid {
+		t.Errorf("expected the first rotation to be kept, got version %d with key %s", stored.Version, stored.Keys[0].ID)
+	}
+}
+
+// Tokens signed by a key another instance just rotated in verify before the next background reload
+func TestKeyManager_VerifyReloadsUnknownKey(t *testing.T) {
+	redis, _ := redistest.New(t)
+	store := NewRedisKeyStore(redis, "jwt:keyset")
+
+	first := newTestKeyManager(t, store)
+	second := newTestKeyManager(t, store)
+
+	if err := first.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	token := signWith(t, first)
+	if err := verifyWith(second, token); err != nil {
+		t.Errorf("expected the rotated key to be picked up, got %v", err)
+	}
+
+	// Unknown kids don't reload the set again right away
+	forged, err := Sign(validClaims(), newTestSigningKey(t).key, "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadedAt := second.reloadedAt
+	if err := verifyWith(second, forged); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected %v, got %v", ErrUnknownKey, err)
+	}
+	if second.reloadedAt != reloadedAt {
+		t.Error("expected reloads to be throttled")
+	}
+}
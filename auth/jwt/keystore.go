@@ -0,0 +1,195 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jose-lico/go-plate/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrKeySetNotFound = errors.New("key set not found")
+	ErrKeySetConflict = errors.New("key set was changed by another instance")
+)
+
+// Persists the KeySet, including private keys, so every instance signs and verifies with the same keys.
+// Load returns ErrKeySetNotFound if nothing has been saved yet.
+// Save is a compare-and-swap: it only stores set if the stored version is set.Version-1 (0 if nothing is stored),
+// returning ErrKeySetConflict otherwise, so concurrent rotations by several instances never overwrite each other.
+type KeyStore interface {
+	Load(ctx context.Context) (*KeySet, error)
+	Save(ctx context.Context, set *KeySet) error
+}
+
+type FileKeyStore struct {
+	path string
+}
+
+func NewFileKeyStore(path string) KeyStore {
+	return &FileKeyStore{path: path}
+}
+
+func (s *FileKeyStore) Load(ctx context.Context) (*KeySet, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrKeySetNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read key set: %w", err)
+	}
+
+	return unmarshalKeySet(data)
+}
+
+func (s *FileKeyStore) Save(ctx context.Context, set *KeySet) error {
+	data, err := json.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key set: %w", err)
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var version int64
+	if current, err := s.Load(ctx); err == nil {
+		version = current.Version
+	} else if !errors.Is(err, ErrKeySetNotFound) {
+		return err
+	}
+	if version != set.Version-1 {
+		return ErrKeySetConflict
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated key set behind
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write key set: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key set: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key set: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write key set: %w", err)
+	}
+
+	return nil
+}
+
+// Lock files older than this were left behind by a crashed process
+const staleLock = 30 * time.Second
+
+// Takes a lock file next to the key set, shared by every process saving to it
+func (s *FileKeyStore) lock(ctx context.Context) (func(), error) {
+	path := s.path + ".lock"
+
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock key set: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to lock key set: %w", ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+type RedisKeyStore struct {
+	redis database.RedisStore
+	key   string
+}
+
+func NewRedisKeyStore(redis database.RedisStore, key string) KeyStore {
+	return &RedisKeyStore{redis: redis, key: key}
+}
+
+func (s *RedisKeyStore) Load(ctx context.Context) (*KeySet, error) {
+	data, err := s.redis.Get(ctx, s.key)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeySetNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read key set: %w", err)
+	}
+
+	return unmarshalKeySet([]byte(data))
+}
+
+func (s *RedisKeyStore) Save(ctx context.Context, set *KeySet) error {
+	data, err := json.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key set: %w", err)
+	}
+
+	client := s.redis.GetNativeInstance().(*redis.Client)
+
+	saved, err := saveKeySetScript.Run(ctx, client, []string{s.key}, data, set.Version).Int()
+	if err != nil {
+		return fmt.Errorf("failed to store key set: %w", err)
+	}
+	if saved == 0 {
+		return ErrKeySetConflict
+	}
+
+	return nil
+}
+
+func unmarshalKeySet(data []byte) (*KeySet, error) {
+	var set KeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key set: %w", err)
+	}
+
+	for _, key := range set.Keys {
+		if err := key.parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &set, nil
+}
+
+var saveKeySetScript = redis.NewScript(luaSaveKeySet)
+
+var luaSaveKeySet = `
+local current = redis.call("GET", KEYS[1])
+local version = 0
+if current then
+    version = cjson.decode(current).version or 0
+end
+
+if version ~= tonumber(ARGV[2]) - 1 then
+    return 0
+end
+
+redis.call("SET", KEYS[1], ARGV[1])
+
+return 1
+`
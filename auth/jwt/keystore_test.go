@@ -0,0 +1,126 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jose-lico/go-plate/database/redistest"
+)
+
+func forEachKeyStore(t *testing.T, test func(t *testing.T, store KeyStore)) {
+	redis, _ := redistest.New(t)
+
+	stores := map[string]KeyStore{
+		"FileKeyStore":  NewFileKeyStore(filepath.Join(t.TempDir(), "keyset.json")),
+		"RedisKeyStore": NewRedisKeyStore(redis, "jwt:keyset"),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			test(t, store)
+		})
+	}
+}
+
+func newTestSigningKey(t *testing.T) *SigningKey {
+	key, err := (&KeyManager{algorithm: EdDSA}).generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKeyStore_SaveLoad(t *testing.T) {
+	forEachKeyStore(t, func(t *testing.T, store KeyStore) {
+		ctx := context.Background()
+
+		if _, err := store.Load(ctx); !errors.Is(err, ErrKeySetNotFound) {
+			t.Errorf("expected %v, got %v", ErrKeySetNotFound, err)
+		}
+
+		key := newTestSigningKey(t)
+		if err := store.Save(ctx, &KeySet{Version: 1, Keys: []*SigningKey{key}}); err != nil {
+			t.Fatal(err)
+		}
+
+		set, err := store.Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set.Version != 1 || len(set.Keys) != 1 || set.Keys[0].ID != key.ID {
+			t.Fatalf("unexpected key set %+v", set)
+		}
+
+		// Loaded keys must be usable, not just their DER
+		token, err := Sign(validClaims(), set.Keys[0].key, key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Parse(token, keyFunc(key.key)); err != nil {
+			t.Errorf("expected the loaded key to match the saved one, got %v", err)
+		}
+	})
+}
+
+func TestKeyStore_SaveConflict(t *testing.T) {
+	forEachKeyStore(t, func(t *testing.T, store KeyStore) {
+		ctx := context.Background()
+		key := newTestSigningKey(t)
+
+		if err := store.Save(ctx, &KeySet{Version: 2, Keys: []*SigningKey{key}}); !errors.Is(err, ErrKeySetConflict) {
+			t.Errorf("expected the first save to require version 1, got %v", err)
+		}
+
+		if err := store.Save(ctx, &KeySet{Version: 1, Keys: []*SigningKey{key}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// A second instance rotating from the same version loses
+		if err := store.Save(ctx, &KeySet{Version: 1, Keys: []*SigningKey{newTestSigningKey(t)}}); !errors.Is(err, ErrKeySetConflict) {
+			t.Errorf("expected %v, got %v", ErrKeySetConflict, err)
+		}
+
+		if set, err := store.Load(ctx); err != nil || set.Keys[0].ID != key.ID {
+			t.Errorf("expected the first save to be kept, got %+v, %v", set, err)
+		}
+	})
+}
+
+func TestKeyStore_ConcurrentSave(t *testing.T) {
+	forEachKeyStore(t, func(t *testing.T, store KeyStore) {
+		ctx := context.Background()
+
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			saved int
+		)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				err := store.Save(ctx, &KeySet{Version: 1, Keys: []*SigningKey{newTestSigningKey(t)}})
+				if err != nil {
+					if !errors.Is(err, ErrKeySetConflict) {
+						t.Error(err)
+					}
+					return
+				}
+
+				mu.Lock()
+				saved++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		if saved != 1 {
+			t.Errorf("expected exactly one save to succeed, got %d", saved)
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/config"
+)
+
+var (
+	ErrNoAuthRequest  = errors.New("no login in progress or it expired")
+	ErrStateMismatch  = errors.New("state does not match the login in progress")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// Error reported by the provider, either on the redirect back or by the token endpoint
+type ProviderError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *ProviderError) Error() string {
+	if e.Description == "" {
+		return "provider error: " + e.Code
+	}
+	return fmt.Sprintf("provider error: %s: %s", e.Code, e.Description)
+}
+
+// User as asserted by a validated ID token
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// State, nonce and PKCE verifier of a login in progress, kept in a cookie between Begin and Callback
+type authRequest struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Relying party for the authorization code flow with PKCE
+type Client struct {
+	cfg      *config.OIDCConfig
+	http     *http.Client
+	provider *ProviderMetadata
+	keys     *RemoteKeySet
+}
+
+// Discovers the provider at cfg.IssuerURL. A nil httpClient uses one with cfg.HTTPTimeout.
+func NewClient(ctx context.Context, cfg *config.OIDCConfig, httpClient *http.Client) (*Client, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc requires an issuer url, client id and redirect url")
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: cfg.HTTPTimeout}
+	}
+
+	provider, err := Discover(ctx, httpClient, cfg.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		cfg:      cfg,
+		http:     httpClient,
+		provider: provider,
+		keys:     NewRemoteKeySet(provider.JWKSURI, httpClient),
+	}, nil
+}
+
+// Where users land after logging in
+func (c *Client) PostLoginURL() string {
+	return c.cfg.PostLoginURL
+}
+
+// Starts a login, redirecting the user agent to the provider
+func (c *Client) Begin(w http.ResponseWriter, r *http.Request) error {
+	var req authRequest
+	for _, value := range []*string{&req.State, &req.Nonce, &req.Verifier} {
+		token, err := auth.GenerateToken()
+		if err != nil {
+			return fmt.Errorf("failed to generate login state: %w", err)
+		}
+		*value = token
+	}
+
+	encoded, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+
+	c.setCookie(w, base64.RawURLEncoding.EncodeToString(encoded), int(c.cfg.StateTTL.Seconds()))
+
+	http.Redirect(w, r, c.AuthCodeURL(req.State, req.Nonce, req.Verifier), http.StatusFound)
+	return nil
+}
+
+func (c *Client) AuthCodeURL(state, nonce, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(c.provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return c.provider.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Completes the login started by Begin from the provider's redirect, returning the validated identity.
+// The login state is cleared whatever the outcome, so a callback can not be replayed.
+func (c *Client) Callback(w http.ResponseWriter, r *http.Request) (*Identity, error) {
+	cookie, err := r.Cookie(c.cfg.CookieName)
+	if err != nil {
+		return nil, ErrNoAuthRequest
+	}
+	c.setCookie(w, "", -1)
+
+	var req authRequest
+	if data, err := base64.RawURLEncoding.DecodeString(cookie.Value); err != nil || json.Unmarshal(data, &req) != nil {
+		return nil, ErrNoAuthRequest
+	}
+
+	query := r.URL.Query()
+
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(req.State)) != 1 {
+		return nil, ErrStateMismatch
+	}
+
+	if code := query.Get("error"); code != "" {
+		return nil, &ProviderError{Code: code, Description: query.Get("error_description")}
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		return nil, &ProviderError{Code: "invalid_request", Description: "missing authorization code"}
+	}
+
+	idToken, err := c.Exchange(r.Context(), code, req.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.VerifyIDToken(r.Context(), idToken, req.Nonce)
+}
+
+// Redeems an authorization code at the token endpoint, returning the raw ID token
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if c.cfg.ClientSecret == "" {
+		form.Set("client_id", c.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		providerErr := &ProviderError{}
+		if err := json.NewDecoder(resp.Body).Decode(providerErr); err != nil || providerErr.Code == "" {
+			return "", fmt.Errorf("failed to exchange code: unexpected status %d", resp.StatusCode)
+		}
+		return "", providerErr
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if token.IDToken == "" {
+		return "", fmt.Errorf("%w: missing from token response", ErrInvalidIDToken)
+	}
+
+	return token.IDToken, nil
+}
+
+// Validates the signature, issuer, audience, expiry and nonce of an ID token
+func (c *Client) VerifyIDToken(ctx context.Context, token, nonce string) (*Identity, error) {
+	claims, err := jwt.Parse(token, c.keys.KeyFunc(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Issuer != c.provider.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.Audience.Contains(c.cfg.ClientID):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && stringClaim(claims, "azp") != c.cfg.ClientID:
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	case claims.ExpiresAt == 0 || claims.IssuedAt == 0:
+		return nil, fmt.Errorf("%w: missing exp or iat", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(stringClaim(claims, "nonce")), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: boolClaim(claims, "email_verified"),
+		Name:          stringClaim(claims, "name"),
+	}, nil
+}
+
+func (c *Client) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	// Lax, the cookie has to be sent on the top level redirect back from the provider
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.cfg.CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func stringClaim(claims *jwt.Claims, name string) string {
+	value, _ := claims.Extra[name].(string)
+	return value
+}
+
+// Some providers send email_verified as a string
+func boolClaim(claims *jwt.Claims, name string) bool {
+	switch value := claims.Extra[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var ErrIssuerMismatch = errors.New("discovered issuer does not match the configured issuer")
+
+// Subset of the OpenID Provider Metadata used by Client
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint,omitempty"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Fetches the metadata published by issuer at /.well-known/openid-configuration
+func Discover(ctx context.Context, client *http.Client, issuer string) (*ProviderMetadata, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	var metadata ProviderMetadata
+	if err := getJSON(ctx, client, url, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to discover provider: %w", err)
+	}
+
+	// Tokens are validated against the configured issuer, a provider claiming to be another one can not be trusted
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("%w: %q", ErrIssuerMismatch, metadata.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("provider metadata is missing required endpoints")
+	}
+
+	return &metadata, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,94 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth/jwt"
+)
+
+// Unknown key IDs trigger a refetch of the JWKS, at most once per interval so forged kids can not be used to flood the provider
+const minRefreshInterval = time.Minute
+
+// Verification keys published by a provider, cached and refetched when the provider rotates its keys
+type RemoteKeySet struct {
+	uri    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]jwt.Key
+	fetchedAt time.Time
+}
+
+func NewRemoteKeySet(uri string, client *http.Client) *RemoteKeySet {
+	return &RemoteKeySet{uri: uri, client: client}
+}
+
+// KeyFunc for jwt.Parse
+func (s *RemoteKeySet) KeyFunc(ctx context.Context) jwt.KeyFunc {
+	return func(header *jwt.Header) (jwt.Key, error) {
+		return s.key(ctx, header.KeyID)
+	}
+}
+
+func (s *RemoteKeySet) key(ctx context.Context, kid string) (jwt.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(s.fetchedAt) >= minRefreshInterval {
+		if err := s.fetch(ctx); err != nil {
+			return nil, err
+		}
+
+		if key, ok := s.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %q", jwt.ErrUnsupportedJWK, kid)
+}
+
+// Tokens without a kid can only be matched when the provider publishes a single key
+func (s *RemoteKeySet) lookup(kid string) (jwt.Key, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *RemoteKeySet) fetch(ctx context.Context) error {
+	var jwks jwt.JWKS
+	if err := getJSON(ctx, s.client, s.uri, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]jwt.Key, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// Skip key types we do not support instead of failing, providers often publish several
+		key, err := jwk.Key()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	s.keys = keys
+	s.fetchedAt = time.Now()
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/auth/oidc"
+	"github.com/jose-lico/go-plate/auth/oidc/oidctest"
+	"github.com/jose-lico/go-plate/config"
+)
+
+func newClient(t *testing.T, provider *oidctest.Provider) *oidc.Client {
+	t.Helper()
+
+	client, err := oidc.NewClient(context.Background(), &config.OIDCConfig{
+		IssuerURL:    provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  "http://localhost/callback",
+		Scopes:       []string{"openid", "email"},
+		CookieName:   "oidc_auth",
+		StateTTL:     time.Minute,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+// Begins a login and follows it through the provider, returning the callback request carrying the login cookie
+func begin(t *testing.T, client *oidc.Client, provider *oidctest.Provider) *http.Request {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	if err := client.Begin(rr, httptest.NewRequest(http.MethodGet, "/login", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query := authURL.Query(); query.Get("code_challenge_method") != "S256" || query.Get("nonce") == "" || query.Get("state") == "" {
+		t.Fatalf("expected state, nonce and an S256 challenge in %s", authURL)
+	}
+
+	callbackURL, err := provider.Authorize(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, callbackURL.String(), nil)
+	for _, cookie := range rr.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+
+	return callback
+}
+
+func TestClient_Flow(t *testing.T) {
+	for _, secret := range []string{"client-secret", ""} {
+		provider := oidctest.NewProvider("go-plate", secret)
+		defer provider.Close()
+
+		client := newClient(t, provider)
+
+		provider.SetUser(oidctest.User{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+		callback := begin(t, client, provider)
+		rr := httptest.NewRecorder()
+		identity, err := client.Callback(rr, callback)
+		if err != nil {
+			t.Fatalf("expected login to succeed with secret %q, got %v", secret, err)
+		}
+
+		if identity.Issuer != provider.Issuer() || identity.Subject != "alice" || identity.Email != "alice@example.com" || !identity.EmailVerified {
+			t.Errorf("unexpected identity %+v", identity)
+		}
+
+		if cookies := rr.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+			t.Errorf("expected the login cookie to be cleared, got %v", cookies)
+		}
+
+		// The code is single use
+		if _, err := client.Callback(httptest.NewRecorder(), callback); err == nil {
+			t.Error("expected a replayed callback to fail")
+		}
+	}
+}
+
+func TestClient_Callback(t *testing.T) {
+	provider := oidctest.NewProvider("go-plate", "client-secret")
+	defer provider.Close()
+
+	client := newClient(t, provider)
+
+	tests := []struct {
+		name   string
+		tamper func(r *http.Request) *http.Request
+		target error
+	}{
+		{
+			name: "Missing cookie",
+			tamper: func(r *http.Request) *http.Request {
+				return httptest.NewRequest(http.MethodGet, r.URL.String(), nil)
+			},
+			target: oidc.ErrNoAuthRequest,
+		},
+		{
+			name: "Forged state",
+			tamper: func(r *http.Request) *http.Request {
+				query := r.URL.Query()
+				query.Set("state", "forged")
+				r.URL.RawQuery = query.Encode()
+				return r
+			},
+			target: oidc.ErrStateMismatch,
+		},
+		{
+			name: "Stolen code",
+			tamper: func(r *http.Request) *http.Request {
+				// A code intercepted from another login can not be redeemed without that login's verifier
+				other := begin(t, client, provider)
+				query := r.URL.Query()
+				query.Set("code", other.URL.Query().Get("code"))
+				r.URL.RawQuery = query.Encode()
+				return r
+			},
+			target: &oidc.ProviderError{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Callback(httptest.NewRecorder(), tt.tamper(begin(t, client, provider)))
+
+			var providerErr *oidc.ProviderError
+			if _, ok := tt.target.(*oidc.ProviderError); ok {
+				if !errors.As(err, &providerErr) || providerErr.Code != "invalid_grant" {
+					t.Errorf("expected invalid_grant, got %v", err)
+				}
+			} else if !errors.Is(err, tt.target) {
+				t.Errorf("expected %v, got %v", tt.target, err)
+			}
+		})
+	}
+
+	t.Run("Denied", func(t *testing.T) {
+		provider.Deny("access_denied")
+		defer provider.Deny("")
+
+		var providerErr *oidc.ProviderError
+		if _, err := client.Callback(httptest.NewRecorder(), begin(t, client, provider)); !errors.As(err, &providerErr) || providerErr.Code != "access_denied" {
+			t.Errorf("expected access_denied, got %v", err)
+		}
+	})
+}
+
+func TestClient_VerifyIDToken(t *testing.T) {
+	provider := oidctest.NewProvider("go-plate", "client-secret")
+	defer provider.Close()
+
+	client := newClient(t, provider)
+	now := time.Now()
+
+	valid := func() *jwt.Claims {
+		return &jwt.Claims{
+			Issuer:    provider.Issuer(),
+			Subject:   "alice",
+			Audience:  jwt.Audience{"go-plate"},
+			ExpiresAt: now.Add(time.Minute).Unix(),
+			IssuedAt:  now.Unix(),
+			Extra:     map[string]any{"nonce": "nonce", "email_verified": "true"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(claims *jwt.Claims)
+		valid  bool
+	}{
+		{name: "Valid", modify: func(claims *jwt.Claims) {}, valid: true},
+		{name: "Wrong issuer", modify: func(claims *jwt.Claims) { claims.Issuer = "https://evil.example.com" }},
+		{name: "Wrong audience", modify: func(claims *jwt.Claims) { claims.Audience = jwt.Audience{"other"} }},
+		{name: "Multiple audiences without azp", modify: func(claims *jwt.Claims) { claims.Audience = jwt.Audience{"go-plate", "other"} }},
+		{name: "Expired", modify: func(claims *jwt.Claims) { claims.ExpiresAt = now.Add(-time.Hour).Unix() }},
+		{name: "Missing exp", modify: func(claims *jwt.Claims) { claims.ExpiresAt = 0 }},
+		{name: "Wrong nonce", modify: func(claims *jwt.Claims) { claims.Extra["nonce"] = "replayed" }},
+		{name: "Missing subject", modify: func(claims *jwt.Claims) { claims.Subject = "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(claims)
+
+			token, err := provider.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := client.VerifyIDToken(context.Background(), token, "nonce")
+			if tt.valid {
+				if err != nil || !identity.EmailVerified {
+					t.Errorf("expected token to be valid with a verified email, got %+v, %v", identity, err)
+				}
+			} else if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("expected %v, got %v", oidc.ErrInvalidIDToken, err)
+			}
+		})
+	}
+
+	t.Run("Foreign key", func(t *testing.T) {
+		other := oidctest.NewProvider("go-plate", "client-secret")
+		defer other.Close()
+
+		token, err := other.Sign(valid())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := client.VerifyIDToken(context.Background(), token, "nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Errorf("expected a token signed by another key to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestDiscover_IssuerMismatch(t *testing.T) {
+	provider := oidctest.NewProvider("go-plate", "")
+	defer provider.Close()
+
+	// Reached through another host name than the 127.0.0.1 issuer it advertises
+	_, port, _ := strings.Cut(provider.Issuer(), "127.0.0.1:")
+	if _, err := oidc.Discover(context.Background(), http.DefaultClient, "http://localhost:"+port); !errors.Is(err, oidc.ErrIssuerMismatch) {
+		t.Errorf("expected %v, got %v", oidc.ErrIssuerMismatch, err)
+	}
+}
@@ -0,0 +1,279 @@
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+)
+
+const keyID = "oidctest"
+
+// User the provider signs in, auto-approving every authorization request
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type grant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	user        User
+	expiresAt   time.Time
+}
+
+// Mock OpenID provider for running the authorization code flow offline.
+// Serves discovery, JWKS, an authorization endpoint and a token endpoint that enforces PKCE and single use codes.
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	key jwt.Key
+
+	mu     sync.Mutex
+	user   User
+	codes  map[string]*grant
+	denied string
+}
+
+// Starts a provider accepting the given client. Close it when done.
+func NewProvider(clientID, clientSecret string) *Provider {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: failed to generate key: %v", err))
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          jwt.NewEdDSAKey(private),
+		user:         User{Subject: "1234567890", Email: "oidc@example.com", EmailVerified: true, Name: "OIDC User"},
+		codes:        make(map[string]*grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// Sets the user signed in by subsequent authorization requests
+func (p *Provider) SetUser(user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// Makes subsequent authorization requests fail with the given OAuth error code, e.g. "access_denied". Empty approves them again.
+func (p *Provider) Deny(code string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.denied = code
+}
+
+// Signs arbitrary claims with the provider's key, for tests crafting invalid ID tokens
+func (p *Provider) Sign(claims *jwt.Claims) (string, error) {
+	return jwt.Sign(claims, p.key, keyID)
+}
+
+// Follows authURL to the authorization endpoint like a user agent would, returning the callback URL it redirects to
+func (p *Provider) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("oidctest: authorization failed with status %d", resp.StatusCode)
+	}
+
+	return resp.Location()
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{p.key.Algorithm()},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	jwk, err := jwt.NewJWK(keyID, p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &jwt.JWKS{Keys: []jwt.JWK{jwk}})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() || query.Get("client_id") != p.ClientID {
+		http.Error(w, "invalid client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	callback := redirectURI.Query()
+	callback.Set("state", query.Get("state"))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.denied != "":
+		callback.Set("error", p.denied)
+	case query.Get("response_type") != "code":
+		callback.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		callback.Set("error", "invalid_request")
+		callback.Set("error_description", "PKCE with S256 is required")
+	default:
+		code, err := auth.GenerateToken()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		p.codes[code] = &grant{
+			redirectURI: redirectURI.String(),
+			challenge:   query.Get("code_challenge"),
+			nonce:       query.Get("nonce"),
+			user:        p.user,
+			expiresAt:   time.Now().Add(time.Minute),
+		}
+		callback.Set("code", code)
+	}
+
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	if !p.authenticateClient(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(g.challenge)) != 1 {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.Sign(&jwt.Claims{
+		Issuer:    p.Issuer(),
+		Subject:   g.user.Subject,
+		Audience:  jwt.Audience{p.ClientID},
+		ExpiresAt: now.Add(5 * time.Minute).Unix(),
+		IssuedAt:  now.Unix(),
+		Extra: map[string]any{
+			"nonce":          g.nonce,
+			"email":          g.user.Email,
+			"email_verified": g.user.EmailVerified,
+			"name":           g.user.Name,
+		},
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	accessToken, err := auth.GenerateToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// Confidential clients authenticate with basic auth, public clients only send their client_id
+func (p *Provider) authenticateClient(r *http.Request) bool {
+	if p.ClientSecret == "" {
+		return r.PostForm.Get("client_id") == p.ClientID
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+
+	return id == p.ClientID && subtle.ConstantTimeCompare([]byte(secret), []byte(p.ClientSecret)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
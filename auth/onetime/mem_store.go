@@ -0,0 +1,103 @@
+package onetime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type memToken struct {
+	userID  int
+	expires time.Time
+}
+
+type memUserKey struct {
+	purpose Purpose
+	userID  int
+}
+
+type InMemoryTokenStore struct {
+	mu           sync.Mutex
+	tokens       map[Purpose]map[string]*memToken
+	users        map[memUserKey]string
+	cleanupEvery time.Duration
+}
+
+func NewInMemoryTokenStore(cleanupInterval time.Duration) TokenStore {
+	if cleanupInterval <= 0 {
+		zap.L().Fatal("Invalid parameters for InMemoryTokenStore")
+	}
+
+	s := &InMemoryTokenStore{
+		tokens:       make(map[Purpose]map[string]*memToken),
+		users:        make(map[memUserKey]string),
+		cleanupEvery: cleanupInterval,
+	}
+
+	go s.cleanup()
+	return s
+}
+
+func (s *InMemoryTokenStore) Save(ctx context.Context, purpose Purpose, hash string, userID int, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[purpose]; !exists {
+		s.tokens[purpose] = make(map[string]*memToken)
+	}
+
+	key := memUserKey{purpose: purpose, userID: userID}
+	if previous, exists := s.users[key]; exists {
+		delete(s.tokens[purpose], previous)
+	}
+
+	s.tokens[purpose][hash] = &memToken{userID: userID, expires: time.Now().Add(ttl)}
+	s.users[key] = hash
+
+	return nil
+}
+
+func (s *InMemoryTokenStore) Get(ctx context.Context, purpose Purpose, hash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[purpose][hash]
+	if !exists || time.Now().After(token.expires) {
+		return 0, ErrInvalidToken
+	}
+
+	return token.userID, nil
+}
+
+func (s *InMemoryTokenStore) Take(ctx context.Context, purpose Purpose, hash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[purpose][hash]
+	if !exists || time.Now().After(token.expires) {
+		return 0, ErrInvalidToken
+	}
+
+	delete(s.tokens[purpose], hash)
+	delete(s.users, memUserKey{purpose: purpose, userID: token.userID})
+
+	return token.userID, nil
+}
+
+func (s *InMemoryTokenStore) cleanup() {
+	for range time.Tick(s.cleanupEvery) {
+		s.mu.Lock()
+		now := time.Now()
+		for purpose, tokens := range s.tokens {
+			for hash, token := range tokens {
+				if now.After(token.expires) {
+					delete(tokens, hash)
+					delete(s.users, memUserKey{purpose: purpose, userID: token.userID})
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,76 @@
+package onetime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/config"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+)
+
+// Tokens are only valid for the purpose they were issued for
+type Purpose string
+
+const (
+	PasswordReset     Purpose = "password_reset"
+	EmailVerification Purpose = "email_verification"
+)
+
+// TokenService issues single use, expiring tokens bound to a purpose and a user, e.g. for password reset links.
+// Only a hash of each token is stored, and issuing a new token invalidates the user's previous one for the same purpose.
+type TokenService struct {
+	store TokenStore
+	cfg   *config.OneTimeTokenConfig
+}
+
+func NewTokenService(store TokenStore, cfg *config.OneTimeTokenConfig) *TokenService {
+	return &TokenService{store: store, cfg: cfg}
+}
+
+func (s *TokenService) Issue(ctx context.Context, purpose Purpose, userID int) (string, error) {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	if err := s.store.Save(ctx, purpose, hashToken(token), userID, s.ttl(purpose)); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Returns the user token was issued to without consuming it, so a request can be validated before the token is used up.
+func (s *TokenService) Verify(ctx context.Context, purpose Purpose, token string) (int, error) {
+	return s.store.Get(ctx, purpose, hashToken(token))
+}
+
+// Consumes token, returning the user it was issued to. Only one of any concurrent calls with the same token succeeds.
+func (s *TokenService) Consume(ctx context.Context, purpose Purpose, token string) (int, error) {
+	return s.store.Take(ctx, purpose, hashToken(token))
+}
+
+func (s *TokenService) ttl(purpose Purpose) time.Duration {
+	switch purpose {
+	case PasswordReset:
+		return s.cfg.PasswordResetTTL
+	case EmailVerification:
+		return s.cfg.EmailVerificationTTL
+	default:
+		return s.cfg.DefaultTTL
+	}
+}
+
+// Tokens are random 256 bit values, so an unkeyed hash is enough to keep them unusable if the store leaks
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
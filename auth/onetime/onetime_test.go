@@ -0,0 +1,51 @@
+package onetime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+func TestTokenService(t *testing.T) {
+	cfg := &config.OneTimeTokenConfig{PasswordResetTTL: time.Hour, EmailVerificationTTL: time.Hour, DefaultTTL: time.Hour}
+	service := NewTokenService(NewInMemoryTokenStore(time.Minute), cfg)
+	ctx := context.Background()
+
+	token, err := service.Issue(ctx, PasswordReset, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verifying leaves the token usable
+	for i := 0; i < 2; i++ {
+		if userID, err := service.Verify(ctx, PasswordReset, token); err != nil || userID != 1 {
+			t.Fatalf("expected user 1, got %d, %v", userID, err)
+		}
+	}
+
+	if _, err := service.Consume(ctx, EmailVerification, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected tokens to be bound to their purpose, got %v", err)
+	}
+
+	if userID, err := service.Consume(ctx, PasswordReset, token); err != nil || userID != 1 {
+		t.Fatalf("expected user 1, got %d, %v", userID, err)
+	}
+	if _, err := service.Consume(ctx, PasswordReset, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected a consumed token to be rejected, got %v", err)
+	}
+
+	// A new token invalidates the previous one
+	first, err := service.Issue(ctx, PasswordReset, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Issue(ctx, PasswordReset, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Verify(ctx, PasswordReset, first); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected the previous token to be invalidated, got %v", err)
+	}
+}
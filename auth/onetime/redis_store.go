@@ -0,0 +1,108 @@
+package onetime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jose-lico/go-plate/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Save declares every key it touches, which is enough for key-aware proxies. On Redis Cluster the keys must also
+// share a slot, so use a prefix with a hash tag, e.g. "{onetime}:", as tokens are looked up by their hash alone.
+type RedisTokenStore struct {
+	redis  database.RedisStore
+	prefix string
+}
+
+func NewRedisTokenStore(redis database.RedisStore, prefix string) TokenStore {
+	return &RedisTokenStore{redis: redis, prefix: prefix}
+}
+
+// Storing the token, indexing it and deleting the previous one are a single step, so a failure never leaves two live tokens.
+// The previous token is read first to pass its key to the script, which starts over if another token was saved meanwhile.
+func (s *RedisTokenStore) Save(ctx context.Context, purpose Purpose, hash string, userID int, ttl time.Duration) error {
+	client := s.redis.GetNativeInstance().(*redis.Client)
+	userKey := s.userKey(purpose, userID)
+
+	for attempt := 0; attempt < maxSaveAttempts; attempt++ {
+		previous, err := client.Get(ctx, userKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("failed to read previous token: %w", err)
+		}
+
+		keys := []string{s.tokenKey(purpose, hash), userKey}
+		if previous != "" && previous != hash {
+			keys = append(keys, s.tokenKey(purpose, previous))
+		}
+
+		saved, err := saveScript.Run(ctx, client, keys, userID, max(ttl.Milliseconds(), 1), hash, previous).Int()
+		if err != nil {
+			return fmt.Errorf("failed to store token: %w", err)
+		}
+		if saved == 1 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to store token: tokens kept being issued after %d attempts", maxSaveAttempts)
+}
+
+func (s *RedisTokenStore) Get(ctx context.Context, purpose Purpose, hash string) (int, error) {
+	value, err := s.redis.Get(ctx, s.tokenKey(purpose, hash))
+	return parseUserID(value, err)
+}
+
+func (s *RedisTokenStore) Take(ctx context.Context, purpose Purpose, hash string) (int, error) {
+	client := s.redis.GetNativeInstance().(*redis.Client)
+
+	value, err := client.GetDel(ctx, s.tokenKey(purpose, hash)).Result()
+	return parseUserID(value, err)
+}
+
+func (s *RedisTokenStore) tokenKey(purpose Purpose, hash string) string {
+	return s.prefix + string(purpose) + ":" + hash
+}
+
+func (s *RedisTokenStore) userKey(purpose Purpose, userID int) string {
+	return s.prefix + string(purpose) + ":user:" + strconv.Itoa(userID)
+}
+
+func parseUserID(value string, err error) (int, error) {
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrInvalidToken
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read token: %w", err)
+	}
+
+	userID, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse token user: %w", err)
+	}
+
+	return userID, nil
+}
+
+const maxSaveAttempts = 5
+
+var saveScript = redis.NewScript(luaSave)
+
+var luaSave = `
+-- ARGV[4] is the previous token as read before running, KEYS[3] its key unless there was none
+if (redis.call("GET", KEYS[2]) or "") ~= ARGV[4] then
+    return 0
+end
+
+if KEYS[3] then
+    redis.call("DEL", KEYS[3])
+end
+
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SET", KEYS[2], ARGV[3], "PX", ARGV[2])
+
+return 1
+`
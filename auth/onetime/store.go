@@ -0,0 +1,15 @@
+package onetime
+
+import (
+	"context"
+	"time"
+)
+
+// Tokens are stored under the hash computed by the TokenService.
+// Save replaces the user's outstanding token for the purpose, if any.
+// Get and Take return ErrInvalidToken for unknown or expired tokens, Take also deletes the token atomically.
+type TokenStore interface {
+	Save(ctx context.Context, purpose Purpose, hash string, userID int, ttl time.Duration) error
+	Get(ctx context.Context, purpose Purpose, hash string) (int, error)
+	Take(ctx context.Context, purpose Purpose, hash string) (int, error)
+}
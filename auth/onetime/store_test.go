@@ -0,0 +1,203 @@
+package onetime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/database/redistest"
+)
+
+// Every TokenStore must pass these, whatever its backend
+func forEachStore(t *testing.T, test func(t *testing.T, store TokenStore)) {
+	redis, _ := redistest.New(t)
+
+	stores := map[string]TokenStore{
+		"InMemoryTokenStore": NewInMemoryTokenStore(time.Minute),
+		"RedisTokenStore":    NewRedisTokenStore(redis, "onetime:"),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			test(t, store)
+		})
+	}
+}
+
+func TestTokenStore_SaveGetTake(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TokenStore) {
+		ctx := context.Background()
+
+		if err := store.Save(ctx, PasswordReset, "hash", 1, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		if userID, err := store.Get(ctx, PasswordReset, "hash"); err != nil || userID != 1 {
+			t.Errorf("expected user 1, got %d, %v", userID, err)
+		}
+		if _, err := store.Get(ctx, EmailVerification, "hash"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected tokens to be bound to their purpose, got %v", err)
+		}
+
+		if userID, err := store.Take(ctx, PasswordReset, "hash"); err != nil || userID != 1 {
+			t.Errorf("expected user 1, got %d, %v", userID, err)
+		}
+		if _, err := store.Take(ctx, PasswordReset, "hash"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected a taken token to be gone, got %v", err)
+		}
+		if _, err := store.Get(ctx, PasswordReset, "unknown"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected %v, got %v", ErrInvalidToken, err)
+		}
+	})
+}
+
+func TestTokenStore_SaveReplacesPrevious(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TokenStore) {
+		ctx := context.Background()
+
+		for _, save := range []struct {
+			purpose Purpose
+			hash    string
+			userID  int
+		}{
+			{PasswordReset, "first", 1},
+			{PasswordReset, "other-user", 2},
+			{EmailVerification, "other-purpose", 1},
+			{PasswordReset, "second", 1},
+		} {
+			if err := store.Save(ctx, save.purpose, save.hash, save.userID, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := store.Get(ctx, PasswordReset, "first"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected the previous token to be invalidated, got %v", err)
+		}
+
+		for hash, purpose := range map[string]Purpose{"second": PasswordReset, "other-user": PasswordReset, "other-purpose": EmailVerification} {
+			if _, err := store.Get(ctx, purpose, hash); err != nil {
+				t.Errorf("%s: expected the token to stay valid, got %v", hash, err)
+			}
+		}
+	})
+}
+
+// Requesting several tokens at once still leaves a single valid one
+func TestTokenStore_ConcurrentSave(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TokenStore) {
+		ctx := context.Background()
+		hashes := []string{"a", "b", "c", "d"}
+
+		var wg sync.WaitGroup
+		for _, hash := range hashes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := store.Save(ctx, PasswordReset, hash, 1, time.Hour); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		valid := 0
+		for _, hash := range hashes {
+			if _, err := store.Get(ctx, PasswordReset, hash); err == nil {
+				valid++
+			}
+		}
+		if valid != 1 {
+			t.Errorf("expected exactly one valid token, got %d", valid)
+		}
+	})
+}
+
+func TestTokenStore_Expiry(t *testing.T) {
+	redis, server := redistest.New(t)
+
+	// miniredis only expires keys when told time has passed
+	stores := map[string]struct {
+		store   TokenStore
+		advance func(d time.Duration)
+	}{
+		"InMemoryTokenStore": {NewInMemoryTokenStore(time.Minute), time.Sleep},
+		"RedisTokenStore":    {NewRedisTokenStore(redis, "onetime:"), server.FastForward},
+	}
+
+	for name, tt := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if err := tt.store.Save(ctx, PasswordReset, "hash", 1, 50*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.advance(100 * time.Millisecond)
+
+			if _, err := tt.store.Get(ctx, PasswordReset, "hash"); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected %v, got %v", ErrInvalidToken, err)
+			}
+			if _, err := tt.store.Take(ctx, PasswordReset, "hash"); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected %v, got %v", ErrInvalidToken, err)
+			}
+		})
+	}
+}
+
+func TestTokenStore_ConcurrentTake(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TokenStore) {
+		ctx := context.Background()
+
+		if err := store.Save(ctx, PasswordReset, "hash", 1, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			taken int
+		)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if _, err := store.Take(ctx, PasswordReset, "hash"); err == nil {
+					mu.Lock()
+					taken++
+					mu.Unlock()
+				} else if !errors.Is(err, ErrInvalidToken) {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if taken != 1 {
+			t.Errorf("expected exactly one take to succeed, got %d", taken)
+		}
+	})
+}
+
+// Redis Cluster and key-aware proxies route scripts by their KEYS, so no script may touch another key
+func TestRedisTokenStore_ScriptKeys(t *testing.T) {
+	redis, server := redistest.NewCheckingScriptKeys(t)
+	store := NewRedisTokenStore(redis, "onetime:")
+	ctx := context.Background()
+
+	for _, hash := range []string{"first", "first", "second"} {
+		if err := store.Save(ctx, PasswordReset, hash, 1, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := store.Get(ctx, PasswordReset, "first"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected the previous token to be invalidated, got %v", err)
+	}
+	if keys := server.Keys(); len(keys) != 2 {
+		t.Errorf("expected only the new token and its index, got %v", keys)
+	}
+}
@@ -1,19 +1,80 @@
 package auth
 
 import (
+	"errors"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+var (
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	ErrMalformedHash   = errors.New("malformed password hash")
+)
+
+// Hashes are self describing (PHC string format, or modular crypt for bcrypt), carrying the algorithm and its parameters.
+// Verify reports needsRehash when the hash was made with weaker parameters than the hasher's current ones.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (ok bool, needsRehash bool, err error)
+	CanVerify(encoded string) bool
+}
+
+type multiHasher struct {
+	current PasswordHasher
+	legacy  []PasswordHasher
+}
+
+// Hashes with current and verifies hashes made by current or any of the legacy hashers.
+// Hashes made by a legacy hasher always need a rehash, so they are upgraded as users log in.
+func NewPasswordHasher(current PasswordHasher, legacy ...PasswordHasher) PasswordHasher {
+	return &multiHasher{current: current, legacy: legacy}
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *multiHasher) Verify(encoded, password string) (bool, bool, error) {
+	if h.current.CanVerify(encoded) {
+		return h.current.Verify(encoded, password)
+	}
+
+	for _, legacy := range h.legacy {
+		if legacy.CanVerify(encoded) {
+			ok, _, err := legacy.Verify(encoded, password)
+			return ok, ok, err
+		}
+	}
+
+	return false, false, ErrUnsupportedHash
+}
+
+func (h *multiHasher) CanVerify(encoded string) bool {
+	if h.current.CanVerify(encoded) {
+		return true
+	}
+
+	for _, legacy := range h.legacy {
+		if legacy.CanVerify(encoded) {
+			return true
+		}
 	}
 
-	return string(hash), nil
+	return false
+}
+
+// Argon2id for new hashes, existing bcrypt hashes are still accepted
+var DefaultPasswordHasher = NewPasswordHasher(NewArgon2idHasher(DefaultArgon2idParams), NewBcryptHasher(bcrypt.DefaultCost))
+
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher.Hash(password)
+}
+
+func VerifyPassword(encoded, password string) (ok bool, needsRehash bool, err error) {
+	return DefaultPasswordHasher.Verify(encoded, password)
 }
 
 func ComparePasswords(hashed string, plain []byte) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashed), plain)
-	return err == nil
+	ok, _, err := VerifyPassword(hashed, string(plain))
+	return err == nil && ok
 }
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+const minPersonalTokenLength = 3
+
+type PasswordViolation struct {
+	Code    string `json:"code" example:"too_short"`
+	Message string `json:"message" example:"Password must be at least 8 characters long"`
+}
+
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+
+	return "password does not meet requirements: " + strings.Join(messages, "; ")
+}
+
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	MinCharClasses int
+	MinEntropyBits float64
+
+	// Optional, nil skips the breached password check
+	Breached *BreachedPasswords
+}
+
+func NewPasswordPolicy(cfg *config.PasswordConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength:      cfg.MinLength,
+		MaxLength:      cfg.MaxLength,
+		MinCharClasses: cfg.MinCharClasses,
+		MinEntropyBits: float64(cfg.MinEntropyBits),
+	}
+
+	if cfg.BreachedCorpusPath != "" {
+		breached, err := OpenBreachedPasswords(cfg.BreachedCorpusPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// Check returns a *PasswordPolicyError listing every rule the password breaks.
+// personal holds values the password must not contain, such as the user's email and name.
+func (p *PasswordPolicy) Check(password string, personal ...string) error {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_short",
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("Password must be at most %d characters long", p.MaxLength),
+		})
+	}
+
+	classes, pool := charClasses(password)
+	if classes < p.MinCharClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    "insufficient_char_classes",
+			Message: fmt.Sprintf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharClasses),
+		})
+	}
+
+	if EstimateEntropy(password, pool) < p.MinEntropyBits {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_predictable",
+			Message: "Password is too predictable, avoid repeated characters and sequences",
+		})
+	}
+
+	if containsPersonalInfo(password, personal) {
+		violations = append(violations, PasswordViolation{
+			Code:    "contains_personal_info",
+			Message: "Password must not contain your name or email",
+		})
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, PasswordViolation{
+			Code:    "breached",
+			Message: "Password has appeared in a data breach, choose a different one",
+		})
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &PasswordPolicyError{Violations: violations}
+}
+
+// Returns how many of lowercase, uppercase, digits and symbols are used, and the size of the resulting character pool
+func charClasses(password string) (int, int) {
+	var lower, upper, digit, symbol, other bool
+
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes, pool := 0, 0
+	if lower {
+		classes, pool = classes+1, pool+26
+	}
+	if upper {
+		classes, pool = classes+1, pool+26
+	}
+	if digit {
+		classes, pool = classes+1, pool+10
+	}
+	if symbol || other {
+		classes++
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+
+	return classes, pool
+}
+
+// Estimates entropy in bits as log2(pool) per character, with characters that repeat or continue a sequence
+// from the previous one (aaa, abc, 321) only counting as a single bit
+func EstimateEntropy(password string, pool int) float64 {
+	if pool <= 1 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+
+	var bits float64
+	var prev rune = -1
+	for _, r := range password {
+		if d := r - prev; d >= -1 && d <= 1 {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+
+	return bits
+}
+
+func containsPersonalInfo(password string, personal []string) bool {
+	lowered := strings.ToLower(password)
+
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			value = local
+		}
+
+		tokens := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		tokens = append(tokens, value)
+
+		for _, token := range tokens {
+			if utf8.RuneCountInString(token) >= minPersonalTokenLength && strings.Contains(lowered, token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
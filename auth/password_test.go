@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher_BcryptFallback(t *testing.T) {
+	hasher := NewPasswordHasher(NewArgon2idHasher(testArgon2idParams), NewBcryptHasher(bcrypt.MinCost))
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("MyPassword"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Legacy hashes always need an upgrade, whatever their cost
+	if ok, needsRehash, err := hasher.Verify(string(legacy), "MyPassword"); !ok || !needsRehash || err != nil {
+		t.Errorf("expected the bcrypt hash to verify and need a rehash, got ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+	if ok, needsRehash, err := hasher.Verify(string(legacy), "WrongPassword"); ok || needsRehash || err != nil {
+		t.Errorf("expected a wrong password to be rejected without a rehash, got ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+
+	upgraded, err := hasher.Hash("MyPassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !NewArgon2idHasher(testArgon2idParams).CanVerify(upgraded) {
+		t.Errorf("expected new hashes to use argon2id, got %s", upgraded)
+	}
+	if ok, needsRehash, err := hasher.Verify(upgraded, "MyPassword"); !ok || needsRehash || err != nil {
+		t.Errorf("expected the upgraded hash to verify, got ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+
+	for _, encoded := range []string{"", "plaintext", "$1$md5$hash"} {
+		if hasher.CanVerify(encoded) {
+			t.Errorf("%q: expected the hash not to be verifiable", encoded)
+		}
+		if _, _, err := hasher.Verify(encoded, "MyPassword"); !errors.Is(err, ErrUnsupportedHash) {
+			t.Errorf("%q: expected %v, got %v", encoded, ErrUnsupportedHash, err)
+		}
+	}
+}
+
+func TestBcryptHasher_NeedsRehash(t *testing.T) {
+	hash, err := NewBcryptHasher(bcrypt.MinCost).Hash("MyPassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cost, expected := range map[int]bool{bcrypt.MinCost: false, bcrypt.MinCost + 1: true} {
+		if ok, needsRehash, err := NewBcryptHasher(cost).Verify(hash, "MyPassword"); !ok || needsRehash != expected || err != nil {
+			t.Errorf("cost %d: expected needsRehash %v, got ok=%v needsRehash=%v err=%v", cost, expected, ok, needsRehash, err)
+		}
+	}
+}
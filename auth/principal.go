@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+type AuthMethod string
+
+const (
+	MethodSession AuthMethod = "session"
+	MethodBearer  AuthMethod = "bearer"
+	MethodAPIKey  AuthMethod = "api_key"
+)
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+// User a request is authenticated as, set by the session, bearer and API key middleware alike
+type Principal struct {
+	UserID    int
+	Method    AuthMethod
+	SessionID string    // Public ID of the session, access token or API key (its prefix)
+	Scopes    []string  // Set for API keys and access tokens with a scope claim, see Allows
+	ExpiresAt time.Time // Zero if the credential does not expire
+}
+
+// Reports whether the principal may act within scope. API keys are always limited to their scopes,
+// access tokens only when they carry a scope claim (Scopes is not nil), sessions are never limited.
+func (p *Principal) Allows(scope string) bool {
+	switch p.Method {
+	case MethodAPIKey:
+		return slices.Contains(p.Scopes, scope)
+	case MethodBearer:
+		return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+	default:
+		return true
+	}
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// Returns the principal of an authenticated request, or false if the request is not authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok
+}
+
+// Like FromContext, but panics if the request is not authenticated.
+// Only use it behind middleware that rejects unauthenticated requests.
+func MustFromContext(ctx context.Context) *Principal {
+	p, ok := FromContext(ctx)
+	if !ok {
+		panic("auth: no principal in context, is the request authenticated?")
+	}
+	return p
+}
@@ -0,0 +1,62 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// 32 characters without the easily confused i, l and o, so every random byte maps to a character without bias
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz123456789"
+
+// Generates n one-time recovery codes formatted as xxxxx-xxxxx, returned together with their hashes.
+// Only the hashes should be stored, the codes are shown to the user once.
+func GenerateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		var sb strings.Builder
+		for j, c := range b {
+			if j == 5 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(recoveryCodeAlphabet[c&31])
+		}
+
+		codes[i] = sb.String()
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// Recovery codes carry 50 bits of randomness, so a fast hash is enough as long as attempts are rate limited
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// Checks code against the stored hashes, returning the hashes left once the matching code is consumed
+func UseRecoveryCode(hashes []string, code string) ([]string, bool) {
+	hashed := []byte(HashRecoveryCode(code))
+
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), hashed) == 1 {
+			remaining := make([]string, 0, len(hashes)-1)
+			remaining = append(remaining, hashes[:i]...)
+			return append(remaining, hashes[i+1:]...), true
+		}
+	}
+
+	return hashes, false
+}
@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("expected 10 codes and hashes, got %d and %d", len(codes), len(hashes))
+	}
+
+	format := regexp.MustCompile(`^[` + recoveryCodeAlphabet + `]{5}-[` + recoveryCodeAlphabet + `]{5}$`)
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("expected xxxxx-xxxxx from the recovery alphabet, got %s", code)
+		}
+		if hashes[i] != HashRecoveryCode(code) || strings.Contains(hashes[i], code) {
+			t.Errorf("expected the hash of %s, got %s", code, hashes[i])
+		}
+	}
+
+	sorted := slices.Clone(codes)
+	slices.Sort(sorted)
+	if len(slices.Compact(sorted)) != len(codes) {
+		t.Errorf("expected distinct codes, got %v", codes)
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Typed back in capitals or without the dash
+	remaining, ok := UseRecoveryCode(hashes, strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")))
+	if !ok {
+		t.Fatal("expected the code to be accepted")
+	}
+	if !slices.Equal(remaining, []string{hashes[0], hashes[2]}) {
+		t.Errorf("expected only the used code to be consumed, got %v", remaining)
+	}
+	if len(hashes) != 3 {
+		t.Error("expected the stored hashes not to be modified")
+	}
+
+	// Single use
+	if left, ok := UseRecoveryCode(remaining, codes[1]); ok || !slices.Equal(left, remaining) {
+		t.Errorf("expected a used code to be rejected, got %v", left)
+	}
+
+	for _, code := range []string{"", "wrong-codes", codes[0][:5], codes[0] + "x"} {
+		if _, ok := UseRecoveryCode(remaining, code); ok {
+			t.Errorf("expected %q to be rejected", code)
+		}
+	}
+
+	if remaining, ok = UseRecoveryCode(remaining, codes[0]); !ok || !slices.Equal(remaining, []string{hashes[2]}) {
+		t.Errorf("expected the other codes to stay usable, got %v", remaining)
+	}
+}
+
+// Codes are compared through their hashes, which always have the same length, so the constant time
+// comparison never returns early whatever the length of the submitted code
+func TestHashRecoveryCode_FixedLength(t *testing.T) {
+	for _, code := range []string{"", "a", "abcde-fghjk", strings.Repeat("x", 1000)} {
+		if hash := HashRecoveryCode(code); len(hash) != 64 {
+			t.Errorf("%q: expected a 64 character hash, got %d", code, len(hash))
+		}
+	}
+
+	if HashRecoveryCode("abcde-fghjk") != HashRecoveryCode(" ABCDE FGHJK ") {
+		t.Error("expected codes to be normalized before hashing")
+	}
+}
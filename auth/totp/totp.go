@@ -0,0 +1,140 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSecret = errors.New("invalid TOTP secret")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RFC 6238 parameters. Authenticator apps widely support only HMAC-SHA1, so it is the only algorithm offered.
+type Options struct {
+	Digits int
+	Period time.Duration
+	Skew   int // Number of periods before and after the current one that are also accepted
+}
+
+var DefaultOptions = Options{Digits: 6, Period: 30 * time.Second, Skew: 1}
+
+// Generates a random 160 bit secret, base32 encoded without padding as expected by authenticator apps
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+func Code(secret string, t time.Time) (string, error) {
+	return DefaultOptions.Code(secret, t)
+}
+
+func Validate(secret, code string, t time.Time) (int64, bool, error) {
+	return DefaultOptions.Validate(secret, code, t)
+}
+
+func (o Options) Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return o.hotp(key, o.Counter(t)), nil
+}
+
+// Validate checks code against the periods within the skew window around t and returns the matching counter.
+// Callers should store the counter and reject codes with a counter lower or equal to the last one used, so a code can not be replayed.
+func (o Options) Validate(secret, code string, t time.Time) (int64, bool, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != o.Digits {
+		return 0, false, nil
+	}
+
+	current := o.Counter(t)
+	for i := -o.Skew; i <= o.Skew; i++ {
+		counter := current + int64(i)
+		if counter < 0 {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(o.hotp(key, counter)), []byte(code)) == 1 {
+			return counter, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+func (o Options) Counter(t time.Time) int64 {
+	return t.Unix() / int64(o.Period/time.Second)
+}
+
+// otpauth:// URI to be rendered as a QR code for authenticator apps
+func (o Options) ProvisioningURI(secret, issuer, account string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", strconv.Itoa(o.Digits))
+	params.Set("period", strconv.Itoa(int(o.Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: params.Encode(),
+	}
+
+	return u.String()
+}
+
+func ProvisioningURI(secret, issuer, account string) string {
+	return DefaultOptions.ProvisioningURI(secret, issuer, account)
+}
+
+// RFC 4226 HOTP with dynamic truncation
+func (o Options) hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", o.Digits, value%uint32(math.Pow10(o.Digits)))
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return key, nil
+}
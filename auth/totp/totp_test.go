@@ -0,0 +1,178 @@
+package totp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Base32 of the ASCII secret "12345678901234567890" of RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B, HMAC-SHA1 with 8 digits and 30 second periods
+func TestCode_RFC6238(t *testing.T) {
+	options := Options{Digits: 8, Period: 30 * time.Second, Skew: 1}
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "94287082"},
+		{unix: 1111111109, code: "07081804"},
+		{unix: 1111111111, code: "14050471"},
+		{unix: 1234567890, code: "89005924"},
+		{unix: 2000000000, code: "69279037"},
+		{unix: 20000000000, code: "65353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := options.Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("%d: expected %s, got %s", tt.unix, tt.code, code)
+		}
+
+		// The default 6 digits are the last 6 of the same value
+		if code, _ := Code(rfcSecret, time.Unix(tt.unix, 0)); code != tt.code[2:] {
+			t.Errorf("%d: expected %s, got %s", tt.unix, tt.code[2:], code)
+		}
+	}
+}
+
+func TestValidate_Window(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := DefaultOptions.Counter(now)
+
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		valid   bool
+		counter int64
+	}{
+		{name: "Current period", offset: 0, valid: true, counter: current},
+		{name: "Previous period", offset: -30 * time.Second, valid: true, counter: current - 1},
+		{name: "Next period", offset: 30 * time.Second, valid: true, counter: current + 1},
+		{name: "Two periods ago", offset: -60 * time.Second, valid: false},
+		{name: "Two periods ahead", offset: 60 * time.Second, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, now.Add(tt.offset))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counter, valid, err := Validate(rfcSecret, code, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid != tt.valid || counter != tt.counter {
+				t.Errorf("expected %v with counter %d, got %v with counter %d", tt.valid, tt.counter, valid, counter)
+			}
+		})
+	}
+}
+
+func TestValidate_Input(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		valid  bool
+		err    error
+	}{
+		{name: "Surrounding spaces", secret: rfcSecret, code: " " + code + " ", valid: true},
+		{name: "Lowercase and spaced secret", secret: strings.ToLower(rfcSecret[:16]) + " " + rfcSecret[16:], code: code, valid: true},
+		{name: "Too short", secret: rfcSecret, code: code[1:]},
+		{name: "Too long", secret: rfcSecret, code: code + "0"},
+		{name: "Wrong code", secret: rfcSecret, code: strings.Repeat("0", 6)},
+		{name: "Invalid secret", secret: "not base32!", code: code, err: ErrInvalidSecret},
+		{name: "Empty secret", secret: "", code: code, err: ErrInvalidSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, valid, err := Validate(tt.secret, tt.code, now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if valid != tt.valid {
+				t.Errorf("expected %v, got %v", tt.valid, valid)
+			}
+		})
+	}
+}
+
+// Callers keep the counter of the last accepted code and reject any code that does not move it forward
+func TestValidate_Replay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	var lastCounter int64
+
+	use := func(code string, at time.Time) bool {
+		counter, valid, err := Validate(rfcSecret, code, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !valid || counter <= lastCounter {
+			return false
+		}
+		lastCounter = counter
+		return true
+	}
+
+	code, _ := Code(rfcSecret, now)
+	if !use(code, now) {
+		t.Fatal("expected the first use to be accepted")
+	}
+	if use(code, now) {
+		t.Error("expected the same code to be rejected")
+	}
+	// Still within the window, but for the period already used
+	if use(code, now.Add(30*time.Second)) {
+		t.Error("expected the same code to be rejected in the next period")
+	}
+
+	previous, _ := Code(rfcSecret, now.Add(-30*time.Second))
+	if use(previous, now) {
+		t.Error("expected a code older than the last one used to be rejected")
+	}
+
+	next, _ := Code(rfcSecret, now.Add(30*time.Second))
+	if !use(next, now) {
+		t.Error("expected the code of a later period to be accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("expected a 160 bit secret, got %d bytes, %v", len(key), err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("expected secrets to be random")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI(rfcSecret, "go-plate", "user@example.com")
+
+	expected := "otpauth://totp/go-plate:user@example.com?algorithm=SHA1&digits=6&issuer=go-plate&period=30&secret=" + rfcSecret
+	if uri != expected {
+		t.Errorf("expected %s, got %s", expected, uri)
+	}
+}
@@ -0,0 +1,182 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+)
+
+type Role string
+type Permission string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// Grants every permission
+const AllPermissions Permission = "*"
+
+type contextKey string
+
+const Roles contextKey = "roles"
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// Looks up the roles of an authenticated user. Unknown users should have no roles rather than an error.
+type RoleResolver interface {
+	UserRoles(ctx context.Context, userID int) ([]Role, error)
+}
+
+type RoleResolverFunc func(ctx context.Context, userID int) ([]Role, error)
+
+func (f RoleResolverFunc) UserRoles(ctx context.Context, userID int) ([]Role, error) {
+	return f(ctx, userID)
+}
+
+// Maps each role to the permissions it grants
+type Policy struct {
+	grants map[Role]map[Permission]bool
+}
+
+func NewPolicy(grants map[Role][]Permission) *Policy {
+	p := &Policy{grants: make(map[Role]map[Permission]bool, len(grants))}
+
+	for role, permissions := range grants {
+		p.grants[role] = make(map[Permission]bool, len(permissions))
+		for _, permission := range permissions {
+			p.grants[role][permission] = true
+		}
+	}
+
+	return p
+}
+
+func (p *Policy) Allows(roles []Role, permission Permission) bool {
+	for _, role := range roles {
+		if p.grants[role][permission] || p.grants[role][AllPermissions] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks the permissions of the auth.Principal set by the session, bearer or API key middleware, which must run first.
+// Requests that are not authenticated fail with ErrUnauthenticated (401), requests lacking a permission with ErrForbidden (403).
+// API keys and scoped access tokens only get the permissions of the user's roles that they also hold as scopes.
+type Authorizer struct {
+	policy   *Policy
+	resolver RoleResolver
+}
+
+func NewAuthorizer(policy *Policy, resolver RoleResolver) *Authorizer {
+	return &Authorizer{policy: policy, resolver: resolver}
+}
+
+// Attaches the roles of the authenticated user to the request context, so they are only resolved once per request
+func (a *Authorizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles, err := a.roles(r)
+		if errors.Is(err, ErrUnauthenticated) {
+			next.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), Roles, roles)))
+	})
+}
+
+// Rejects requests whose user lacks permission
+func (a *Authorizer) Require(permission Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a.Check(w, r, permission) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// Returns nil if the user of r holds permission, and the credential of r is scoped to it
+func (a *Authorizer) Authorize(r *http.Request, permission Permission) error {
+	roles, err := a.roles(r)
+	if err != nil {
+		return err
+	}
+
+	if !a.policy.Allows(roles, permission) || !auth.MustFromContext(r.Context()).Allows(string(permission)) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// Returns nil if the user of r owns the resource, or otherwise holds override, e.g. to let admins act on anyone's resources
+func (a *Authorizer) AuthorizeOwner(r *http.Request, ownerID int, override Permission) error {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	if principal.UserID == ownerID {
+		return nil
+	}
+
+	return a.Authorize(r, override)
+}
+
+// Like Authorize, writing the error response and returning false if the request is not allowed
+func (a *Authorizer) Check(w http.ResponseWriter, r *http.Request, permission Permission) bool {
+	return writeError(w, a.Authorize(r, permission))
+}
+
+// Like AuthorizeOwner, writing the error response and returning false if the request is not allowed
+func (a *Authorizer) CheckOwner(w http.ResponseWriter, r *http.Request, ownerID int, override Permission) bool {
+	return writeError(w, a.AuthorizeOwner(r, ownerID, override))
+}
+
+func (a *Authorizer) roles(r *http.Request) ([]Role, error) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	if roles, ok := r.Context().Value(Roles).([]Role); ok {
+		return roles, nil
+	}
+
+	roles, err := a.resolver.UserRoles(r.Context(), principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve user roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+func writeError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUnauthenticated):
+		w.WriteHeader(http.StatusUnauthorized)
+	case errors.Is(err, ErrForbidden):
+		utils.WriteError(w, http.StatusForbidden, err)
+	default:
+		zap.L().Error("Error authorizing request", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+	}
+
+	return false
+}
@@ -0,0 +1,218 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jose-lico/go-plate/auth"
+)
+
+const (
+	roleModerator Role = "moderator"
+
+	permissionReadPosts     Permission = "posts:read"
+	permissionModeratePosts Permission = "posts:moderate"
+)
+
+// User 1 is a moderator, 2 an admin, 3 a plain user and 4 fails to resolve
+func newTestAuthorizer() *Authorizer {
+	policy := NewPolicy(map[Role][]Permission{
+		RoleUser:      {permissionReadPosts},
+		roleModerator: {permissionReadPosts, permissionModeratePosts},
+		RoleAdmin:     {AllPermissions},
+	})
+
+	resolver := RoleResolverFunc(func(ctx context.Context, userID int) ([]Role, error) {
+		switch userID {
+		case 1:
+			return []Role{RoleUser, roleModerator}, nil
+		case 2:
+			return []Role{RoleAdmin}, nil
+		case 3:
+			return []Role{RoleUser}, nil
+		case 4:
+			return nil, errors.New("database is down")
+		default:
+			return nil, nil
+		}
+	})
+
+	return NewAuthorizer(policy, resolver)
+}
+
+func newRequest(userID int) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if userID == 0 {
+		return r
+	}
+	return r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{UserID: userID, Method: auth.MethodSession}))
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	policy := newTestAuthorizer().policy
+
+	tests := []struct {
+		name       string
+		roles      []Role
+		permission Permission
+		expected   bool
+	}{
+		{name: "Granted", roles: []Role{RoleUser}, permission: permissionReadPosts, expected: true},
+		{name: "Not granted", roles: []Role{RoleUser}, permission: permissionModeratePosts, expected: false},
+		{name: "Granted by any role", roles: []Role{RoleUser, roleModerator}, permission: permissionModeratePosts, expected: true},
+		{name: "Wildcard", roles: []Role{RoleAdmin}, permission: "anything", expected: true},
+		{name: "Unknown role", roles: []Role{"guest"}, permission: permissionReadPosts, expected: false},
+		{name: "No roles", roles: nil, permission: permissionReadPosts, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if allowed := policy.Allows(tt.roles, tt.permission); allowed != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestAuthorizer_Require(t *testing.T) {
+	authorizer := newTestAuthorizer()
+
+	handler := authorizer.Middleware(authorizer.Require(permissionModeratePosts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name   string
+		userID int
+		status int
+	}{
+		{name: "Unauthenticated", userID: 0, status: http.StatusUnauthorized},
+		{name: "Lacking permission", userID: 3, status: http.StatusForbidden},
+		{name: "No roles", userID: 5, status: http.StatusForbidden},
+		{name: "Holding permission", userID: 1, status: http.StatusOK},
+		{name: "Admin", userID: 2, status: http.StatusOK},
+		{name: "Resolver error", userID: 4, status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newRequest(tt.userID))
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+// Credentials limited to scopes only get the permissions of their owner's roles they are scoped to
+func TestAuthorizer_Scopes(t *testing.T) {
+	authorizer := newTestAuthorizer()
+
+	const permissionReadConfig Permission = "config:read"
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		status    int
+	}{
+		{name: "Admin session", principal: &auth.Principal{UserID: 2, Method: auth.MethodSession}, status: http.StatusOK},
+		{name: "Admin access token", principal: &auth.Principal{UserID: 2, Method: auth.MethodBearer}, status: http.StatusOK},
+		{name: "Admin API key with another scope", principal: &auth.Principal{UserID: 2, Method: auth.MethodAPIKey, Scopes: []string{string(permissionReadPosts)}}, status: http.StatusForbidden},
+		{name: "Admin API key without scopes", principal: &auth.Principal{UserID: 2, Method: auth.MethodAPIKey}, status: http.StatusForbidden},
+		{name: "Admin scoped access token", principal: &auth.Principal{UserID: 2, Method: auth.MethodBearer, Scopes: []string{string(permissionReadPosts)}}, status: http.StatusForbidden},
+		{name: "Admin API key with the scope", principal: &auth.Principal{UserID: 2, Method: auth.MethodAPIKey, Scopes: []string{string(permissionReadConfig)}}, status: http.StatusOK},
+		// The scope doesn't grant what the user's roles don't
+		{name: "User API key with the scope", principal: &auth.Principal{UserID: 3, Method: auth.MethodAPIKey, Scopes: []string{string(permissionReadConfig)}}, status: http.StatusForbidden},
+	}
+
+	handler := authorizer.Middleware(authorizer.Require(permissionReadConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+			r = r.WithContext(auth.WithPrincipal(r.Context(), tt.principal))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+
+	// Overriding ownership needs the scope too
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{UserID: 2, Method: auth.MethodAPIKey, Scopes: []string{string(permissionReadPosts)}}))
+	if err := authorizer.AuthorizeOwner(r, 3, permissionModeratePosts); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected an admin's API key not to override ownership without the scope, got %v", err)
+	}
+}
+
+func TestAuthorizer_CheckOwner(t *testing.T) {
+	authorizer := newTestAuthorizer()
+
+	const ownerID = 3
+
+	tests := []struct {
+		name    string
+		userID  int
+		status  int
+		allowed bool
+	}{
+		{name: "Unauthenticated", userID: 0, status: http.StatusUnauthorized},
+		{name: "Owner", userID: ownerID, status: http.StatusOK, allowed: true},
+		{name: "Moderator", userID: 1, status: http.StatusOK, allowed: true},
+		{name: "Admin", userID: 2, status: http.StatusOK, allowed: true},
+		{name: "Other user", userID: 5, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			if allowed := authorizer.CheckOwner(rr, newRequest(tt.userID), ownerID, permissionModeratePosts); allowed != tt.allowed {
+				t.Errorf("expected %v, got %v", tt.allowed, allowed)
+			}
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+
+	// Owners don't need the override, so their roles are never resolved
+	if err := authorizer.AuthorizeOwner(newRequest(4), 4, permissionModeratePosts); err != nil {
+		t.Errorf("expected the owner to be allowed, got %v", err)
+	}
+}
+
+// Roles attached by Middleware are used instead of resolving them again
+func TestAuthorizer_MiddlewareResolvesOnce(t *testing.T) {
+	calls := 0
+	resolver := RoleResolverFunc(func(ctx context.Context, userID int) ([]Role, error) {
+		calls++
+		return []Role{RoleAdmin}, nil
+	})
+	authorizer := NewAuthorizer(newTestAuthorizer().policy, resolver)
+
+	handler := authorizer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, permission := range []Permission{permissionReadPosts, permissionModeratePosts} {
+			if err := authorizer.Authorize(r, permission); err != nil {
+				t.Errorf("expected %s to be allowed, got %v", permission, err)
+			}
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(1))
+
+	if calls != 1 {
+		t.Errorf("expected roles to be resolved once, got %d", calls)
+	}
+}
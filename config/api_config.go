@@ -1,39 +1,43 @@
 package config
 
 import (
-	"os"
-	"strings"
-
-	"github.com/jose-lico/go-plate/utils"
+	"slices"
+	"time"
 )
 
 type APIConfig struct {
-	Env string
+	Env string `env:"ENV"`
+
+	Host string `env:"HOST"`
+	Port string `env:"PORT" default:"8080" validate:"numeric"`
+
+	AllowedOrigins   []string `env:"ALLOWED_ORIGINS"`
+	AllowedMethods   []string `env:"ALLOWED_METHODS"`
+	AllowedHeaders   []string `env:"ALLOWED_HEADERS"`
+	ExposedHeaders   []string `env:"EXPOSED_HEADERS"`
+	AllowCredentials bool     `env:"ALLOW_CREDENTIALS"`
+	MaxAge           int      `env:"MAX_AGE" validate:"gte=0"`
 
-	Host string
-	Port string
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT" validate:"gte=0"`
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" validate:"gte=0"`
 
-	AllowedOrigins   []string
-	AllowedMethods   []string
-	AllowedHeaders   []string
-	ExposedHeaders   []string
-	AllowCredentials bool
-	MaxAge           int
+	// How long /readyz reports shutting down while still serving, so load balancers stop routing here first, 0 shuts down at once
+	ShutdownDrain time.Duration `env:"SHUTDOWN_DRAIN" default:"5s" validate:"gte=0"`
+
+	// How often config files are checked for changes to reload, 0 only reloads on SIGHUP
+	ConfigPollInterval time.Duration `env:"CONFIG_POLL_INTERVAL" default:"10s" validate:"gte=0"`
 }
 
 func NewAPIConfig() *APIConfig {
-	env := os.Getenv("ENV")
-
-	return &APIConfig{
-		Env: env,
-
-		Host:             os.Getenv("HOST"),
-		Port:             os.Getenv("PORT"),
-		AllowedOrigins:   strings.Split(os.Getenv("ALLOWED_ORIGINS"), ","),
-		AllowedMethods:   strings.Split(os.Getenv("ALLOWED_METHODS"), ","),
-		AllowedHeaders:   strings.Split(os.Getenv("ALLOWED_HEADERS"), ","),
-		ExposedHeaders:   strings.Split(os.Getenv("EXPOSED_HEADERS"), ","),
-		AllowCredentials: utils.GetEnvAsBool("ALLOW_CREDENTIALS"),
-		MaxAge:           utils.GetEnvAsInt("MAX_AGE"),
+	cfg := &APIConfig{}
+	mustLoad("", cfg)
+	return cfg
+}
+
+func (c *APIConfig) warnings() []string {
+	var warnings []string
+	if slices.Contains(c.AllowedOrigins, "*") && c.AllowCredentials {
+		warnings = append(warnings, "ALLOWED_ORIGINS allows any origin to make credentialed requests, as ALLOW_CREDENTIALS is true")
 	}
+	return warnings
 }
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"time"
+)
+
+type APIKeyConfig struct {
+	// Visible start of every key, e.g. "gp" gives keys like gp_3xk9v2mq_<secret>, so leaked keys are easy to recognize
+	Prefix string `env:"PREFIX" default:"gp" validate:"alphanum"`
+
+	// Last used time is only written back to the database once every TouchInterval
+	TouchInterval time.Duration `env:"TOUCH_INTERVAL" default:"1m" validate:"gt=0"`
+}
+
+// Reads API_KEY_* variables
+func NewAPIKeyConfig() *APIKeyConfig {
+	cfg := &APIKeyConfig{}
+	mustLoad("API_KEY_", cfg)
+	return cfg
+}
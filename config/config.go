@@ -0,0 +1,34 @@
+package config
+
+// Configuration of every component, loaded at once so all bad or missing variables are reported together
+type Config struct {
+	API       APIConfig
+	SQL       SQLGormConfig `prefix:"SQL_"`
+	Redis     RedisConfig   `prefix:"RD_"`
+	Session   SessionConfig `prefix:"SESSION_"`
+	CSRF      CSRFConfig    `prefix:"CSRF_"`
+	JWT       JWTConfig     `prefix:"JWT_"`
+	OneTime   OneTimeTokenConfig
+	Mail      MailConfig
+	APIKey    APIKeyConfig    `prefix:"API_KEY_"`
+	Password  PasswordConfig  `prefix:"PASSWORD_"`
+	OIDC      OIDCConfig      `prefix:"OIDC_"`
+	RateLimit RateLimitConfig `prefix:"RATE_LIMIT_"`
+	Flags     FlagsConfig     `prefix:"FLAGS_"`
+}
+
+// Loads every component from sources, see Sources for the order of precedence.
+// The report is returned with load errors too, to help find which layer set a bad value.
+func NewConfig(sources *Sources) (*Config, *Report, error) {
+	layers, err := sources.Layers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &Config{}
+	report, err := LoadLayers(layers, "", cfg)
+	if err != nil {
+		return nil, report, err
+	}
+	return cfg, report, nil
+}
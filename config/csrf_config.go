@@ -0,0 +1,26 @@
+package config
+
+type CSRFConfig struct {
+	// "synchronizer" keeps the token in the session, "double-submit" in a cookie the client echoes back
+	Mode string `env:"MODE" default:"synchronizer" validate:"oneof=synchronizer double-submit"`
+
+	// Signs double-submit tokens, binding them to the session
+	Secret string `env:"SECRET" secret:"true" validate:"required_if=Mode double-submit"`
+
+	CookieName     string `env:"COOKIE_NAME" default:"csrf_token"`
+	CookiePath     string `env:"COOKIE_PATH" default:"/"`
+	CookieDomain   string `env:"COOKIE_DOMAIN"`
+	CookieSecure   bool   `env:"COOKIE_SECURE" default:"true"` // Only disable for local dev over http
+	CookieSameSite string `env:"COOKIE_SAME_SITE" default:"strict"`
+
+	// Where clients send the token back, the header is checked before the form field
+	HeaderName string `env:"HEADER_NAME" default:"X-CSRF-Token"`
+	FormField  string `env:"FORM_FIELD" default:"csrf_token"`
+}
+
+// Reads CSRF_* variables
+func NewCSRFConfig() *CSRFConfig {
+	cfg := &CSRFConfig{}
+	mustLoad("CSRF_", cfg)
+	return cfg
+}
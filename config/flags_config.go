@@ -0,0 +1,20 @@
+package config
+
+import (
+	"time"
+)
+
+type FlagsConfig struct {
+	// Where feature flags are read from, flags are all off while empty
+	Backend         string        `env:"BACKEND" validate:"omitempty,oneof=file redis"`
+	FilePath        string        `env:"FILE_PATH" default:"flags.json" validate:"required_if=Backend file"`
+	KeyPrefix       string        `env:"KEY_PREFIX" default:"flags:"`
+	RefreshInterval time.Duration `env:"REFRESH_INTERVAL" default:"30s" validate:"gt=0"`
+}
+
+// Reads FLAGS_* variables
+func NewFlagsConfig() *FlagsConfig {
+	cfg := &FlagsConfig{}
+	mustLoad("FLAGS_", cfg)
+	return cfg
+}
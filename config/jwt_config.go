@@ -0,0 +1,31 @@
+package config
+
+import (
+	"time"
+)
+
+type JWTConfig struct {
+	Issuer   string `env:"ISSUER"`
+	Audience string `env:"AUDIENCE"`
+
+	// HS256 signs with Secret. EdDSA and RS256 sign with the PKCS#8 key at PrivateKeyPath or,
+	// if KeyStore ("file" or "redis") is set, with a managed key set rotated every KeyRotationInterval.
+	Algorithm           string        `env:"ALGORITHM" default:"HS256" validate:"oneof=HS256 EdDSA RS256"`
+	Secret              string        `env:"SECRET" secret:"true"`
+	PrivateKeyPath      string        `env:"PRIVATE_KEY_PATH"`
+	KeyStore            string        `env:"KEY_STORE" validate:"omitempty,oneof=file redis"`
+	KeyStorePath        string        `env:"KEY_STORE_PATH" default:"jwks.json"`
+	KeyRotationInterval time.Duration `env:"KEY_ROTATION_INTERVAL" validate:"gte=0"`
+
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" default:"15m" validate:"gt=0"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" default:"720h" validate:"gt=0"`
+
+	KeyPrefix string `env:"KEY_PREFIX" default:"refresh:"`
+}
+
+// Reads JWT_* variables
+func NewJWTConfig() *JWTConfig {
+	cfg := &JWTConfig{}
+	mustLoad("JWT_", cfg)
+	return cfg
+}
@@ -0,0 +1,349 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the layers that are not files, which are named after their path
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Extensions of config files, in the order they are looked for
+var fileExtensions = []string{".yaml", ".yml", ".toml", ".json"}
+
+// A named source of variables
+type Layer struct {
+	Name   string
+	Values map[string]string // Static values, e.g. from a file or flags
+	Lookup LookupFunc        // Used instead of Values when set, e.g. os.LookupEnv
+}
+
+func (l *Layer) lookup(key string) (string, bool) {
+	if l.Lookup != nil {
+		return l.Lookup(key)
+	}
+	value, ok := l.Values[key]
+	return value, ok
+}
+
+// Layers in increasing precedence, the last layer that sets a variable wins. Empty values count as unset.
+type Layers []Layer
+
+func (ls Layers) lookup(key string) (string, string, bool) {
+	for i := len(ls) - 1; i >= 0; i-- {
+		if value, ok := ls[i].lookup(key); ok && value != "" {
+			return value, ls[i].Name, true
+		}
+	}
+	return "", "", false
+}
+
+// Variables set by static layers that no field reads, usually typos
+func (ls Layers) unused(read map[string]bool) []string {
+	var unused []string
+	for _, layer := range ls {
+		for key := range layer.Values {
+			if !read[key] && key != configDirKey {
+				unused = append(unused, fmt.Sprintf("%s (%s)", key, layer.Name))
+			}
+		}
+	}
+	sort.Strings(unused)
+
+	return unused
+}
+
+// Where each variable of a loaded config came from
+type Report struct {
+	Entries  []ReportEntry `json:"entries"`
+	Unused   []string      `json:"unused"`   // Variables set in files or flags that no field reads
+	Warnings []string      `json:"warnings"` // Values that loaded but are likely mistakes, e.g. empty list entries
+}
+
+type ReportEntry struct {
+	Key    string `json:"key"`
+	Field  string `json:"field"`
+	Source string `json:"source"` // Name of the layer, SourceDefault, or empty if unset. Values read from a file name it in parentheses.
+	Value  string `json:"value"`  // Effective value once parsed, redacted for secret fields
+	Secret bool   `json:"secret"`
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIABLE\tFIELD\tSOURCE\tVALUE")
+	for _, entry := range r.Entries {
+		source := entry.Source
+		if source == "" {
+			source = "unset"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Key, entry.Field, source, entry.Value)
+	}
+	w.Flush()
+
+	for _, unused := range r.Unused {
+		fmt.Fprintf(&b, "unknown variable %s\n", unused)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&b, "warning: %s\n", warning)
+	}
+
+	return b.String()
+}
+
+// Holds the config directory when it is not set on Sources
+const configDirKey = "CONFIG_DIR"
+
+// Where configuration is read from, in increasing precedence after the defaults of struct tags:
+// the base file config.<ext>, the profile file config.<profile>.<ext>, env variables and flags.
+// Files are YAML, TOML or JSON, looked up in Dir.
+type Sources struct {
+	Dir     string            // Falls back to CONFIG_DIR from flags or env, files are skipped if neither is set
+	Profile string            // Usually ENV, e.g. "production" reads config.production.yaml
+	Flags   map[string]string // See ParseFlags
+}
+
+func (s *Sources) Layers() (Layers, error) {
+	dir := s.dir()
+
+	var layers Layers
+
+	if dir != "" {
+		names := []string{"config"}
+		if s.Profile != "" {
+			names = append(names, "config."+strings.ToLower(s.Profile))
+		}
+
+		for _, name := range names {
+			path, err := findFile(dir, name)
+			if err != nil {
+				return nil, err
+			}
+			if path == "" {
+				continue
+			}
+
+			layer, err := FileLayer(path)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, layer)
+		}
+	}
+
+	layers = append(layers, Layer{Name: SourceEnv, Lookup: os.LookupEnv})
+
+	if len(s.Flags) > 0 {
+		layers = append(layers, Layer{Name: SourceFlag, Values: s.Flags})
+	}
+
+	return layers, nil
+}
+
+func (s *Sources) dir() string {
+	if s.Dir != "" {
+		return s.Dir
+	}
+	if dir := s.Flags[configDirKey]; dir != "" {
+		return dir
+	}
+	return os.Getenv(configDirKey)
+}
+
+// Path of dir/name with one of the supported extensions, empty if there is none
+func findFile(dir, name string) (string, error) {
+	var found string
+	for _, ext := range fileExtensions {
+		path := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		if found != "" {
+			return "", fmt.Errorf("config files %s and %s are ambiguous, keep one", found, path)
+		}
+		found = path
+	}
+	return found, nil
+}
+
+// Reads a YAML, TOML or JSON file into a layer named after its path.
+// Nested keys are joined with "_" and upper cased, so `sql: {host: db}` sets SQL_HOST like the env variable would.
+// Lists are joined with ",".
+func FileLayer(path string) (Layer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Layer{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var tree map[string]any
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	case ".json":
+		err = json.Unmarshal(data, &tree)
+	default:
+		return Layer{}, fmt.Errorf("unsupported config file %s", path)
+	}
+	if err != nil {
+		return Layer{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten("", tree, values); err != nil {
+		return Layer{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return Layer{Name: path, Values: values}, nil
+}
+
+func flatten(key string, value any, values map[string]string) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		for k, child := range v {
+			if err := flatten(joinKey(key, k), child, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			scalar, err := scalarString(key, item)
+			if err != nil {
+				return err
+			}
+			items = append(items, scalar)
+		}
+		return setFlat(key, strings.Join(items, ","), values)
+	default:
+		scalar, err := scalarString(key, v)
+		if err != nil {
+			return err
+		}
+		return setFlat(key, scalar, values)
+	}
+}
+
+func setFlat(key, value string, values map[string]string) error {
+	if _, ok := values[key]; ok {
+		return fmt.Errorf("%s is set more than once", key)
+	}
+	values[key] = value
+	return nil
+}
+
+func scalarString(key string, value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("%s has unsupported value %v", key, value)
+	}
+}
+
+func joinKey(prefix, key string) string {
+	key = strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+	if prefix == "" {
+		return key
+	}
+	return prefix + "_" + key
+}
+
+// Parses command line arguments like --sql-host=db or --sql-host db into variables, e.g. SQL_HOST=db.
+// Flags without a value are set to "true". Flags of bool fields of Config never take the next argument as their value,
+// so --session-cookie-secure=false has to be written with "=". Returns the arguments that are not flags.
+func ParseFlags(args []string) (map[string]string, []string, error) {
+	flags := make(map[string]string)
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			rest = append(rest, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "" {
+			return nil, nil, fmt.Errorf("invalid flag %q", arg)
+		}
+
+		key := joinKey("", name)
+
+		if !hasValue {
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") && !boolKeys()[key] {
+				value = args[i+1]
+				i++
+			} else {
+				value = "true"
+			}
+		}
+
+		flags[key] = value
+	}
+
+	return flags, rest, nil
+}
+
+// Variables of the bool fields of Config
+var boolKeys = sync.OnceValue(func() map[string]bool {
+	keys := make(map[string]bool)
+	collectBoolKeys(reflect.TypeOf(Config{}), "", keys)
+	return keys
+})
+
+func collectBoolKeys(t reflect.Type, prefix string, keys map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		key, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct && !isLeaf(field.Type) {
+				collectBoolKeys(field.Type, prefix+field.Tag.Get("prefix"), keys)
+			}
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Bool {
+			keys[prefix+key] = true
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadLayers_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "config.yaml", `
+name: base
+timeout: 10s
+origins: [https://a.example.com, https://b.example.com]
+db:
+  host: base-db
+  port: 5433
+replica-db:
+  host: base-replica
+`)
+	writeFile(t, dir, "config.production.toml", `
+mode = "safe" # Comments are ignored
+[db]
+host = "production-db"
+`)
+
+	t.Setenv(configDirKey, dir)
+	t.Setenv("DB_HOST", "env-db")
+	t.Setenv("DEBUG", "true")
+
+	layers, err := (&Sources{Profile: "PRODUCTION", Flags: map[string]string{"DEBUG": "false", "RATIO": "0.9"}}).Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg testConfig
+	report, err := LoadLayers(layers, "", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := testConfig{
+		Name:    "base",
+		Timeout: 10 * time.Second,
+		Ratio:   0.9,
+		Origins: []string{"https://a.example.com", "https://b.example.com"},
+		Mode:    "safe",
+		Primary: testDatabaseConfig{Host: "env-db", Port: 5433},
+		Replica: testDatabaseConfig{Host: "base-replica", Port: 5432},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+
+	sources := make(map[string]string)
+	for _, entry := range report.Entries {
+		sources[entry.Key] = entry.Source
+	}
+
+	base, profile := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "config.production.toml")
+	for key, source := range map[string]string{
+		"NAME":            base,
+		"MODE":            profile,
+		"DB_HOST":         SourceEnv,
+		"DEBUG":           SourceFlag,
+		"DB_PORT":         base,
+		"REPLICA_DB_PORT": SourceDefault,
+		"ENDPOINT":        "",
+	} {
+		if sources[key] != source {
+			t.Errorf("expected %s to come from %q, got %q", key, source, sources[key])
+		}
+	}
+}
+
+func TestLoadLayers_Unused(t *testing.T) {
+	layers := Layers{
+		{Name: "config.yaml", Values: map[string]string{"DB_HOST": "db", "DB_HSOT": "typo"}},
+		{Name: SourceFlag, Values: map[string]string{"REPLICA_DB_HOST": "replica", "VERBOSE": "true"}},
+	}
+
+	var cfg testConfig
+	report, err := LoadLayers(layers, "", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"DB_HSOT (config.yaml)", "VERBOSE (flag)"}
+	if !reflect.DeepEqual(report.Unused, expected) {
+		t.Errorf("expected unused %v, got %v", expected, report.Unused)
+	}
+
+	if s := report.String(); !strings.Contains(s, "unknown variable DB_HSOT (config.yaml)") {
+		t.Errorf("expected the report to list unknown variables, got %q", s)
+	}
+}
+
+func TestFileLayer(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": "sql:\n  host: db\n  port: 5432\nallowed-origins:\n  - a\n  - b\nuse_tls: true\n",
+		"config.toml": "allowed-origins = [\n  \"a\",\n  'b',\n]\nuse_tls = true\n\n[sql]\nhost = \"db\"\nport = 5_432\n",
+		"config.json": `{"sql": {"host": "db", "port": 5432}, "allowed-origins": ["a", "b"], "use_tls": true}`,
+	}
+
+	expected := map[string]string{"SQL_HOST": "db", "SQL_PORT": "5432", "ALLOWED_ORIGINS": "a,b", "USE_TLS": "true"}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			writeFile(t, dir, name, content)
+
+			layer, err := FileLayer(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(layer.Values, expected) {
+				t.Errorf("expected %v, got %v", expected, layer.Values)
+			}
+		})
+	}
+
+	t.Run("Duplicate keys", func(t *testing.T) {
+		writeFile(t, dir, "duplicate.yaml", "sql_host: a\nsql:\n  host: b\n")
+		if _, err := FileLayer(filepath.Join(dir, "duplicate.yaml")); err == nil {
+			t.Error("expected an error for a variable set twice")
+		}
+	})
+
+	t.Run("Ambiguous files", func(t *testing.T) {
+		if _, err := (&Sources{Dir: dir}).Layers(); err == nil {
+			t.Error("expected an error for config files with different extensions")
+		}
+	})
+}
+
+func TestFileLayer_InvalidTOML(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, content := range []string{
+		"key",
+		"key = ",
+		"key = \"unterminated",
+		"key = [1, 2",
+		"a = 1\na = 2",
+		"a = 1\n[a]",
+		"[[servers]]\nhost = \"a\"", // Valid TOML, but there is no variable to flatten it to
+		// Forms a lenient parser may accept but TOML does not
+		"port = 010",
+		"host = \"\\a\"",
+		"host = db",
+	} {
+		writeFile(t, dir, "config.toml", content)
+
+		if _, err := FileLayer(filepath.Join(dir, "config.toml")); err == nil {
+			t.Errorf("expected an error decoding %q", content)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	flags, rest, err := ParseFlags([]string{"dump", "--sql-host=db", "--port", "9000", "-debug", "--verbose", "--", "--not-a-flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"SQL_HOST": "db", "PORT": "9000", "DEBUG": "true", "VERBOSE": "true"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Errorf("expected flags %v, got %v", expected, flags)
+	}
+
+	if !reflect.DeepEqual(rest, []string{"dump", "--not-a-flag"}) {
+		t.Errorf("unexpected arguments %v", rest)
+	}
+}
+
+// Flags of bool fields don't take the next argument, which would otherwise be lost as a command
+func TestParseFlags_Bool(t *testing.T) {
+	tests := []struct {
+		args  []string
+		flags map[string]string
+		rest  []string
+	}{
+		{args: []string{"--session-cookie-secure", "config", "dump"}, flags: map[string]string{"SESSION_COOKIE_SECURE": "true"}, rest: []string{"config", "dump"}},
+		{args: []string{"--session-cookie-secure=false", "config"}, flags: map[string]string{"SESSION_COOKIE_SECURE": "false"}, rest: []string{"config"}},
+		{args: []string{"--session-cookie-name", "sid", "config"}, flags: map[string]string{"SESSION_COOKIE_NAME": "sid"}, rest: []string{"config"}},
+		{args: []string{"--session-cookie-name", "--session-cookie-secure"}, flags: map[string]string{"SESSION_COOKIE_NAME": "true", "SESSION_COOKIE_SECURE": "true"}},
+	}
+
+	for _, tt := range tests {
+		flags, rest, err := ParseFlags(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(flags, tt.flags) || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("%v: expected %v and %v, got %v and %v", tt.args, tt.flags, tt.rest, flags, rest)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+)
+
+var ErrRequired = errors.New("is required")
+
+// Shown instead of the value of secret fields
+const Redacted = "[REDACTED]"
+
+// Prefix of values read from a file, e.g. file:///run/secrets/db_password
+const filePrefix = "file://"
+
+// Suffix of variables naming a file to read the value from, e.g. SQL_PASSWORD_FILE
+const fileSuffix = "_FILE"
+
+// Looks up the raw value of a variable, like os.LookupEnv
+type LookupFunc func(key string) (string, bool)
+
+// A variable that is missing, can not be parsed or fails validation
+type FieldError struct {
+	Key   string // Variable name, including prefixes
+	Field string // Struct field, e.g. Config.SQL.Host
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Key + " " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Every problem found while loading a config, so they can all be fixed at once
+type LoadError struct {
+	Errors []*FieldError
+}
+
+func (e *LoadError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+func (e *LoadError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Implemented by configs that derive values from other fields once loaded
+type finalizer interface {
+	finalize()
+}
+
+// Implemented by configs that can tell suspicious combinations of values apart, reported as warnings
+type warner interface {
+	warnings() []string
+}
+
+// Fills the struct pointed to by v from env variables, following the tags of its fields:
+//
+//	env:"PORT"         variable to read, fields without it are left untouched
+//	default:"8080"     used when the variable is unset or empty
+//	required:"true"    the variable must be set when there is no default and the field is empty
+//	sep:","            separator of slice values, "," if omitted
+//	prefix:"SQL_"      on nested structs, prepended to the variables of their fields
+//	secret:"true"      the value is redacted from reports and errors
+//
+// A value like file:///run/secrets/db_password is replaced with the content of that file, and so is an unset
+// variable when the same variable suffixed with _FILE names a file, e.g. SQL_PASSWORD_FILE. Trailing newlines are trimmed.
+//
+// Strings, bools, numbers, time.Duration, url.URL, encoding.TextUnmarshaler and slices of those are supported.
+// The loaded struct is then checked against its validate tags with utils.Validate.
+// Every bad or missing variable is returned together in a *LoadError.
+func Load(v any) error {
+	return LoadFrom(os.LookupEnv, "", v)
+}
+
+// Like Load, prepending prefix to every variable
+func LoadPrefix(prefix string, v any) error {
+	return LoadFrom(os.LookupEnv, prefix, v)
+}
+
+// Like LoadPrefix, reading variables through lookup instead of the environment
+func LoadFrom(lookup LookupFunc, prefix string, v any) error {
+	_, err := LoadLayers(Layers{{Name: SourceEnv, Lookup: lookup}}, prefix, v)
+	return err
+}
+
+// Like LoadPrefix, reading each variable from the last of layers that sets it, and reporting which layer that was
+func LoadLayers(layers Layers, prefix string, v any) (*Report, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: expected a pointer to a struct, got %T", v)
+	}
+
+	l := &loader{layers: layers, report: &Report{}, keys: make(map[string]string), read: make(map[string]bool), failed: make(map[string]bool)}
+	l.load(value.Elem(), prefix, value.Elem().Type().Name())
+	l.report.Unused = layers.unused(l.read)
+
+	if err := utils.Validate.Struct(v); err != nil {
+		var validationErrs validator.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			return nil, fmt.Errorf("failed to validate config: %w", err)
+		}
+
+		for _, validationErr := range validationErrs {
+			l.validationError(validationErr)
+		}
+	}
+
+	if len(l.errors) > 0 {
+		return l.report, &LoadError{Errors: l.errors}
+	}
+
+	return l.report, nil
+}
+
+// Loads the config of a single component, exiting if it is invalid
+func mustLoad(prefix string, v any) {
+	if err := LoadPrefix(prefix, v); err != nil {
+		zap.L().Fatal("Invalid configuration", zap.Error(err))
+	}
+}
+
+type loader struct {
+	layers Layers
+	report *Report
+	errors []*FieldError
+
+	keys   map[string]string // Struct namespace to variable, to report validation errors by variable
+	read   map[string]bool   // Every variable looked up, including _FILE variants
+	failed map[string]bool   // Fields that failed to load are not validated again
+}
+
+func (l *loader) load(value reflect.Value, prefix, namespace string) {
+	valueType := value.Type()
+	// Report entries of this struct's fields, by index as nested structs add theirs in between
+	type fieldEntry struct {
+		index int
+		value reflect.Value
+	}
+	var entries []fieldEntry
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		fieldNamespace := namespace + "." + field.Name
+
+		key, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct && !isLeaf(field.Type) {
+				l.load(fieldValue, prefix+field.Tag.Get("prefix"), fieldNamespace)
+			}
+			continue
+		}
+
+		key = prefix + key
+		secret := field.Tag.Get("secret") == "true"
+		l.keys[fieldNamespace] = key
+		l.read[key] = true
+		l.read[key+fileSuffix] = true
+
+		raw, source, ok, err := l.lookup(key)
+		if err != nil {
+			l.fail(key, fieldNamespace, err)
+			continue
+		}
+		if !ok {
+			if raw, ok = field.Tag.Lookup("default"); ok {
+				source = SourceDefault
+			}
+		}
+
+		if !ok {
+			if field.Tag.Get("required") == "true" && fieldValue.IsZero() {
+				l.fail(key, fieldNamespace, ErrRequired)
+			}
+		} else {
+			l.warn(key, raw, field.Tag.Get("sep"), fieldValue.Kind() == reflect.Slice)
+
+			if err := setValue(fieldValue, raw, field.Tag.Get("sep")); err != nil {
+				if secret {
+					// Parse errors quote the value
+					err = errors.New("is not valid")
+				}
+				l.fail(key, fieldNamespace, err)
+			}
+		}
+
+		entries = append(entries, fieldEntry{len(l.report.Entries), fieldValue})
+		l.report.Entries = append(l.report.Entries, ReportEntry{Key: key, Field: fieldNamespace, Source: source, Secret: secret})
+	}
+
+	if value.CanAddr() {
+		if f, ok := value.Addr().Interface().(finalizer); ok {
+			f.finalize()
+		}
+		if w, ok := value.Addr().Interface().(warner); ok {
+			l.report.Warnings = append(l.report.Warnings, w.warnings()...)
+		}
+	}
+
+	// Values are reported once finalized
+	for _, field := range entries {
+		entry := &l.report.Entries[field.index]
+
+		switch {
+		case !entry.Secret:
+			entry.Value = formatValue(field.value)
+		case !field.value.IsZero():
+			entry.Value = Redacted
+		}
+
+		if (entry.Key == "PORT" || strings.HasSuffix(entry.Key, "_PORT")) && (entry.Source == "" || entry.Source == SourceDefault) {
+			l.report.Warnings = append(l.report.Warnings, fmt.Sprintf("%s is not set, using %q", entry.Key, entry.Value))
+		}
+	}
+}
+
+// Values that load but are likely mistakes
+func (l *loader) warn(key, raw, sep string, list bool) {
+	if !list {
+		if raw != strings.TrimSpace(raw) {
+			l.report.Warnings = append(l.report.Warnings, key+" has leading or trailing whitespace")
+		}
+		return
+	}
+
+	if sep == "" {
+		sep = ","
+	}
+	for _, item := range strings.Split(raw, sep) {
+		if strings.TrimSpace(item) == "" {
+			l.report.Warnings = append(l.report.Warnings, key+" has empty list entries, they are ignored")
+			return
+		}
+	}
+}
+
+// Looks up key, then key_FILE, resolving file references
+func (l *loader) lookup(key string) (string, string, bool, error) {
+	raw, source, ok := l.layers.lookup(key)
+	fileRaw, fileSource, fileOK := l.layers.lookup(key + fileSuffix)
+
+	switch {
+	case ok && fileOK:
+		return "", "", false, fmt.Errorf("can not be set together with %s%s", key, fileSuffix)
+	case fileOK:
+		raw, source, ok = filePrefix+fileRaw, fileSource, true
+	case !ok:
+		return "", "", false, nil
+	}
+
+	if !strings.HasPrefix(raw, filePrefix) {
+		return raw, source, true, nil
+	}
+
+	path := strings.TrimPrefix(raw, filePrefix)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), source + " (" + path + ")", true, nil
+}
+
+func (l *loader) fail(key, namespace string, err error) {
+	l.errors = append(l.errors, &FieldError{Key: key, Field: namespace, Err: err})
+	l.failed[namespace] = true
+}
+
+func (l *loader) validationError(err validator.FieldError) {
+	namespace := err.StructNamespace()
+	if l.failed[namespace] {
+		return
+	}
+
+	// Elements of a list are reported by the variable of the list
+	key, ok := l.keys[namespace]
+	if i := strings.LastIndex(namespace, "["); !ok && i > 0 {
+		key, ok = l.keys[namespace[:i]]
+	}
+	if !ok {
+		key = namespace
+	}
+
+	rule := err.Tag()
+	if err.Param() != "" {
+		rule += "=" + err.Param()
+	}
+
+	l.fail(key, namespace, fmt.Errorf("must satisfy %s", rule))
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Structs that are parsed from a single variable rather than walked
+func isLeaf(t reflect.Type) bool {
+	return t == urlType || reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// Effective value of a field as shown in reports
+func formatValue(value reflect.Value) string {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	switch {
+	case value.Type() == urlType:
+		u := value.Interface().(url.URL)
+		if u == (url.URL{}) {
+			return ""
+		}
+		return u.Redacted()
+	case value.Kind() == reflect.Slice:
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = formatValue(value.Index(i))
+		}
+		return fmt.Sprintf("%q", items)
+	}
+
+	return fmt.Sprint(value.Interface())
+}
+
+func setValue(value reflect.Value, raw, sep string) error {
+	if value.Kind() == reflect.Pointer {
+		elem := reflect.New(value.Type().Elem())
+		if err := setValue(elem.Elem(), raw, sep); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	}
+
+	switch {
+	case value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("is not a valid duration: %q", raw)
+		}
+		value.SetInt(int64(d))
+		return nil
+	case value.Type() == urlType:
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("is not a valid absolute URL: %q", raw)
+		}
+		value.Set(reflect.ValueOf(*u))
+		return nil
+	case reflect.PointerTo(value.Type()).Implements(textUnmarshalerType):
+		if err := value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw)); err != nil {
+			return fmt.Errorf("is not valid: %w", err)
+		}
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("is not a valid bool: %q", raw)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("is not a valid integer: %q", raw)
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("is not a valid unsigned integer: %q", raw)
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("is not a valid number: %q", raw)
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		if sep == "" {
+			sep = ","
+		}
+
+		parts := splitNonEmpty(raw, sep)
+		slice := reflect.MakeSlice(value.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), part, sep); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+	default:
+		return fmt.Errorf("has unsupported type %s", value.Type())
+	}
+
+	return nil
+}
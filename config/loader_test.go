@@ -0,0 +1,290 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testDatabaseConfig struct {
+	Host string `env:"HOST" required:"true"`
+	Port int    `env:"PORT" default:"5432" validate:"gt=0,lt=65536"`
+}
+
+type testConfig struct {
+	Name     string        `env:"NAME" default:"go-plate"`
+	Debug    bool          `env:"DEBUG"`
+	Timeout  time.Duration `env:"TIMEOUT" default:"5s"`
+	Ratio    float64       `env:"RATIO" default:"0.5"`
+	Origins  []string      `env:"ORIGINS"`
+	Ports    []int         `env:"PORTS" sep:";"`
+	Endpoint *url.URL      `env:"ENDPOINT"`
+	Mode     string        `env:"MODE" default:"fast" validate:"oneof=fast safe"`
+
+	Primary  testDatabaseConfig `prefix:"DB_"`
+	Replica  testDatabaseConfig `prefix:"REPLICA_DB_"`
+	internal string
+}
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+func lookup(vars map[string]string) LookupFunc {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func TestLoadFrom(t *testing.T) {
+	var cfg testConfig
+	err := LoadFrom(lookup(map[string]string{
+		"APP_DEBUG":           "true",
+		"APP_TIMEOUT":         "",
+		"APP_ORIGINS":         "https://a.example.com, ,https://b.example.com",
+		"APP_PORTS":           "80;443",
+		"APP_ENDPOINT":        "https://api.example.com/v1",
+		"APP_DB_HOST":         "primary",
+		"APP_REPLICA_DB_HOST": "replica",
+		"APP_REPLICA_DB_PORT": "5433",
+	}), "APP_", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := testConfig{
+		Name:     "go-plate",
+		Debug:    true,
+		Timeout:  5 * time.Second,
+		Ratio:    0.5,
+		Origins:  []string{"https://a.example.com", "https://b.example.com"},
+		Ports:    []int{80, 443},
+		Endpoint: &url.URL{Scheme: "https", Host: "api.example.com", Path: "/v1"},
+		Mode:     "fast",
+		Primary:  testDatabaseConfig{Host: "primary", Port: 5432},
+		Replica:  testDatabaseConfig{Host: "replica", Port: 5433},
+	}
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+}
+
+func TestLoadFrom_AggregatesErrors(t *testing.T) {
+	var cfg testConfig
+	err := LoadFrom(lookup(map[string]string{
+		"DEBUG":      "maybe",
+		"TIMEOUT":    "5",
+		"PORTS":      "80;http",
+		"ENDPOINT":   "/relative",
+		"MODE":       "reckless",
+		"DB_HOST":    "primary",
+		"DB_PORT":    "70000",
+		"REPLICA_DB": "ignored",
+	}), "", &cfg)
+
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("expected a *LoadError, got %v", err)
+	}
+
+	keys := make([]string, 0, len(loadErr.Errors))
+	for _, fieldErr := range loadErr.Errors {
+		keys = append(keys, fieldErr.Key)
+	}
+
+	expected := []string{"DEBUG", "TIMEOUT", "PORTS", "ENDPOINT", "REPLICA_DB_HOST", "MODE", "DB_PORT"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected errors for %v, got %v", expected, keys)
+	}
+
+	if !errors.Is(err, ErrRequired) {
+		t.Error("expected the missing REPLICA_DB_HOST to be reported as ErrRequired")
+	}
+
+	if message := err.Error(); !strings.Contains(message, `DEBUG is not a valid bool: "maybe"`) || !strings.Contains(message, "MODE must satisfy oneof=fast safe") {
+		t.Errorf("unexpected error message %q", message)
+	}
+}
+
+func TestLoadFrom_KeepsUnsetFields(t *testing.T) {
+	cfg := testConfig{Debug: true, Primary: testDatabaseConfig{Host: "preset"}, Replica: testDatabaseConfig{Host: "preset"}}
+	if err := LoadFrom(lookup(nil), "", &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.Debug || cfg.Primary.Host != "preset" {
+		t.Errorf("expected fields without a variable or default to keep their value, got %+v", cfg)
+	}
+}
+
+func TestLoadFrom_Finalize(t *testing.T) {
+	var cfg SessionConfig
+	if err := LoadFrom(lookup(map[string]string{"SESSION_ABSOLUTE_TIMEOUT": "1h", "SESSION_SECRETS": testSessionSecret}), "SESSION_", &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.IdleTimeout != time.Hour || !cfg.CookieSecure {
+		t.Errorf("expected idle timeout capped to 1h and secure cookies by default, got %v and %v", cfg.IdleTimeout, cfg.CookieSecure)
+	}
+}
+
+func TestSessionConfig_Secrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets *string
+		err     string
+	}{
+		{name: "Unset", err: "SESSION_SECRETS is required"},
+		{name: "Empty", secrets: ptr(""), err: "SESSION_SECRETS is required"},
+		{name: "Only separators", secrets: ptr(" , "), err: "SESSION_SECRETS must satisfy min=1"},
+		{name: "Too short", secrets: ptr("change-me"), err: "SESSION_SECRETS must satisfy min=32"},
+		{name: "Previous secret too short", secrets: ptr(testSessionSecret + ",old"), err: "SESSION_SECRETS must satisfy min=32"},
+		{name: "Valid", secrets: ptr(testSessionSecret + "," + strings.Repeat("x", 32))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{}
+			if tt.secrets != nil {
+				vars["SESSION_SECRETS"] = *tt.secrets
+			}
+
+			var cfg SessionConfig
+			err := LoadFrom(lookup(vars), "SESSION_", &cfg)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+			if tt.secrets != nil && *tt.secrets != "" && strings.Contains(err.Error(), *tt.secrets) {
+				t.Errorf("expected the secrets not to be in the error, got %q", err)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestLoadFrom_InvalidTarget(t *testing.T) {
+	var cfg testConfig
+	if err := LoadFrom(lookup(nil), "", cfg); err == nil {
+		t.Error("expected an error for a non-pointer target")
+	}
+}
+
+type testSecretConfig struct {
+	Password string `env:"PASSWORD" secret:"true"`
+	Token    string `env:"TOKEN" secret:"true"`
+	Port     int    `env:"PORT" secret:"true"`
+	User     string `env:"USER"`
+}
+
+func TestLoadFrom_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "password", "from-file\n")
+	writeFile(t, dir, "token", "token-from-file")
+
+	var cfg testSecretConfig
+	report, err := LoadLayers(Layers{{Name: SourceEnv, Lookup: lookup(map[string]string{
+		"PASSWORD":   "file://" + filepath.Join(dir, "password"),
+		"TOKEN_FILE": filepath.Join(dir, "token"),
+		"USER":       "alice",
+	})}}, "", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Password != "from-file" || cfg.Token != "token-from-file" || cfg.User != "alice" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	for _, entry := range report.Entries {
+		if entry.Secret && entry.Value != "" && entry.Value != Redacted {
+			t.Errorf("expected %s to be redacted, got %q", entry.Key, entry.Value)
+		}
+	}
+
+	if s := report.String(); strings.Contains(s, "from-file") || !strings.Contains(s, "alice") || !strings.Contains(s, "env ("+filepath.Join(dir, "token")+")") {
+		t.Errorf("expected secrets redacted and file sources named, got %q", s)
+	}
+}
+
+func TestLoadFrom_SecretErrors(t *testing.T) {
+	var cfg testSecretConfig
+	err := LoadFrom(lookup(map[string]string{
+		"PASSWORD":      "hunter2",
+		"PASSWORD_FILE": "/run/secrets/password",
+		"TOKEN":         "file:///does/not/exist",
+		"PORT":          "hunter2",
+	}), "", &cfg)
+
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) || len(loadErr.Errors) != 3 {
+		t.Fatalf("expected 3 errors, got %v", err)
+	}
+
+	if message := err.Error(); strings.Contains(message, "hunter2") || !strings.Contains(message, "PASSWORD can not be set together with PASSWORD_FILE") {
+		t.Errorf("unexpected error message %q", message)
+	}
+}
+
+func TestSQLGormConfig_DSN(t *testing.T) {
+	cfg := SQLGormConfig{
+		SSLMode:      "verify-full",
+		SSLRootCert:  "/certs/ca.pem",
+		SSLCert:      "/certs/client.pem",
+		SSLKey:       "/certs/client.key",
+		Host:         "db",
+		Port:         "5432",
+		Username:     "postgres",
+		Password:     `it's a \secret`,
+		DatabaseName: "app",
+	}
+
+	expected := `host='db' port='5432' user='postgres' password='it\'s a \\secret' dbname='app' sslmode='verify-full' ` +
+		`sslrootcert='/certs/ca.pem' sslcert='/certs/client.pem' sslkey='/certs/client.key'`
+	if dsn := cfg.DSN(); dsn != expected {
+		t.Errorf("expected %s, got %s", expected, dsn)
+	}
+}
+
+func TestLoadLayers_Warnings(t *testing.T) {
+	var cfg APIConfig
+	report, err := LoadLayers(Layers{{Name: SourceEnv, Lookup: lookup(map[string]string{
+		"ALLOWED_ORIGINS":   "*,",
+		"ALLOW_CREDENTIALS": "true",
+		"HOST":              "localhost ",
+	})}}, "", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"HOST has leading or trailing whitespace",
+		"ALLOWED_ORIGINS has empty list entries, they are ignored",
+		"ALLOWED_ORIGINS allows any origin to make credentialed requests, as ALLOW_CREDENTIALS is true",
+		`PORT is not set, using "8080"`,
+	}
+	if !reflect.DeepEqual(report.Warnings, expected) {
+		t.Errorf("expected warnings %q, got %q", expected, report.Warnings)
+	}
+
+	values := make(map[string]string)
+	for _, entry := range report.Entries {
+		values[entry.Key] = entry.Value
+	}
+	if values["ALLOWED_ORIGINS"] != `["*"]` || values["SHUTDOWN_TIMEOUT"] != "0s" || values["ALLOW_CREDENTIALS"] != "true" {
+		t.Errorf("expected effective values in the report, got %v", values)
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"time"
+)
+
+type MailConfig struct {
+	Transport string `env:"MAIL_TRANSPORT" validate:"omitempty,oneof=smtp file"` // Defaults to "file" for ENV=LOCAL and "smtp" otherwise
+	From      string `env:"MAIL_FROM" default:"go-plate <no-reply@localhost>"`
+
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     string `env:"SMTP_PORT" default:"587" validate:"numeric"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD" secret:"true"`
+	SMTPTLS      string `env:"SMTP_TLS" default:"starttls" validate:"oneof=starttls tls none"` // "tls" is implicit TLS, usually port 465
+
+	FilePath string `env:"MAIL_FILE_PATH"` // File transport output, empty writes to stdout
+
+	QueueSize    int           `env:"MAIL_QUEUE_SIZE" default:"100" validate:"gt=0"`
+	Workers      int           `env:"MAIL_WORKERS" default:"2" validate:"gt=0"`
+	MaxRetries   int           `env:"MAIL_MAX_RETRIES" default:"3" validate:"gte=0"`
+	RetryBackoff time.Duration `env:"MAIL_RETRY_BACKOFF" default:"1s" validate:"gt=0"`
+
+	LinkBaseURL string `env:"MAIL_LINK_BASE_URL" default:"http://localhost:8080" validate:"url"` // Base URL of links sent by email, e.g. the frontend serving the password reset page
+}
+
+func NewMailConfig() *MailConfig {
+	cfg := &MailConfig{}
+	mustLoad("", cfg)
+	return cfg
+}
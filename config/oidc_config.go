@@ -0,0 +1,31 @@
+package config
+
+import (
+	"time"
+)
+
+type OIDCConfig struct {
+	// Login with an external identity provider is disabled while IssuerURL is empty
+	IssuerURL    string   `env:"ISSUER_URL" validate:"omitempty,url"`
+	ClientID     string   `env:"CLIENT_ID" validate:"required_with=IssuerURL"`
+	ClientSecret string   `env:"CLIENT_SECRET" secret:"true"` // Empty for public clients, PKCE protects the code exchange either way
+	RedirectURL  string   `env:"REDIRECT_URL" validate:"required_with=IssuerURL,omitempty,url"`
+	Scopes       []string `env:"SCOPES" default:"openid,email,profile"`
+
+	// Where users land after logging in through the provider
+	PostLoginURL string `env:"POST_LOGIN_URL" default:"/"`
+
+	// The state, nonce and PKCE verifier of a login in progress are kept in a short-lived cookie
+	CookieName   string        `env:"COOKIE_NAME" default:"oidc_auth"`
+	CookieSecure bool          `env:"COOKIE_SECURE" default:"true"` // Only disable for local dev over http
+	StateTTL     time.Duration `env:"STATE_TTL" default:"10m" validate:"gt=0"`
+
+	HTTPTimeout time.Duration `env:"HTTP_TIMEOUT" default:"10s" validate:"gt=0"`
+}
+
+// Reads OIDC_* variables
+func NewOIDCConfig() *OIDCConfig {
+	cfg := &OIDCConfig{}
+	mustLoad("OIDC_", cfg)
+	return cfg
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"time"
+)
+
+type OneTimeTokenConfig struct {
+	KeyPrefix string `env:"ONETIME_TOKEN_KEY_PREFIX" default:"onetime:"`
+
+	PasswordResetTTL     time.Duration `env:"PASSWORD_RESET_TTL" default:"30m" validate:"gt=0"`
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" default:"48h" validate:"gt=0"`
+	DefaultTTL           time.Duration `env:"ONETIME_TOKEN_TTL" default:"1h" validate:"gt=0"` // Used for any other purpose
+}
+
+func NewOneTimeTokenConfig() *OneTimeTokenConfig {
+	cfg := &OneTimeTokenConfig{}
+	mustLoad("", cfg)
+	return cfg
+}
@@ -0,0 +1,19 @@
+package config
+
+type PasswordConfig struct {
+	MinLength      int `env:"MIN_LENGTH" default:"8" validate:"gt=0"`
+	MaxLength      int `env:"MAX_LENGTH" default:"128" validate:"gtefield=MinLength"`
+	MinCharClasses int `env:"MIN_CHAR_CLASSES" default:"2" validate:"gte=0,lte=4"`
+	MinEntropyBits int `env:"MIN_ENTROPY_BITS" default:"40" validate:"gte=0"`
+
+	// Directory of SHA-1 hashes of breached passwords, bucketed by prefix like the Have I Been Pwned range API:
+	// one `PREFIX.txt` file per 5 character prefix with a `SUFFIX[:COUNT]` line per hash. Empty disables the check.
+	BreachedCorpusPath string `env:"BREACHED_CORPUS_PATH"`
+}
+
+// Reads PASSWORD_* variables
+func NewPasswordConfig() *PasswordConfig {
+	cfg := &PasswordConfig{}
+	mustLoad("PASSWORD_", cfg)
+	return cfg
+}
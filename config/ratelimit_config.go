@@ -0,0 +1,17 @@
+package config
+
+// Token bucket limits, rates are in requests per second and capacities are the burst allowed
+type RateLimitConfig struct {
+	AuthRate     float64 `env:"AUTH_RATE" default:"0.05" validate:"gt=0"` // Register, login and other unauthenticated user routes
+	AuthCapacity float64 `env:"AUTH_CAPACITY" default:"3" validate:"gte=1"`
+
+	PostsRate     float64 `env:"POSTS_RATE" default:"0.1" validate:"gt=0"`
+	PostsCapacity float64 `env:"POSTS_CAPACITY" default:"20" validate:"gte=1"`
+}
+
+// Reads RATE_LIMIT_* variables
+func NewRateLimitConfig() *RateLimitConfig {
+	cfg := &RateLimitConfig{}
+	mustLoad("RATE_LIMIT_", cfg)
+	return cfg
+}
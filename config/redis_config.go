@@ -1,24 +1,22 @@
 package config
 
-import (
-	"os"
-
-	"github.com/jose-lico/go-plate/utils"
-)
-
 type RedisConfig struct {
-	UseTLS bool
+	UseTLS bool `env:"USE_TLS"`
+	// CA certificate the server is verified against, the system pool is used when empty.
+	// A client certificate and key enable mutual TLS.
+	TLSCACert     string `env:"TLS_CA_CERT"`
+	TLSCert       string `env:"TLS_CERT" validate:"required_with=TLSKey"`
+	TLSKey        string `env:"TLS_KEY" validate:"required_with=TLSCert"`
+	TLSServerName string `env:"TLS_SERVER_NAME"` // Defaults to Host
 
-	Host     string
-	Port     string
-	Password string
+	Host     string `env:"HOST" required:"true"`
+	Port     string `env:"PORT" default:"6379" validate:"numeric"`
+	Password string `env:"PASSWORD" secret:"true"`
 }
 
+// Reads RD_* variables
 func NewRedisConfig() *RedisConfig {
-	return &RedisConfig{
-		UseTLS:   utils.GetEnvAsBool("RD_USE_TLS"),
-		Host:     os.Getenv("RD_HOST"),
-		Port:     os.Getenv("RD_PORT"),
-		Password: os.Getenv("RD_PASSWORD"),
-	}
+	cfg := &RedisConfig{}
+	mustLoad("RD_", cfg)
+	return cfg
 }
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+type SessionConfig struct {
+	CookieName     string `env:"COOKIE_NAME" default:"session"`
+	CookiePath     string `env:"COOKIE_PATH" default:"/"`
+	CookieDomain   string `env:"COOKIE_DOMAIN"`
+	CookieSecure   bool   `env:"COOKIE_SECURE" default:"true"` // Only disable for local dev over http
+	CookieSameSite string `env:"COOKIE_SAME_SITE" default:"strict"`
+
+	KeyPrefix string `env:"KEY_PREFIX" default:"session:"`
+	// Used to derive store keys from session tokens. The first secret is used for new sessions,
+	// the rest are only accepted so that secrets can be rotated. Each must be at least 32 characters.
+	Secrets []string `env:"SECRETS" secret:"true" required:"true" validate:"min=1,dive,min=32"`
+
+	// Sessions expire after IdleTimeout without activity, and never outlive AbsoluteTimeout.
+	// Activity is only written back to the store once every TouchInterval.
+	IdleTimeout     time.Duration `env:"IDLE_TIMEOUT" validate:"gte=0"`
+	AbsoluteTimeout time.Duration `env:"ABSOLUTE_TIMEOUT" default:"24h" validate:"gt=0"`
+	TouchInterval   time.Duration `env:"TOUCH_INTERVAL" default:"1m" validate:"gt=0"`
+
+	// Lifetime of the session issued after the password step of a login that still requires a second factor
+	MFATimeout time.Duration `env:"MFA_TIMEOUT" default:"5m" validate:"gt=0"`
+}
+
+// Reads SESSION_* variables
+func NewSessionConfig() *SessionConfig {
+	cfg := &SessionConfig{}
+	mustLoad("SESSION_", cfg)
+	return cfg
+}
+
+// The idle timeout defaults to, and is capped by, the absolute timeout
+func (c *SessionConfig) finalize() {
+	if c.IdleTimeout <= 0 || c.IdleTimeout > c.AbsoluteTimeout {
+		c.IdleTimeout = min(2*time.Hour, c.AbsoluteTimeout)
+	}
+}
+
+func splitNonEmpty(s, sep string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(s, sep) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -1,28 +1,52 @@
 package config
 
 import (
-	"os"
+	"fmt"
+	"strings"
 )
 
 type SQLGormConfig struct {
-	SSLMode     string
-	SSLCertPath string
-
-	Host         string
-	Port         string
-	Username     string
-	Password     string
-	DatabaseName string
+	SSLMode string `env:"SSL_MODE" default:"disable" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	// CA certificate the server is verified against, required by verify-ca and verify-full.
+	// A client certificate and key enable mutual TLS.
+	SSLRootCert string `env:"SSL_ROOT_CERT" validate:"required_if=SSLMode verify-ca,required_if=SSLMode verify-full"`
+	SSLCert     string `env:"SSL_CERT" validate:"required_with=SSLKey"`
+	SSLKey      string `env:"SSL_KEY" validate:"required_with=SSLCert"`
+
+	Host         string `env:"HOST" required:"true"`
+	Port         string `env:"PORT" default:"5432" validate:"numeric"`
+	Username     string `env:"USER" required:"true"`
+	Password     string `env:"PASSWORD" secret:"true"`
+	DatabaseName string `env:"NAME" required:"true"`
 }
 
+// Reads SQL_* variables
 func NewSQLConfig() *SQLGormConfig {
-	return &SQLGormConfig{
-		SSLMode:      os.Getenv("SQL_SSL_MODE"),
-		SSLCertPath:  os.Getenv("SQL_SSL_CERT_PATH"),
-		Host:         os.Getenv("SQL_HOST"),
-		Port:         os.Getenv("SQL_PORT"),
-		Username:     os.Getenv("SQL_USER"),
-		Password:     os.Getenv("SQL_PASSWORD"),
-		DatabaseName: os.Getenv("SQL_NAME"),
+	cfg := &SQLGormConfig{}
+	mustLoad("SQL_", cfg)
+	return cfg
+}
+
+// Connection string understood by both pgx and lib/pq
+func (c *SQLGormConfig) DSN() string {
+	params := []string{
+		"host=" + quoteDSN(c.Host),
+		"port=" + quoteDSN(c.Port),
+		"user=" + quoteDSN(c.Username),
+		"password=" + quoteDSN(c.Password),
+		"dbname=" + quoteDSN(c.DatabaseName),
+		"sslmode=" + quoteDSN(c.SSLMode),
+	}
+
+	for _, param := range [][2]string{{"sslrootcert", c.SSLRootCert}, {"sslcert", c.SSLCert}, {"sslkey", c.SSLKey}} {
+		if param[1] != "" {
+			params = append(params, param[0]+"="+quoteDSN(param[1]))
+		}
 	}
+
+	return strings.Join(params, " ")
+}
+
+func quoteDSN(value string) string {
+	return fmt.Sprintf("'%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value))
 }
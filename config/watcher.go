@@ -0,0 +1,166 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Called with the previous and the new config after every reload that changed something
+type Subscriber func(old, new *Config)
+
+// Reloads the config from its sources on SIGHUP or when a config file changes.
+// A new config replaces the current one only once it has loaded and validated, otherwise the current one is kept.
+// Components only see a reload through Config or a subscription, anything built once from the initial config needs a restart.
+type Watcher struct {
+	sources      *Sources
+	pollInterval time.Duration
+
+	current     atomic.Pointer[Config]
+	report      atomic.Pointer[Report]
+	mu          sync.Mutex // Serializes reloads and subscriber calls
+	subscribers []Subscriber
+}
+
+// Watches sources, which cfg and its report were loaded from. Config files are checked for changes every pollInterval, 0 disables it.
+func NewWatcher(sources *Sources, cfg *Config, report *Report, pollInterval time.Duration) *Watcher {
+	if sources == nil || cfg == nil || report == nil || pollInterval < 0 {
+		zap.L().Fatal("Invalid parameters for Watcher")
+	}
+
+	w := &Watcher{sources: sources, pollInterval: pollInterval}
+	w.current.Store(cfg)
+	w.report.Store(report)
+
+	return w
+}
+
+// The latest valid config, safe to call concurrently. It must not be modified.
+func (w *Watcher) Config() *Config {
+	return w.current.Load()
+}
+
+// Where each value of the latest valid config came from
+func (w *Watcher) Report() *Report {
+	return w.report.Load()
+}
+
+// Subscribers run one at a time, in the order they subscribed
+func (w *Watcher) Subscribe(fn Subscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Loads the config again, swapping it in and notifying subscribers if it is valid and changed
+func (w *Watcher) Reload() (*Report, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	layers, err := w.sources.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	report, err := LoadLayers(layers, "", cfg)
+	if err != nil {
+		return report, err
+	}
+
+	w.report.Store(report)
+
+	old := w.current.Load()
+	if reflect.DeepEqual(old, cfg) {
+		return report, nil
+	}
+
+	w.current.Store(cfg)
+	for _, fn := range w.subscribers {
+		fn(old, cfg)
+	}
+
+	return report, nil
+}
+
+// Reloads on SIGHUP and config file changes until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	w.RunWithSignals(ctx, hangup)
+}
+
+// Like Run, reloading on signals received from hangup. SIGHUP terminates the process until it is passed to signal.Notify,
+// so registering it before starting the server lets it reload the config at any point of startup.
+func (w *Watcher) RunWithSignals(ctx context.Context, hangup <-chan os.Signal) {
+	logger := zap.L()
+
+	var tick <-chan time.Time
+	if w.pollInterval > 0 {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lastFiles := w.files()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-hangup:
+			logger.Info("Received signal, reloading configuration", zap.Stringer("signal", sig))
+		case <-tick:
+			files := w.files()
+			if files == lastFiles {
+				continue
+			}
+			lastFiles = files
+			logger.Info("Configuration files changed, reloading configuration")
+		}
+
+		report, err := w.Reload()
+		if err != nil {
+			logger.Error("Invalid configuration, keeping the current one", zap.Error(err))
+			continue
+		}
+		for _, unused := range report.Unused {
+			logger.Warn("Unknown configuration variable", zap.String("variable", unused))
+		}
+		for _, warning := range report.Warnings {
+			logger.Warn("Suspicious configuration", zap.String("warning", warning))
+		}
+	}
+}
+
+// Fingerprint of the config files in the config directory, to detect changes without reading them
+func (w *Watcher) files() string {
+	dir := w.sources.dir()
+	if dir == "" {
+		return ""
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "config.*"))
+	sort.Strings(paths)
+
+	var fingerprint string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			fingerprint += fmt.Sprintf("%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return fingerprint
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const watcherBaseConfig = `
+sql: {host: db, user: postgres, name: app}
+rd: {host: redis}
+session: {secrets: [0123456789abcdef0123456789abcdef]}
+`
+
+func TestWatcher_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "config.yaml", watcherBaseConfig+"allowed_origins: [https://a.example.com]\n")
+
+	sources := &Sources{Dir: dir}
+	cfg, report, err := NewConfig(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewWatcher(sources, cfg, report, 0)
+
+	var calls int
+	watcher.Subscribe(func(old, new *Config) {
+		calls++
+		if !reflect.DeepEqual(old.API.AllowedOrigins, []string{"https://a.example.com"}) || !reflect.DeepEqual(new.API.AllowedOrigins, []string{"https://b.example.com"}) {
+			t.Errorf("unexpected origins %v -> %v", old.API.AllowedOrigins, new.API.AllowedOrigins)
+		}
+	})
+
+	// Nothing changed
+	if _, err := watcher.Reload(); err != nil || calls != 0 {
+		t.Fatalf("expected no notification without changes, got %d calls and %v", calls, err)
+	}
+
+	// Invalid configs are not swapped in
+	writeFile(t, dir, "config.yaml", watcherBaseConfig+"port: http\n")
+	if _, err := watcher.Reload(); err == nil || watcher.Config() != cfg || calls != 0 {
+		t.Fatalf("expected an invalid config to keep the current one, got %d calls and %v", calls, err)
+	}
+
+	writeFile(t, dir, "config.yaml", watcherBaseConfig+"allowed_origins: [https://b.example.com]\n")
+	if _, err := watcher.Reload(); err != nil || calls != 1 {
+		t.Fatalf("expected one notification, got %d calls and %v", calls, err)
+	}
+	if origins := watcher.Config().API.AllowedOrigins; !reflect.DeepEqual(origins, []string{"https://b.example.com"}) {
+		t.Errorf("expected the new config to be current, got %v", origins)
+	}
+}
+
+func TestWatcher_RunReloadsOnFileChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, dir, "config.yaml", watcherBaseConfig)
+
+	sources := &Sources{Dir: dir}
+	cfg, report, err := NewConfig(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewWatcher(sources, cfg, report, 10*time.Millisecond)
+
+	reloaded := make(chan *Config, 1)
+	watcher.Subscribe(func(old, new *Config) { reloaded <- new })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Run(ctx)
+
+	// Let Run take its first fingerprint, then change the file
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, dir, "config.yaml", watcherBaseConfig+"rate_limit: {auth_rate: 2}\n")
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cfg := <-reloaded:
+		if cfg.RateLimit.AuthRate != 2 {
+			t.Errorf("expected the new rate limit, got %v", cfg.RateLimit.AuthRate)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload after the config file changed")
+	}
+}
+
+func TestWatcher_RunWithSignals(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "config.yaml", watcherBaseConfig)
+
+	sources := &Sources{Dir: dir}
+	cfg, report, err := NewConfig(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewWatcher(sources, cfg, report, 0)
+
+	reloaded := make(chan *Config, 1)
+	watcher.Subscribe(func(old, new *Config) { reloaded <- new })
+
+	// Signals received before Run starts are not lost
+	hangup := make(chan os.Signal, 1)
+	writeFile(t, dir, "config.yaml", watcherBaseConfig+"rate_limit: {auth_rate: 2}\n")
+	hangup <- syscall.SIGHUP
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.RunWithSignals(ctx, hangup)
+
+	select {
+	case cfg := <-reloaded:
+		if cfg.RateLimit.AuthRate != 2 {
+			t.Errorf("expected the new rate limit, got %v", cfg.RateLimit.AuthRate)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload after the signal")
+	}
+}
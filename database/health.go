@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Satisfy api.HealthChecker, to be registered with APIServer.AddHealthCheck
+
+type RedisHealthCheck struct {
+	redis RedisStore
+}
+
+func NewRedisHealthCheck(redis RedisStore) *RedisHealthCheck {
+	return &RedisHealthCheck{redis: redis}
+}
+
+func (c *RedisHealthCheck) Name() string {
+	return "redis"
+}
+
+func (c *RedisHealthCheck) Check(ctx context.Context) error {
+	return c.redis.Ping(ctx)
+}
+
+type SQLGormHealthCheck struct {
+	db *gorm.DB
+}
+
+func NewSQLGormHealthCheck(db *gorm.DB) *SQLGormHealthCheck {
+	return &SQLGormHealthCheck{db: db}
+}
+
+func (c *SQLGormHealthCheck) Name() string {
+	return "postgres"
+}
+
+func (c *SQLGormHealthCheck) Check(ctx context.Context) error {
+	return c.db.WithContext(ctx).Exec("SELECT 1").Error
+}
@@ -2,7 +2,11 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
+	"os"
 	"time"
 
 	"github.com/jose-lico/go-plate/config"
@@ -21,8 +25,11 @@ type RedisStore interface {
 	Get(ctx context.Context, key string) (string, error)
 	SAdd(ctx context.Context, key string, value interface{}) error
 	SRem(ctx context.Context, key string, value interface{}) error
+	SMembers(ctx context.Context, key string) ([]string, error)
 	Del(ctx context.Context, key string) (int64, error)
+	Ping(ctx context.Context) error
 	GetNativeInstance() interface{}
+	Close() error
 }
 
 type Redis struct {
@@ -30,24 +37,25 @@ type Redis struct {
 }
 
 func NewRedis(cfg *config.RedisConfig, logger *zap.Logger) (RedisStore, error) {
-	url := fmt.Sprintf("redis%s://default:%s@%s:%s",
-		func() string {
-			if cfg.UseTLS {
-				return "s"
-			}
-			return ""
-		}(),
-		cfg.Password, cfg.Host, cfg.Port)
-
-	opt, err := redis.ParseURL(url)
+	opt := &redis.Options{
+		Addr:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Username: "default",
+		Password: cfg.Password,
+	}
 
-	if err != nil {
-		logger.Fatal("Error parsing Redis URL", zap.String("URL", url), zap.Error(err))
+	if cfg.UseTLS {
+		tlsConfig, err := newRedisTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opt.TLSConfig = tlsConfig
 	}
 
 	redis := redis.NewClient(opt)
 	ctx := context.Background()
 
+	var err error
+
 	for attempts := 0; attempts < maxAttempts; attempts++ {
 		if err = redis.Ping(ctx).Err(); err != nil {
 			if attempts+1 < maxAttempts {
@@ -63,6 +71,44 @@ func NewRedis(cfg *config.RedisConfig, logger *zap.Logger) (RedisStore, error) {
 	return nil, fmt.Errorf("failed to connect to Redis after %d attempts, error: %w", maxAttempts, err)
 }
 
+// Wraps an already connected client, e.g. one pointed at an in-memory server in tests
+func NewRedisFromClient(client *redis.Client) RedisStore {
+	return &Redis{redis: client}
+}
+
+// Verifies the server against TLSCACert when set, and presents TLSCert for mutual TLS
+func newRedisTLSConfig(cfg *config.RedisConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.TLSServerName,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.Host
+	}
+
+	if cfg.TLSCACert != "" {
+		pem, err := os.ReadFile(cfg.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA certificate: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis CA certificate %s", cfg.TLSCACert)
+		}
+	}
+
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 func (r *Redis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return r.redis.Set(ctx, key, value, expiration).Err()
 }
@@ -79,10 +125,22 @@ func (r *Redis) SRem(ctx context.Context, key string, value interface{}) error {
 	return r.redis.SRem(ctx, key, value).Err()
 }
 
+func (r *Redis) SMembers(ctx context.Context, key string) ([]string, error) {
+	return r.redis.SMembers(ctx, key).Result()
+}
+
 func (r *Redis) Del(ctx context.Context, key string) (int64, error) {
 	return r.redis.Del(ctx, key).Result()
 }
 
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.redis.Ping(ctx).Err()
+}
+
 func (r *Redis) GetNativeInstance() interface{} {
 	return r.redis
 }
+
+func (r *Redis) Close() error {
+	return r.redis.Close()
+}
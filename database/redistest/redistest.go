@@ -0,0 +1,111 @@
+package redistest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jose-lico/go-plate/database"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Starts an in-memory Redis server, closed when the test ends, and returns a RedisStore connected to it.
+// The server is returned to fast forward TTLs or inspect keys.
+func New(t testing.TB) (database.RedisStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return database.NewRedisFromClient(client), server
+}
+
+// Like New, but fails the test when a script changes a key it did not declare in KEYS. Redis Cluster and key-aware
+// proxies route scripts by their KEYS, so undeclared keys may live on another node. Commands must not run concurrently.
+func NewCheckingScriptKeys(t testing.TB) (database.RedisStore, *miniredis.Miniredis) {
+	store, server := New(t)
+	store.GetNativeInstance().(*redis.Client).AddHook(&scriptKeysHook{t: t, server: server})
+	return store, server
+}
+
+type scriptKeysHook struct {
+	t      testing.TB
+	server *miniredis.Miniredis
+}
+
+func (h *scriptKeysHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *scriptKeysHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (h *scriptKeysHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		name := cmd.Name()
+		if name != "eval" && name != "evalsha" {
+			return next(ctx, cmd)
+		}
+
+		// EVAL script numkeys key [key ...] arg [arg ...]
+		args := cmd.Args()
+		numKeys, _ := strconv.Atoi(fmt.Sprint(args[2]))
+		declared := make([]string, 0, numKeys)
+		for _, key := range args[3 : 3+numKeys] {
+			declared = append(declared, fmt.Sprint(key))
+		}
+
+		before := snapshot(h.server)
+		err := next(ctx, cmd)
+		after := snapshot(h.server)
+
+		for key := range before {
+			if before[key] != after[key] && !slices.Contains(declared, key) {
+				h.t.Errorf("script changed %s without declaring it in KEYS %v", key, declared)
+			}
+		}
+		for key := range after {
+			if _, ok := before[key]; !ok && !slices.Contains(declared, key) {
+				h.t.Errorf("script created %s without declaring it in KEYS %v", key, declared)
+			}
+		}
+
+		return err
+	}
+}
+
+// Type, TTL and contents of every key
+func snapshot(server *miniredis.Miniredis) map[string]string {
+	keys := make(map[string]string)
+
+	for _, key := range server.Keys() {
+		var value any
+		switch server.Type(key) {
+		case "string":
+			value, _ = server.Get(key)
+		case "set":
+			value, _ = server.Members(key)
+		case "list":
+			value, _ = server.List(key)
+		case "zset":
+			value, _ = server.SortedSet(key)
+		case "hash":
+			fields, _ := server.HKeys(key)
+			values := make([]string, 0, len(fields))
+			for _, field := range fields {
+				values = append(values, field+"="+server.HGet(key, field))
+			}
+			value = strings.Join(values, ",")
+		}
+
+		keys[key] = fmt.Sprintf("%s %v %v", server.Type(key), server.TTL(key), value)
+	}
+
+	return keys
+}
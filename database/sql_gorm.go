@@ -15,15 +15,7 @@ import (
 )
 
 func NewSQLGormDB(cfg *config.SQLGormConfig, logger *zap.Logger) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s%s",
-		cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.DatabaseName,
-		cfg.SSLMode,
-		func() string {
-			if cfg.SSLMode == "verify-full" {
-				return fmt.Sprintf(" sslrootcert=%s", "cert will be here in the future")
-			}
-			return ""
-		}())
+	dsn := cfg.DSN()
 
 	newLogger := gLogger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags),
@@ -54,3 +46,12 @@ func NewSQLGormDB(cfg *config.SQLGormConfig, logger *zap.Logger) (*gorm.DB, erro
 
 	return nil, fmt.Errorf("failed to connect to Postgres after %d attempts, error: %w", maxAttempts, err)
 }
+
+func CloseSQLGormDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
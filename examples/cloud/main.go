@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,7 +19,7 @@ func main() {
 		fmt.Fprintf(w, "Hello World!!!")
 	})
 
-	err := api.Server.ListenAndServe()
+	err := api.Run(context.Background())
 	if err != nil {
 		log.Fatalf("[FATAL] Error launching API server: %v", err)
 	}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// Account at an external OpenID provider linked to a user, identified by the provider's issuer and subject
+type UserIdentity struct {
+	gorm.Model
+
+	UserID  uint   `gorm:"not null;index"`
+	Issuer  string `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject string `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Email   string `gorm:"type:varchar(255)"` // Email asserted by the provider when the identity was linked
+}
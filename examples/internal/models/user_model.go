@@ -1,11 +1,23 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
 
 	Email    string `gorm:"type:varchar(255);uniqueIndex"`
-	Password string `gorm:"type:varchar(64);not null"`
+	Password string `gorm:"type:varchar(255);not null"`
 	Name     string `gorm:"type:varchar(32);not null"`
+	Role     string `gorm:"type:varchar(16);not null;default:user"`
+
+	EmailVerifiedAt *time.Time
+
+	TOTPSecret      string `gorm:"column:totp_secret;type:varchar(64)"`
+	TOTPEnabled     bool   `gorm:"column:totp_enabled;not null;default:false"`
+	TOTPLastCounter int64  `gorm:"column:totp_last_counter;not null;default:0"` // Last accepted time step, codes can not be replayed
+	RecoveryCodes   string `gorm:"type:text"`                                   // Comma separated hashes of unused recovery codes
 }
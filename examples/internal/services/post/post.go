@@ -4,12 +4,17 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"time"
 
+	"github.com/jose-lico/go-plate/apikeys"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/authz"
 	"github.com/jose-lico/go-plate/database"
 	"github.com/jose-lico/go-plate/examples/internal/models"
+	"github.com/jose-lico/go-plate/flags"
 	"github.com/jose-lico/go-plate/middleware"
 	"github.com/jose-lico/go-plate/ratelimiting"
+	"github.com/jose-lico/go-plate/sessions"
 	"github.com/jose-lico/go-plate/utils"
 	"go.uber.org/zap"
 
@@ -17,14 +22,54 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+// API keys need this scope to create, update or delete posts
+const ScopePostsWrite = "posts:write"
+
+// Lets v1 clients read and write summaries, which only v2 supports otherwise
+const FlagV1Summaries = "v1-post-summaries"
+
+const (
+	PermissionWritePosts    authz.Permission = "posts:write"    // Create posts, edit and delete your own
+	PermissionModeratePosts authz.Permission = "posts:moderate" // Edit and delete anyone's posts
+)
+
 type Service struct {
-	logger *zap.Logger
-	store  PostStore
-	redis  database.RedisStore
+	logger   *zap.Logger
+	store    PostStore
+	redis    database.RedisStore
+	sessions *sessions.SessionManager
+	tokens   jwt.TokenVerifier
+	apiKeys  *apikeys.APIKeyManager
+	authz    *authz.Authorizer
+	csrf     *middleware.CSRF
+	limiter  ratelimiting.RateLimiter
 }
 
-func NewService(logger *zap.Logger, store PostStore, redis database.RedisStore) *Service {
-	return &Service{logger: logger, store: store, redis: redis}
+// Dependencies of the post Service
+type Deps struct {
+	Logger   *zap.Logger
+	Store    PostStore
+	Redis    database.RedisStore
+	Sessions *sessions.SessionManager
+	Tokens   jwt.TokenVerifier
+	APIKeys  *apikeys.APIKeyManager
+	Authz    *authz.Authorizer
+	CSRF     *middleware.CSRF
+	Limiter  ratelimiting.RateLimiter
+}
+
+func NewService(deps Deps) *Service {
+	return &Service{
+		logger:   deps.Logger,
+		store:    deps.Store,
+		redis:    deps.Redis,
+		sessions: deps.Sessions,
+		tokens:   deps.Tokens,
+		apiKeys:  deps.APIKeys,
+		authz:    deps.Authz,
+		csrf:     deps.CSRF,
+		limiter:  deps.Limiter,
+	}
 }
 
 func (s *Service) RegisterRoutes(v1 chi.Router, v2 chi.Router, userRouter chi.Router) {
@@ -33,17 +78,23 @@ func (s *Service) RegisterRoutes(v1 chi.Router, v2 chi.Router, userRouter chi.Ro
 	v2.Mount("/posts", postRouter)
 
 	postRouter.Group(func(r chi.Router) {
-		r.Use(middleware.SessionMiddleware(s.redis))
+		r.Use(middleware.SessionMiddleware(s.sessions))
+		r.Use(middleware.APIKeyMiddleware(s.apiKeys))
+		r.Use(middleware.BearerAuthMiddleware(s.tokens))
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.RateLimitMiddleware(ratelimiting.NewRedisTokenBucket("/posts", s.redis, 0.1, 20, 10*time.Minute)))
+			r.Use(middleware.RateLimitMiddleware(s.limiter))
 
 			// `/posts/user/1` returns same as `/users/1/posts`
 			r.Get("/user/{id}", s.getPosts)
 		})
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.RateLimitMiddleware(ratelimiting.NewRedisTokenBucket("/posts", s.redis, 0.1, 20, 10*time.Minute)))
+			r.Use(middleware.RateLimitMiddleware(s.limiter))
+			r.Use(s.csrf.Middleware)
+			r.Use(middleware.RequireAPIKeyScope(ScopePostsWrite))
+			r.Use(s.authz.Middleware)
+			r.Use(s.authz.Require(PermissionWritePosts))
 
 			r.Post("/", s.createPost)
 			r.Patch("/{id}", s.updatePost)
@@ -53,7 +104,9 @@ func (s *Service) RegisterRoutes(v1 chi.Router, v2 chi.Router, userRouter chi.Ro
 
 	v2.Mount("/users", userRouter)
 	userRouter.Group(func(r chi.Router) {
-		r.Use(middleware.SessionMiddleware(s.redis))
+		r.Use(middleware.SessionMiddleware(s.sessions))
+		r.Use(middleware.APIKeyMiddleware(s.apiKeys))
+		r.Use(middleware.BearerAuthMiddleware(s.tokens))
 
 		// `/users/1/posts` returns same as `/posts/user/1`
 		// I prefer this one
@@ -71,55 +124,50 @@ func (s *Service) RegisterRoutes(v1 chi.Router, v2 chi.Router, userRouter chi.Ro
 // @Success 201 "Post created successfully"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
 // @Failure 401 "Unauthorized"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden - user can not write posts"
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /v1/posts [post]
 // @Router /v2/posts [post]
 func (s *Service) createPost(w http.ResponseWriter, r *http.Request) {
-	isAuthenticated := r.Context().Value(middleware.IsAuthenticated).(bool)
-
-	if isAuthenticated {
-		var post PostPayload
-		if err := utils.ParseJSON(r, &post); err != nil {
-			utils.WriteError(w, http.StatusBadRequest, err)
-			return
-		}
-
-		if err := utils.Validate.Struct(post); err != nil {
-			errors := err.(validator.ValidationErrors)
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
-			return
-		}
+	var post PostPayload
+	if err := utils.ParseJSON(r, &post); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 
-		version := r.Context().Value(middleware.Version).(string)
+	if err := utils.Validate.Struct(post); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
 
-		// Pretend v1 does not support summaries
-		if version == "v1" {
-			post.Summary = ""
-		}
+	version := r.Context().Value(middleware.Version).(string)
 
-		session := r.Context().Value(middleware.SessionInfo).(middleware.Session)
+	// Pretend v1 does not support summaries, unless the flag is on for this user
+	if version == "v1" && !flags.Enabled(r.Context(), FlagV1Summaries) {
+		post.Summary = ""
+	}
 
-		_, err := s.store.CreatePost(&models.Post{
-			Title:   post.Title,
-			Summary: post.Summary,
-			Content: post.Content,
-			UserID:  uint(session.UserID),
-		})
+	principal := auth.MustFromContext(r.Context())
 
-		if err != nil {
-			s.logger.Error("Error creating post", zap.Error(err), zap.Any("Post", post))
-			utils.WriteError(w, http.StatusInternalServerError, err)
-			return
-		}
+	_, err := s.store.CreatePost(&models.Post{
+		Title:   post.Title,
+		Summary: post.Summary,
+		Content: post.Content,
+		UserID:  uint(principal.UserID),
+	})
 
-		w.WriteHeader(http.StatusCreated)
-	} else {
-		w.WriteHeader(http.StatusUnauthorized)
+	if err != nil {
+		s.logger.Error("Error creating post", zap.Error(err), zap.Any("Post", post))
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
 	}
+
+	w.WriteHeader(http.StatusCreated)
 }
 
 // @Summary Update a post
-// @Description Updates an existing post. Only the post owner can perform this action.
+// @Description Updates an existing post. Only the post owner or a moderator can perform this action.
 // @Tags Posts
 // @Accept json
 // @Produce json
@@ -134,64 +182,34 @@ func (s *Service) createPost(w http.ResponseWriter, r *http.Request) {
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /v2/posts/{id} [patch]
 func (s *Service) updatePost(w http.ResponseWriter, r *http.Request) {
-	isAuthenticated := r.Context().Value(middleware.IsAuthenticated).(bool)
-
-	if isAuthenticated {
-		var update EditPostPayload
-		if err := utils.ParseJSON(r, &update); err != nil {
-			utils.WriteError(w, http.StatusBadRequest, err)
-			return
-		}
-
-		if err := utils.Validate.Struct(update); err != nil {
-			errors := err.(validator.ValidationErrors)
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
-			return
-		}
-
-		postID := r.PathValue("id")
-		postIDAsInt, err := strconv.Atoi(postID)
-
-		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s is not a valid id: %w", postID, err))
-			return
-		}
-
-		post, err := s.store.GetPostByID(postIDAsInt)
-
-		if err == ErrPostNotFound {
-			utils.WriteError(w, http.StatusNotFound, err)
-			return
-		} else if err != nil {
-			s.logger.Error("Error getting post", zap.Error(err), zap.Any("Post", post))
-			utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
-			return
-		}
-
-		session := r.Context().Value(middleware.SessionInfo).(middleware.Session)
-		userID := session.UserID
-
-		if post.UserID != uint(userID) {
-			utils.WriteError(w, http.StatusForbidden, ErrUserNotAuthorized)
-			return
-		}
+	var update EditPostPayload
+	if err := utils.ParseJSON(r, &update); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 
-		err = s.store.UpdatePost(post, update)
+	if err := utils.Validate.Struct(update); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
 
-		if err != nil {
-			s.logger.Error("Error updating post", zap.Error(err), zap.Any("Post", post))
-			utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
-			return
-		}
+	post, ok := s.ownedPost(w, r)
+	if !ok {
+		return
+	}
 
-		w.WriteHeader(http.StatusNoContent)
-	} else {
-		w.WriteHeader(http.StatusUnauthorized)
+	if err := s.store.UpdatePost(post, update); err != nil {
+		s.logger.Error("Error updating post", zap.Error(err), zap.Any("Post", post))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // @Summary Delete a post
-// @Description Deletes an existing post. Only the post owner can perform this action.
+// @Description Deletes an existing post. Only the post owner or a moderator can perform this action.
 // @Tags Posts
 // @Security ApiCookieAuth
 // @Param id path int true "Post ID"
@@ -203,36 +221,46 @@ func (s *Service) updatePost(w http.ResponseWriter, r *http.Request) {
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /v2/posts/{id} [delete]
 func (s *Service) deletePost(w http.ResponseWriter, r *http.Request) {
-	isAuthenticated := r.Context().Value(middleware.IsAuthenticated).(bool)
+	post, ok := s.ownedPost(w, r)
+	if !ok {
+		return
+	}
 
-	if isAuthenticated {
-		session := r.Context().Value(middleware.SessionInfo).(middleware.Session)
+	if err := s.store.DeletePost(post); err != nil {
+		s.logger.Error("Error deleting post", zap.Error(err), zap.Uint("Post", post.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
 
-		userID := session.UserID
+	w.WriteHeader(http.StatusNoContent)
+}
 
-		postID := r.PathValue("id")
-		postIDAsInt, err := strconv.Atoi(postID)
+// Loads the post in the path, writing the error response if it does not exist or the user is neither its owner nor a moderator
+func (s *Service) ownedPost(w http.ResponseWriter, r *http.Request) (*models.Post, bool) {
+	postID := r.PathValue("id")
+	postIDAsInt, err := strconv.Atoi(postID)
 
-		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s is not a valid id: %w", postID, err))
-			return
-		}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s is not a valid id: %w", postID, err))
+		return nil, false
+	}
 
-		err = s.store.DeletePost(postIDAsInt, userID)
+	post, err := s.store.GetPostByID(postIDAsInt)
 
-		if err == ErrPostNotFound {
-			utils.WriteError(w, http.StatusNotFound, err)
-		} else if err == ErrUserNotAuthorized {
-			utils.WriteError(w, http.StatusForbidden, err)
-		} else if err != nil {
-			s.logger.Error("Error deleting post", zap.Error(err), zap.Int("Post", postIDAsInt))
-			utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
-		}
+	if err == ErrPostNotFound {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	} else if err != nil {
+		s.logger.Error("Error getting post", zap.Error(err), zap.Int("Post", postIDAsInt))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return nil, false
+	}
 
-		w.WriteHeader(http.StatusNoContent)
-	} else {
-		w.WriteHeader(http.StatusUnauthorized)
+	if !s.authz.CheckOwner(w, r, int(post.UserID), PermissionModeratePosts) {
+		return nil, false
 	}
+
+	return post, true
 }
 
 // @Summary Get user's posts
@@ -261,7 +289,7 @@ func (s *Service) getPosts(w http.ResponseWriter, r *http.Request) {
 
 	limit := -1
 
-	isAuthenticated := r.Context().Value(middleware.IsAuthenticated).(bool)
+	_, isAuthenticated := auth.FromContext(r.Context())
 
 	// Unauthenticated users can only see latest article
 	if !isAuthenticated {
@@ -280,8 +308,8 @@ func (s *Service) getPosts(w http.ResponseWriter, r *http.Request) {
 
 	for _, post := range posts {
 		payload := ModelToResponsePayload(&post)
-		// Pretend v1 does not support summaries
-		if version == "v1" {
+		// Pretend v1 does not support summaries, unless the flag is on for this user
+		if version == "v1" && !flags.Enabled(r.Context(), FlagV1Summaries) {
 			payload.Summary = ""
 		}
 		responseData = append(responseData, payload)
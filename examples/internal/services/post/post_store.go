@@ -10,8 +10,7 @@ import (
 )
 
 var (
-	ErrPostNotFound      = errors.New("post not found")
-	ErrUserNotAuthorized = errors.New("user not authorized to delete/edit post")
+	ErrPostNotFound = errors.New("post not found")
 )
 
 type PostStore interface {
@@ -19,7 +18,7 @@ type PostStore interface {
 	GetPostByID(postID int) (*models.Post, error)
 	GetPostsByUserID(userId int, amount int) ([]models.Post, error)
 	UpdatePost(post *models.Post, updates interface{}) error
-	DeletePost(postID, userID int) error
+	DeletePost(post *models.Post) error
 }
 
 type Store struct {
@@ -79,16 +78,7 @@ func (s *Store) UpdatePost(post *models.Post, updates interface{}) error {
 	return nil
 }
 
-func (s *Store) DeletePost(postID, userID int) error {
-	post, err := s.GetPostByID(postID)
-	if err != nil {
-		return err
-	}
-
-	if post.UserID != uint(userID) {
-		return ErrUserNotAuthorized
-	}
-
+func (s *Store) DeletePost(post *models.Post) error {
 	result := s.db.Delete(post)
 	if result.Error != nil {
 		return fmt.Errorf("error deleting post: %w", result.Error)
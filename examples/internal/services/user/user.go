@@ -1,18 +1,21 @@
 package user
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
+	"github.com/jose-lico/go-plate/apikeys"
 	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/auth/oidc"
+	"github.com/jose-lico/go-plate/auth/onetime"
 	"github.com/jose-lico/go-plate/database"
 	"github.com/jose-lico/go-plate/examples/internal/models"
 	"github.com/jose-lico/go-plate/middleware"
 	"github.com/jose-lico/go-plate/ratelimiting"
+	"github.com/jose-lico/go-plate/sessions"
 	"github.com/jose-lico/go-plate/utils"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -22,13 +25,51 @@ import (
 )
 
 type Service struct {
-	logger *zap.Logger
-	store  UserStore
-	redis  database.RedisStore
+	logger    *zap.Logger
+	store     UserStore
+	redis     database.RedisStore
+	sessions  *sessions.SessionManager
+	tokens    *jwt.Issuer
+	passwords *auth.PasswordPolicy
+	onetime   *onetime.TokenService
+	notifier  *Notifier
+	apiKeys   *apikeys.APIKeyManager
+	csrf      *middleware.CSRF
+	oidc      *oidc.Client
+	limiter   ratelimiting.RateLimiter // Limits unauthenticated routes like register and login
 }
 
-func NewService(logger *zap.Logger, store UserStore, redis database.RedisStore) *Service {
-	return &Service{logger: logger, store: store, redis: redis}
+// Dependencies of the user Service
+type Deps struct {
+	Logger    *zap.Logger
+	Store     UserStore
+	Redis     database.RedisStore
+	Sessions  *sessions.SessionManager
+	Tokens    *jwt.Issuer
+	Passwords *auth.PasswordPolicy
+	OneTime   *onetime.TokenService
+	Notifier  *Notifier
+	APIKeys   *apikeys.APIKeyManager
+	CSRF      *middleware.CSRF
+	OIDC      *oidc.Client // Optional, nil disables login with an external identity provider
+	Limiter   ratelimiting.RateLimiter
+}
+
+func NewService(deps Deps) *Service {
+	return &Service{
+		logger:    deps.Logger,
+		store:     deps.Store,
+		redis:     deps.Redis,
+		sessions:  deps.Sessions,
+		tokens:    deps.Tokens,
+		passwords: deps.Passwords,
+		onetime:   deps.OneTime,
+		notifier:  deps.Notifier,
+		apiKeys:   deps.APIKeys,
+		csrf:      deps.CSRF,
+		oidc:      deps.OIDC,
+		limiter:   deps.Limiter,
+	}
 }
 
 func (s *Service) RegisterRoutes(v1 chi.Router) chi.Router {
@@ -36,34 +77,64 @@ func (s *Service) RegisterRoutes(v1 chi.Router) chi.Router {
 	v1.Mount("/users", userRouter)
 
 	userRouter.Group(func(r chi.Router) {
-		r.Use(middleware.RateLimitMiddleware(ratelimiting.NewInMemoryTokenBucket(0.05, 3, 10*time.Minute)))
+		r.Use(middleware.RateLimitMiddleware(s.limiter))
+		r.Use(s.csrf.Middleware)
 
 		r.Post("/register", s.createUser)
 		r.Post("/login", s.loginUser)
+		r.Post("/token", s.createToken)
+		r.Post("/token/refresh", s.refreshToken)
+		r.Post("/token/revoke", s.revokeToken)
+		r.Post("/password/forgot", s.forgotPassword)
+		r.Post("/password/reset", s.resetPassword)
+		r.Post("/verify-email", s.verifyEmail)
+
+		// Login with an external identity provider, when configured
+		if s.oidc != nil {
+			r.Get("/oidc/login", s.oidcLogin)
+			r.Get("/oidc/callback", s.oidcCallback)
+		}
 	})
 
 	userRouter.Group(func(r chi.Router) {
-		r.Use(middleware.SessionMiddleware(s.redis))
+		r.Use(middleware.SessionMiddleware(s.sessions))
+		r.Use(ValidateUserMiddleware(s.store, s.sessions))
 
 		r.Get("/secret", func(w http.ResponseWriter, r *http.Request) {
+			user := MustUserFromContext(r.Context())
+			w.Write([]byte(fmt.Sprintf("This is a secret from user %d.", user.ID)))
+		})
+	})
 
-			isValidated := r.Context().Value(IsValidated).(bool)
+	// A login waiting for its second factor has a session cookie too, so completing it is CSRF protected like other session routes
+	userRouter.Group(func(r chi.Router) {
+		r.Use(middleware.MFAPendingSessionMiddleware(s.sessions))
+		r.Use(s.csrf.Middleware)
 
-			if isValidated {
-				user := r.Context().Value(User).(*models.User)
-				w.Write([]byte(fmt.Sprintf("This is a secret from user %d.", user.ID)))
-			} else {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte("You will never get this lalalala."))
-			}
-		})
+		r.Get("/csrf-token", s.getCSRFToken)
+		r.With(middleware.RateLimitMiddleware(s.limiter)).Post("/mfa/challenge", s.challengeMFA)
+	})
+
+	userRouter.Group(func(r chi.Router) {
+		r.Use(middleware.SessionMiddlewareBlocking(s.sessions))
+		r.Use(s.csrf.Middleware)
+
+		r.Get("/me/sessions", s.listSessions)
+		r.Delete("/me/sessions", s.revokeAllSessions)
+		r.Delete("/me/sessions/{id}", s.revokeSession)
+		r.Post("/mfa/totp/enroll", s.enrollTOTP)
+		r.Post("/mfa/totp/confirm", s.confirmTOTP)
+		r.Post("/mfa/totp/disable", s.disableTOTP)
+		r.Get("/me/api-keys", s.listAPIKeys)
+		r.Post("/me/api-keys", s.createAPIKey)
+		r.Delete("/me/api-keys/{id}", s.revokeAPIKey)
 	})
 
 	return userRouter
 }
 
 // @Summary Create a new user
-// @Description Creates a new user by parsing the provided user data, validating it, and storing it in the database. Returns a cookie on successful creation.
+// @Description Creates a new user by parsing the provided user data, validating it, and storing it in the database. Returns a cookie on successful creation and sends an email verification token.
 // @Tags Users
 // @Accept  json
 // @Produce  json
@@ -71,6 +142,7 @@ func (s *Service) RegisterRoutes(v1 chi.Router) chi.Router {
 // @Success 201 "User created successfully"
 // @Header 201 {string} Set-Cookie "session=value; Path=/; HttpOnly"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 400 {object} PasswordRejectedResponse "Password does not meet the password policy"
 // @Failure 409 {object} utils.ErrorResponse "User with provided email already exists"
 // @Failure 500 {object} utils.ErrorResponse "Interal server error"
 // @Router /v1/users/register [post]
@@ -87,6 +159,15 @@ func (s *Service) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var policyErr *auth.PasswordPolicyError
+	if err := s.passwords.Check(user.Password, user.Email, user.Name); errors.As(err, &policyErr) {
+		utils.WriteJSON(w, http.StatusBadRequest, &PasswordRejectedResponse{
+			Error:   "password does not meet requirements",
+			Reasons: policyErr.Violations,
+		})
+		return
+	}
+
 	_, err := s.store.GetUserByEmail(user.Email)
 	if err == nil {
 		utils.WriteError(w, http.StatusConflict, fmt.Errorf("user with email %s already exists", user.Email))
@@ -112,31 +193,55 @@ func (s *Service) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.sendEmailVerification(r, u)
+
 	s.generateSession(w, r, u, http.StatusCreated)
 }
 
 // @Summary Login user
-// @Description Authenticates a user and creates a session
+// @Description Authenticates a user and creates a session. Users with two-factor authentication get a short-lived pending session instead, completed through /v1/users/mfa/challenge.
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Param user body LoginUserPayload true "Login credentials"
 // @Success 200 "Login successful"
+// @Success 202 {object} MFARequiredResponse "Second factor required"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
 // @Failure 401 {object} utils.ErrorResponse "Invalid credentials"
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /v1/users/login [post]
 func (s *Service) loginUser(w http.ResponseWriter, r *http.Request) {
 	var user LoginUserPayload
-	if err := utils.ParseJSON(r, &user); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+	u, ok := s.authenticate(w, r, &user)
+	if !ok {
 		return
 	}
 
+	if u.TOTPEnabled {
+		if _, err := s.sessions.CreateMFAPending(w, r, int(u.ID)); err != nil {
+			s.logger.Error("Error creating MFA pending session", zap.Error(err))
+			utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusAccepted, &MFARequiredResponse{MFARequired: true})
+		return
+	}
+
+	s.generateSession(w, r, u, http.StatusOK)
+}
+
+// Parses user and checks the login credentials, writing the error response if they are invalid
+func (s *Service) authenticate(w http.ResponseWriter, r *http.Request, user *LoginUserPayload) (*models.User, bool) {
+	if err := utils.ParseJSON(r, user); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
 	if err := utils.Validate.Struct(user); err != nil {
 		errors := err.(validator.ValidationErrors)
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
-		return
+		return nil, false
 	}
 
 	// These error messages could allow for user enumeration and should be more generic
@@ -145,59 +250,143 @@ func (s *Service) loginUser(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, gorm.ErrRecordNotFound):
 			utils.WriteError(w, http.StatusUnauthorized, err)
-			return
+			return nil, false
 		default:
 			s.logger.Error("Error getting user from store", zap.Error(err), zap.Any("User", user))
 			utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
-			return
+			return nil, false
 		}
 	}
 
-	if !auth.ComparePasswords(u.Password, []byte(user.Password)) {
+	ok, needsRehash, err := auth.VerifyPassword(u.Password, user.Password)
+	if err != nil {
+		s.logger.Error("Error verifying password", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return nil, false
+	}
+
+	if !ok {
 		utils.WriteError(w, http.StatusUnauthorized, errors.New("wrong password"))
-		return
+		return nil, false
 	}
 
-	s.generateSession(w, r, u, http.StatusOK)
+	// Transparently upgrade hashes made with an older algorithm or weaker parameters, failing to do so should not block the login
+	if needsRehash {
+		if hashedPassword, err := auth.HashPassword(user.Password); err != nil {
+			s.logger.Warn("Error rehashing password", zap.Error(err), zap.Uint("User", u.ID))
+		} else if err := s.store.UpdateUserPassword(u, hashedPassword); err != nil {
+			s.logger.Warn("Error updating rehashed password", zap.Error(err), zap.Uint("User", u.ID))
+		}
+	}
+
+	return u, true
 }
 
-func (s *Service) generateSession(w http.ResponseWriter, r *http.Request, u *models.User, status int) {
-	sessionToken, err := auth.GenerateToken()
+// @Summary List user sessions
+// @Description Lists the authenticated user's active sessions, flagging the one used by the current request.
+// @Tags Users
+// @Produce json
+// @Security ApiCookieAuth
+// @Success 200 {object} map[string][]SessionResponsePayload "List of sessions"
+// @Failure 401 "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/me/sessions [get]
+func (s *Service) listSessions(w http.ResponseWriter, r *http.Request) {
+	principal := auth.MustFromContext(r.Context())
+
+	userSessions, err := s.sessions.ListForUser(r.Context(), principal.UserID)
 	if err != nil {
-		s.logger.Error("Error generating session token", zap.Error(err))
+		s.logger.Error("Error listing sessions", zap.Error(err), zap.Int("User", principal.UserID))
 		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	responseData := make([]SessionResponsePayload, 0, len(userSessions))
+	for _, userSession := range userSessions {
+		responseData = append(responseData, SessionToResponsePayload(userSession, principal.SessionID))
 	}
 
-	duration := 24 * time.Hour
-	expires := time.Now().Add(duration)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"sessions": responseData})
+}
+
+// @Summary Revoke a session
+// @Description Revokes one of the authenticated user's sessions. Revoking the current session logs the user out.
+// @Tags Users
+// @Security ApiCookieAuth
+// @Param id path string true "Session ID"
+// @Success 204 "Session revoked successfully"
+// @Failure 401 "Unauthorized"
+// @Failure 404 {object} utils.ErrorResponse "Session not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/me/sessions/{id} [delete]
+func (s *Service) revokeSession(w http.ResponseWriter, r *http.Request) {
+	principal := auth.MustFromContext(r.Context())
+	id := r.PathValue("id")
+
+	err := s.sessions.DestroyByID(r.Context(), principal.UserID, id)
+	if errors.Is(err, sessions.ErrSessionNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		s.logger.Error("Error revoking session", zap.Error(err), zap.Int("User", principal.UserID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
 
-	session := &middleware.Session{
-		UserID:       int(u.ID),
-		Expiration:   expires,
-		CreatedAt:    time.Now(),
-		LastAccessed: time.Now(),
-		UserAgent:    r.Header.Get("User-Agent"),
+	if id == principal.SessionID {
+		s.sessions.ClearCookie(w)
 	}
 
-	marshalled, err := json.Marshal(session)
-	if err != nil {
-		s.logger.Error("Failed to marshall session", zap.Error(err))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Revoke all sessions
+// @Description Revokes every session and refresh token of the authenticated user, logging them out everywhere.
+// @Tags Users
+// @Security ApiCookieAuth
+// @Success 204 "Sessions revoked successfully"
+// @Failure 401 "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/me/sessions [delete]
+func (s *Service) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	principal := auth.MustFromContext(r.Context())
+
+	if err := s.sessions.DestroyAllForUser(r.Context(), principal.UserID); err != nil {
+		s.logger.Error("Error revoking sessions", zap.Error(err), zap.Int("User", principal.UserID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	if err := s.tokens.RevokeAllForUser(r.Context(), principal.UserID); err != nil {
+		s.logger.Error("Error revoking refresh tokens", zap.Error(err), zap.Int("User", principal.UserID))
 		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
 		return
 	}
 
-	s.redis.Set(r.Context(), "session:"+sessionToken, marshalled, duration)
+	s.sessions.ClearCookie(w)
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sessionToken,
-		Path:     "/",
-		Expires:  expires,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		Domain:   "",
-	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Get a CSRF token
+// @Description Returns the CSRF token to send in the X-CSRF-Token header of cookie authenticated requests that change state, including the second factor challenge of a pending login. In double submit mode it is also set as a cookie.
+// @Tags Users
+// @Produce json
+// @Security ApiCookieAuth
+// @Success 200 {object} middleware.CSRFTokenResponse "CSRF token"
+// @Failure 401 "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/csrf-token [get]
+func (s *Service) getCSRFToken(w http.ResponseWriter, r *http.Request) {
+	s.csrf.TokenHandler(w, r)
+}
+
+func (s *Service) generateSession(w http.ResponseWriter, r *http.Request, u *models.User, status int) {
+	if _, err := s.sessions.Create(w, r, int(u.ID)); err != nil {
+		s.logger.Error("Error creating session", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
 
 	w.WriteHeader(status)
 }
@@ -0,0 +1,197 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/onetime"
+	"github.com/jose-lico/go-plate/examples/internal/models"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// @Summary Request a password reset
+// @Description Sends a single use password reset token to the user's email. Always succeeds, so it can not be used to find out which emails are registered.
+// @Tags Users
+// @Accept json
+// @Param email body ForgotPasswordPayload true "Email of the account"
+// @Success 202 "Reset token sent if the account exists"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/password/forgot [post]
+func (s *Service) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if !parsePayload(w, r, &payload) {
+		return
+	}
+
+	u, err := s.store.GetUserByEmail(payload.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	} else if err != nil {
+		s.logger.Error("Error getting user from store", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	token, err := s.onetime.Issue(r.Context(), onetime.PasswordReset, int(u.ID))
+	if err != nil {
+		s.logger.Error("Error issuing password reset token", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	// Reporting the failure would reveal that the account exists
+	if err := s.notifier.SendToken(r.Context(), u, onetime.PasswordReset, token); err != nil {
+		s.logger.Error("Error sending password reset email", zap.Error(err), zap.Uint("User", u.ID))
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary Reset password
+// @Description Sets a new password using a token from /v1/users/password/forgot. Every session and refresh token of the user is revoked.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param reset body ResetPasswordPayload true "Reset token and new password"
+// @Success 204 "Password reset successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or token"
+// @Failure 400 {object} PasswordRejectedResponse "Password does not meet the password policy"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/password/reset [post]
+func (s *Service) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if !parsePayload(w, r, &payload) {
+		return
+	}
+
+	// The token is only consumed once the new password is accepted, so a rejected password does not require a new reset email
+	userID, err := s.onetime.Verify(r.Context(), onetime.PasswordReset, payload.Token)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		s.logger.Error("Error verifying password reset token", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	u, err := s.store.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.WriteError(w, http.StatusBadRequest, onetime.ErrInvalidToken)
+		return
+	} else if err != nil {
+		s.logger.Error("Error getting user from store", zap.Error(err), zap.Int("User", userID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	if err := s.passwords.Check(payload.Password, u.Email, u.Name); errors.As(err, &policyErr) {
+		utils.WriteJSON(w, http.StatusBadRequest, &PasswordRejectedResponse{
+			Error:   "password does not meet requirements",
+			Reasons: policyErr.Violations,
+		})
+		return
+	}
+
+	if _, err := s.onetime.Consume(r.Context(), onetime.PasswordReset, payload.Token); errors.Is(err, onetime.ErrInvalidToken) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		s.logger.Error("Error consuming password reset token", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		s.logger.Error("Error hashing password for resetPassword", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	if err := s.store.UpdateUserPassword(u, hashedPassword); err != nil {
+		s.logger.Error("Error updating password", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	// Whoever knew the old password may still hold a session
+	if err := s.sessions.DestroyAllForUser(r.Context(), int(u.ID)); err != nil {
+		s.logger.Error("Error revoking sessions after password reset", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	if err := s.tokens.RevokeAllForUser(r.Context(), int(u.ID)); err != nil {
+		s.logger.Error("Error revoking refresh tokens after password reset", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	s.sessions.ClearCookie(w)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Verify email
+// @Description Marks the user's email as verified using the token sent on registration.
+// @Tags Users
+// @Accept json
+// @Param token body VerifyEmailPayload true "Verification token"
+// @Success 204 "Email verified successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or token"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/verify-email [post]
+func (s *Service) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyEmailPayload
+	if !parsePayload(w, r, &payload) {
+		return
+	}
+
+	userID, err := s.onetime.Consume(r.Context(), onetime.EmailVerification, payload.Token)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		s.logger.Error("Error consuming email verification token", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	u, err := s.store.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.WriteError(w, http.StatusBadRequest, onetime.ErrInvalidToken)
+		return
+	} else if err != nil {
+		s.logger.Error("Error getting user from store", zap.Error(err), zap.Int("User", userID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	if err := s.store.MarkEmailVerified(u); err != nil {
+		s.logger.Error("Error marking email as verified", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Emails an email verification token to a newly registered user. Failing to do so should not fail the registration.
+func (s *Service) sendEmailVerification(r *http.Request, u *models.User) {
+	token, err := s.onetime.Issue(r.Context(), onetime.EmailVerification, int(u.ID))
+	if err != nil {
+		s.logger.Warn("Error issuing email verification token", zap.Error(err), zap.Uint("User", u.ID))
+		return
+	}
+
+	if err := s.notifier.SendToken(r.Context(), u, onetime.EmailVerification, token); err != nil {
+		s.logger.Warn("Error sending email verification", zap.Error(err), zap.Uint("User", u.ID))
+	}
+}
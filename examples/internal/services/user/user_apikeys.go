@@ -0,0 +1,109 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jose-lico/go-plate/apikeys"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+)
+
+// @Summary Create an API key
+// @Description Issues an API key for machine clients acting as the authenticated user. The key is only shown once.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security ApiCookieAuth
+// @Param key body CreateAPIKeyPayload true "Name, scopes and lifetime of the key"
+// @Success 201 {object} CreateAPIKeyResponse "The new key"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/me/api-keys [post]
+func (s *Service) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAPIKeyPayload
+	if !parsePayload(w, r, &payload) {
+		return
+	}
+
+	principal := auth.MustFromContext(r.Context())
+
+	var expiresAt *time.Time
+	if payload.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, payload.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	value, key, err := s.apiKeys.Issue(r.Context(), uint(principal.UserID), payload.Name, payload.Scopes, expiresAt)
+	if err != nil {
+		s.logger.Error("Error issuing api key", zap.Error(err), zap.Int("User", principal.UserID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, &CreateAPIKeyResponse{Key: value, APIKeyResponse: APIKeyToResponse(key)})
+}
+
+// @Summary List API keys
+// @Description Lists the authenticated user's API keys, including revoked and expired ones. Secrets are never returned.
+// @Tags Users
+// @Produce json
+// @Security ApiCookieAuth
+// @Success 200 {object} map[string][]APIKeyResponse "List of API keys"
+// @Failure 401 "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/me/api-keys [get]
+func (s *Service) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	principal := auth.MustFromContext(r.Context())
+
+	keys, err := s.apiKeys.ListForUser(r.Context(), uint(principal.UserID))
+	if err != nil {
+		s.logger.Error("Error listing api keys", zap.Error(err), zap.Int("User", principal.UserID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	responseData := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		responseData = append(responseData, APIKeyToResponse(key))
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"api_keys": responseData})
+}
+
+// @Summary Revoke an API key
+// @Description Revokes one of the authenticated user's API keys. It stops working immediately.
+// @Tags Users
+// @Security ApiCookieAuth
+// @Param id path int true "API key ID"
+// @Success 204 "API key revoked successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid API key ID"
+// @Failure 401 "Unauthorized"
+// @Failure 404 {object} utils.ErrorResponse "API key not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/me/api-keys/{id} [delete]
+func (s *Service) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal := auth.MustFromContext(r.Context())
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid api key id"))
+		return
+	}
+
+	err = s.apiKeys.Revoke(r.Context(), uint(principal.UserID), uint(id))
+	if errors.Is(err, apikeys.ErrAPIKeyNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		s.logger.Error("Error revoking api key", zap.Error(err), zap.Int("User", principal.UserID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
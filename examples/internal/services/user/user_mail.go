@@ -0,0 +1,63 @@
+package user
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/url"
+
+	"github.com/jose-lico/go-plate/auth/onetime"
+	"github.com/jose-lico/go-plate/examples/internal/models"
+	"github.com/jose-lico/go-plate/mail"
+
+	"go.uber.org/zap"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+// Path of the page handling the link of each one-time token email, relative to the link base URL
+var tokenLinkPaths = map[onetime.Purpose]string{
+	onetime.PasswordReset:     "/reset-password",
+	onetime.EmailVerification: "/verify-email",
+}
+
+// Notifier sends the account emails of the user service, one template per one-time token purpose
+type Notifier struct {
+	mailer      mail.Mailer
+	templates   *mail.Templates
+	linkBaseURL string
+}
+
+func NewNotifier(mailer mail.Mailer, linkBaseURL string) *Notifier {
+	sub, err := fs.Sub(templatesFS, "templates")
+	if err != nil {
+		zap.L().Fatal("Error reading email templates", zap.Error(err))
+	}
+
+	templates, err := mail.ParseTemplates(sub)
+	if err != nil {
+		zap.L().Fatal("Error parsing email templates", zap.Error(err))
+	}
+
+	return &Notifier{mailer: mailer, templates: templates, linkBaseURL: linkBaseURL}
+}
+
+func (n *Notifier) SendToken(ctx context.Context, u *models.User, purpose onetime.Purpose, token string) error {
+	msg, err := n.templates.Render(string(purpose), map[string]string{
+		"Name": u.Name,
+		"Link": n.linkBaseURL + tokenLinkPaths[purpose] + "?token=" + url.QueryEscape(token),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.To = []string{u.Email}
+
+	if err := n.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send %s email: %w", purpose, err)
+	}
+
+	return nil
+}
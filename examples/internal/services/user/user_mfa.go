@@ -0,0 +1,304 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/totp"
+	"github.com/jose-lico/go-plate/examples/internal/models"
+	"github.com/jose-lico/go-plate/sessions"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const totpIssuer = "go-plate"
+const recoveryCodeCount = 10
+
+var (
+	errInvalidCode       = errors.New("invalid code")
+	errMFARequired       = errors.New("two-factor authentication code required")
+	errMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	errMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	errMFANotEnrolling   = errors.New("two-factor authentication enrollment has not been started")
+)
+
+// @Summary Start TOTP enrollment
+// @Description Generates a new TOTP secret for the authenticated user. It only takes effect once confirmed with a valid code.
+// @Tags Users
+// @Produce json
+// @Security ApiCookieAuth
+// @Success 200 {object} TOTPEnrollResponse "Secret and provisioning URI"
+// @Failure 401 "Unauthorized"
+// @Failure 409 {object} utils.ErrorResponse "Two-factor authentication is already enabled"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/mfa/totp/enroll [post]
+func (s *Service) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	if u.TOTPEnabled {
+		utils.WriteError(w, http.StatusConflict, errMFAAlreadyEnabled)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.logger.Error("Error generating TOTP secret", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	u.TOTPSecret = secret
+	if err := s.store.UpdateUserTOTP(u); err != nil {
+		s.logger.Error("Error storing TOTP secret", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, &TOTPEnrollResponse{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(secret, totpIssuer, u.Email),
+	})
+}
+
+// @Summary Confirm TOTP enrollment
+// @Description Enables two-factor authentication once the user proves their authenticator app works. Returns one-time recovery codes, which are only shown once.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security ApiCookieAuth
+// @Param code body TOTPCodePayload true "Code from the authenticator app"
+// @Success 200 {object} RecoveryCodesResponse "Recovery codes"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or code"
+// @Failure 401 "Unauthorized"
+// @Failure 409 {object} utils.ErrorResponse "Two-factor authentication is already enabled"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/mfa/totp/confirm [post]
+func (s *Service) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if !parsePayload(w, r, &payload) {
+		return
+	}
+
+	u, ok := s.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	if u.TOTPEnabled {
+		utils.WriteError(w, http.StatusConflict, errMFAAlreadyEnabled)
+		return
+	}
+	if u.TOTPSecret == "" {
+		utils.WriteError(w, http.StatusBadRequest, errMFANotEnrolling)
+		return
+	}
+
+	counter, valid, err := totp.Validate(u.TOTPSecret, payload.Code, time.Now())
+	if err != nil {
+		s.logger.Error("Error validating TOTP code", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+	if !valid {
+		utils.WriteError(w, http.StatusBadRequest, errInvalidCode)
+		return
+	}
+
+	codes, hashes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		s.logger.Error("Error generating recovery codes", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	u.TOTPEnabled = true
+	u.TOTPLastCounter = counter
+	u.RecoveryCodes = strings.Join(hashes, ",")
+
+	if err := s.store.UpdateUserTOTP(u); err != nil {
+		s.logger.Error("Error enabling TOTP", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, &RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disable TOTP
+// @Description Disables two-factor authentication, requiring a current code or a recovery code.
+// @Tags Users
+// @Accept json
+// @Security ApiCookieAuth
+// @Param code body MFACodePayload true "Code from the authenticator app or a recovery code"
+// @Success 204 "Two-factor authentication disabled"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or code"
+// @Failure 401 "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/mfa/totp/disable [post]
+func (s *Service) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if !parsePayload(w, r, &payload) {
+		return
+	}
+
+	u, ok := s.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !u.TOTPEnabled {
+		utils.WriteError(w, http.StatusBadRequest, errMFANotEnabled)
+		return
+	}
+
+	if !s.verifySecondFactor(w, u, payload) {
+		return
+	}
+
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastCounter = 0
+	u.RecoveryCodes = ""
+
+	if err := s.store.UpdateUserTOTP(u); err != nil {
+		s.logger.Error("Error disabling TOTP", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Complete login with a second factor
+// @Description Verifies the second factor of a login that returned mfa_required, upgrading the pending session to a full session.
+// @Tags Users
+// @Accept json
+// @Param code body MFACodePayload true "Code from the authenticator app or a recovery code"
+// @Success 200 "Login successful"
+// @Header 200 {string} Set-Cookie "session=value; Path=/; HttpOnly"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload or code"
+// @Failure 401 "No pending login"
+// @Failure 403 {object} utils.ErrorResponse "Missing or invalid CSRF token"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/mfa/challenge [post]
+func (s *Service) challengeMFA(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if !parsePayload(w, r, &payload) {
+		return
+	}
+
+	token, ok := s.sessions.Token(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	session, err := s.sessions.Get(r.Context(), token)
+	if errors.Is(err, sessions.ErrSessionNotFound) || (err == nil && !session.MFAPending) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		s.logger.Error("Error reading session", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	u, err := s.store.GetUserByID(session.UserID)
+	if err != nil {
+		s.logger.Error("Error getting user from store", zap.Error(err), zap.Int("User", session.UserID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	if !s.verifySecondFactor(w, u, payload) {
+		return
+	}
+
+	if _, err := s.sessions.CompleteMFA(w, r); err != nil {
+		s.logger.Error("Error completing MFA session", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Checks the TOTP code or recovery code in payload, consuming it so it can not be used again.
+// Writes the error response if it is invalid.
+func (s *Service) verifySecondFactor(w http.ResponseWriter, u *models.User, payload MFACodePayload) bool {
+	var ok bool
+	var err error
+
+	if payload.Code != "" {
+		var counter int64
+		counter, ok, err = totp.Validate(u.TOTPSecret, payload.Code, time.Now())
+		if err == nil && ok {
+			ok, err = s.store.UseTOTPCounter(u, counter)
+		}
+	} else {
+		var remaining []string
+		remaining, ok = totp.UseRecoveryCode(splitRecoveryCodes(u.RecoveryCodes), payload.RecoveryCode)
+		if ok {
+			ok, err = s.store.UseRecoveryCode(u, strings.Join(remaining, ","))
+		}
+	}
+
+	if err != nil {
+		s.logger.Error("Error verifying second factor", zap.Error(err), zap.Uint("User", u.ID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return false
+	}
+
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errInvalidCode)
+		return false
+	}
+
+	return true
+}
+
+// Reads the user of the session set by the blocking session middleware, writing the error response on failure
+func (s *Service) sessionUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	principal := auth.MustFromContext(r.Context())
+
+	u, err := s.store.GetUserByID(principal.UserID)
+	if err != nil {
+		s.logger.Error("Error getting user from store", zap.Error(err), zap.Int("User", principal.UserID))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return nil, false
+	}
+
+	return u, true
+}
+
+func parsePayload(w http.ResponseWriter, r *http.Request, payload any) bool {
+	if err := utils.ParseJSON(r, payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return false
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return false
+	}
+
+	return true
+}
+
+func splitRecoveryCodes(codes string) []string {
+	if codes == "" {
+		return nil
+	}
+
+	return strings.Split(codes, ",")
+}
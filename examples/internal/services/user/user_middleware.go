@@ -4,61 +4,72 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"time"
 
-	"github.com/jose-lico/go-plate/database"
-	"github.com/jose-lico/go-plate/middleware"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/authz"
+	"github.com/jose-lico/go-plate/examples/internal/models"
+	"github.com/jose-lico/go-plate/sessions"
 
 	"gorm.io/gorm"
 )
 
 type contextKey string
 
-const IsValidated contextKey = "isValidated"
-const User contextKey = "user"
+const userKey contextKey = "user"
 
-func ValidateUserMiddleware(store UserStore, redis database.RedisStore) func(next http.Handler) http.Handler {
+// Loads the user of the authenticated principal, rejecting unauthenticated requests and users that no longer exist
+func ValidateUserMiddleware(store UserStore, sessions *sessions.SessionManager) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), IsValidated, false)
-			isAuthenticated, _ := r.Context().Value(middleware.IsAuthenticated).(bool)
-
-			if isAuthenticated {
-				session := r.Context().Value(middleware.SessionInfo).(middleware.Session)
-
-				id := session.UserID
-
-				u, err := store.GetUserByID(id)
-
-				if err != nil {
-					if errors.Is(err, gorm.ErrRecordNotFound) {
-						redis.Del(r.Context(), r.Context().Value(middleware.Token).(string))
-
-						http.SetCookie(w, &http.Cookie{
-							Name:     "session",
-							Value:    "",
-							Path:     "/",
-							Expires:  time.Unix(0, 0),
-							MaxAge:   -1,
-							HttpOnly: true,
-							Secure:   true,
-							SameSite: http.SameSiteStrictMode,
-							Domain:   "",
-						})
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
 
-						w.WriteHeader(http.StatusUnauthorized)
-					} else {
-						w.WriteHeader(http.StatusInternalServerError)
-					}
-				} else {
-					ctx = context.WithValue(ctx, IsValidated, true)
-					ctx = context.WithValue(ctx, User, u)
+			u, err := store.GetUserByID(principal.UserID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				if principal.Method == auth.MethodSession {
+					sessions.Destroy(w, r)
 				}
-			} else {
+
 				w.WriteHeader(http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
 			}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, u)))
 		})
 	}
 }
+
+// Returns the user loaded by ValidateUserMiddleware
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	u, ok := ctx.Value(userKey).(*models.User)
+	return u, ok
+}
+
+// Like UserFromContext, but panics if ValidateUserMiddleware did not run
+func MustUserFromContext(ctx context.Context) *models.User {
+	u, ok := UserFromContext(ctx)
+	if !ok {
+		panic("user: no user in context, is ValidateUserMiddleware mounted?")
+	}
+	return u
+}
+
+// Resolves the role stored on the user, for the authz package
+func NewRoleResolver(store UserStore) authz.RoleResolver {
+	return authz.RoleResolverFunc(func(ctx context.Context, userID int) ([]authz.Role, error) {
+		u, err := store.GetUserByID(userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		return []authz.Role{authz.Role(u.Role)}, nil
+	})
+}
@@ -0,0 +1,181 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/oidc"
+	"github.com/jose-lico/go-plate/examples/internal/models"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	errOIDCEmailNotVerified = errors.New("the identity provider did not assert a verified email")
+	errOIDCAccountNotLinked = errors.New("an account with this email exists but its email is not verified, verify it before logging in with the identity provider")
+)
+
+// @Summary Login with the identity provider
+// @Description Redirects to the configured OpenID Connect provider to log in. Only registered when OIDC is configured.
+// @Tags Users
+// @Success 302 "Redirect to the identity provider"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/oidc/login [get]
+func (s *Service) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if err := s.oidc.Begin(w, r); err != nil {
+		s.logger.Error("Error starting OIDC login", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+	}
+}
+
+// @Summary Identity provider callback
+// @Description Completes a login through the OpenID Connect provider and creates a session, redirecting to the post login URL.
+// @Description Users are matched by their provider identity, otherwise linked to the account with the same verified email, otherwise registered.
+// @Description Users with two-factor authentication get a pending session instead and are redirected with mfa=required, to complete it through /v1/users/mfa/challenge.
+// @Tags Users
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login in progress"
+// @Success 302 "Login successful, redirect to the post login URL"
+// @Header 302 {string} Set-Cookie "session=value; Path=/; HttpOnly"
+// @Failure 400 {object} utils.ErrorResponse "Invalid or expired login state, or rejected by the provider"
+// @Failure 401 {object} utils.ErrorResponse "Invalid ID token"
+// @Failure 403 {object} utils.ErrorResponse "Email not verified by the provider"
+// @Failure 409 {object} utils.ErrorResponse "Existing account with the same unverified email"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/oidc/callback [get]
+func (s *Service) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	identity, err := s.oidc.Callback(w, r)
+
+	var providerErr *oidc.ProviderError
+	switch {
+	case err == nil:
+	case errors.Is(err, oidc.ErrNoAuthRequest), errors.Is(err, oidc.ErrStateMismatch), errors.As(err, &providerErr):
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	case errors.Is(err, oidc.ErrInvalidIDToken):
+		s.logger.Warn("Rejected OIDC ID token", zap.Error(err))
+		utils.WriteError(w, http.StatusUnauthorized, oidc.ErrInvalidIDToken)
+		return
+	default:
+		s.logger.Error("Error completing OIDC login", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	u, status, err := s.oidcUser(identity)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			s.logger.Error("Error resolving OIDC user", zap.Error(err), zap.String("Issuer", identity.Issuer), zap.String("Subject", identity.Subject))
+			err = utils.ErrGenericInternalError
+		}
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	redirect := s.oidc.PostLoginURL()
+
+	if u.TOTPEnabled {
+		if _, err := s.sessions.CreateMFAPending(w, r, int(u.ID)); err != nil {
+			s.logger.Error("Error creating MFA pending session", zap.Error(err))
+			utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+			return
+		}
+
+		redirect = withQuery(redirect, "mfa", "required")
+	} else if _, err := s.sessions.Create(w, r, int(u.ID)); err != nil {
+		s.logger.Error("Error creating session", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// Finds, links or registers the user of identity, returning the status to respond with on error
+func (s *Service) oidcUser(identity *oidc.Identity) (*models.User, int, error) {
+	u, err := s.store.GetUserByIdentity(identity.Issuer, identity.Subject)
+	if err == nil {
+		return u, 0, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// Emails are only trusted to link or register accounts when the provider vouches for them
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, http.StatusForbidden, errOIDCEmailNotVerified
+	}
+
+	link := &models.UserIdentity{Issuer: identity.Issuer, Subject: identity.Subject, Email: strings.ToLower(identity.Email)}
+
+	u, err = s.store.GetUserByEmail(identity.Email)
+	if err == nil {
+		// Whoever registered an unverified account may not own the email, linking it would hand them the provider's login
+		if u.EmailVerifiedAt == nil {
+			return nil, http.StatusConflict, errOIDCAccountNotLinked
+		}
+
+		if err := s.store.LinkIdentity(u, link); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		return u, 0, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// Users registered through the provider have no usable password until they reset it
+	password, err := auth.GenerateToken()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	now := time.Now()
+	u, err = s.store.CreateUserWithIdentity(&models.User{
+		Email:           link.Email,
+		Password:        hashedPassword,
+		Name:            oidcUserName(identity),
+		EmailVerifiedAt: &now,
+	}, link)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return u, 0, nil
+}
+
+// Name claim if present, otherwise the local part of the email, cut to fit models.User
+func oidcUserName(identity *oidc.Identity) string {
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	if runes := []rune(name); len(runes) > 32 {
+		name = string(runes[:32])
+	}
+
+	return name
+}
+
+func withQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jose-lico/go-plate/examples/internal/models"
 
@@ -13,6 +14,14 @@ type UserStore interface {
 	CreateUser(user *models.User) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
 	GetUserByID(id int) (*models.User, error)
+	UpdateUserPassword(user *models.User, hashedPassword string) error
+	MarkEmailVerified(user *models.User) error
+	UpdateUserTOTP(user *models.User) error
+	UseTOTPCounter(user *models.User, counter int64) (bool, error)
+	UseRecoveryCode(user *models.User, remaining string) (bool, error)
+	GetUserByIdentity(issuer, subject string) (*models.User, error)
+	LinkIdentity(user *models.User, identity *models.UserIdentity) error
+	CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (*models.User, error)
 }
 
 type Store struct {
@@ -60,3 +69,101 @@ func (s *Store) GetUserByID(id int) (*models.User, error) {
 
 	return &user, nil
 }
+
+func (s *Store) UpdateUserPassword(user *models.User, hashedPassword string) error {
+	result := s.db.Model(user).Update("password", hashedPassword)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update password: %w", result.Error)
+	}
+
+	return nil
+}
+
+func (s *Store) MarkEmailVerified(user *models.User) error {
+	result := s.db.Model(user).Update("email_verified_at", time.Now())
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark email as verified: %w", result.Error)
+	}
+
+	return nil
+}
+
+func (s *Store) UpdateUserTOTP(user *models.User) error {
+	result := s.db.Model(user).Select("totp_secret", "totp_enabled", "totp_last_counter", "recovery_codes").Updates(user)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update totp: %w", result.Error)
+	}
+
+	return nil
+}
+
+// Records counter as the last used TOTP time step. Returns false if an equal or later step was already used,
+// the conditional update makes concurrent requests with the same code fail.
+func (s *Store) UseTOTPCounter(user *models.User, counter int64) (bool, error) {
+	result := s.db.Model(user).Where("totp_last_counter < ?", counter).Update("totp_last_counter", counter)
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update totp counter: %w", result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// Replaces the user's recovery codes with remaining. Returns false if they changed since the user was read,
+// so a recovery code can only be consumed once.
+func (s *Store) UseRecoveryCode(user *models.User, remaining string) (bool, error) {
+	result := s.db.Model(user).Where("recovery_codes = ?", user.RecoveryCodes).Update("recovery_codes", remaining)
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update recovery codes: %w", result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (s *Store) GetUserByIdentity(issuer, subject string) (*models.User, error) {
+	var user models.User
+
+	result := s.db.Joins("JOIN user_identities ON user_identities.user_id = users.id AND user_identities.deleted_at IS NULL").
+		Where("user_identities.issuer = ? AND user_identities.subject = ?", issuer, subject).
+		First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, result.Error
+		}
+		return nil, fmt.Errorf("failed to find user by identity: %w", result.Error)
+	}
+
+	return &user, nil
+}
+
+func (s *Store) LinkIdentity(user *models.User, identity *models.UserIdentity) error {
+	identity.UserID = user.ID
+
+	if result := s.db.Create(identity); result.Error != nil {
+		return fmt.Errorf("failed to link identity: %w", result.Error)
+	}
+
+	return nil
+}
+
+// Creates a user signing up through an external provider together with its identity, so neither exists without the other
+func (s *Store) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (*models.User, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user with identity: %w", err)
+	}
+
+	return user, nil
+}
@@ -5,15 +5,32 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jose-lico/go-plate/apikeys"
 	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/auth/oidc"
+	"github.com/jose-lico/go-plate/auth/oidc/oidctest"
+	"github.com/jose-lico/go-plate/auth/onetime"
+	"github.com/jose-lico/go-plate/auth/totp"
+	"github.com/jose-lico/go-plate/config"
+	"github.com/jose-lico/go-plate/database/redistest"
 	"github.com/jose-lico/go-plate/examples/internal/models"
+	"github.com/jose-lico/go-plate/mail"
+	"github.com/jose-lico/go-plate/middleware"
+	"github.com/jose-lico/go-plate/sessions"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type testCase struct {
@@ -36,7 +53,8 @@ func TestUserService_CreateUser(t *testing.T) {
 
 	store := &MockUserStore{}
 	cache := &MockCacheStore{}
-	service := NewService(zap.NewExample(), store, cache)
+	manager := newSessionManager()
+	service := NewService(Deps{Logger: zap.NewExample(), Store: store, Redis: cache, Sessions: manager, Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard)})
 
 	for _, tc := range testData {
 		t.Run(tc.Name, func(t *testing.T) {
@@ -80,7 +98,8 @@ func TestUserService_LoginUser(t *testing.T) {
 
 	store := &MockUserStore{}
 	cache := &MockCacheStore{}
-	service := NewService(zap.NewExample(), store, cache)
+	manager := newSessionManager()
+	service := NewService(Deps{Logger: zap.NewExample(), Store: store, Redis: cache, Sessions: manager, Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard)})
 
 	for _, tc := range testData {
 		t.Run(tc.Name, func(t *testing.T) {
@@ -111,6 +130,550 @@ func TestUserService_LoginUser(t *testing.T) {
 	}
 }
 
+func TestUserService_Sessions(t *testing.T) {
+	manager := newSessionManager()
+	issuer := newIssuer(t)
+	service := NewService(Deps{Logger: zap.NewExample(), Store: &MockUserStore{}, Redis: &MockCacheStore{}, Sessions: manager, Tokens: issuer, Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard)})
+
+	router := http.ServeMux{}
+	router.Handle("GET /users/me/sessions", middleware.SessionMiddlewareBlocking(manager)(http.HandlerFunc(service.listSessions)))
+	router.Handle("DELETE /users/me/sessions/{id}", middleware.SessionMiddlewareBlocking(manager)(http.HandlerFunc(service.revokeSession)))
+	router.Handle("DELETE /users/me/sessions", middleware.SessionMiddlewareBlocking(manager)(http.HandlerFunc(service.revokeAllSessions)))
+
+	login := func(userAgent string) *http.Cookie {
+		req := httptest.NewRequest(http.MethodPost, "/users/login", nil)
+		req.Header.Set("User-Agent", userAgent)
+		rr := httptest.NewRecorder()
+		if _, err := manager.Create(rr, req, 1); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Result().Cookies()[0]
+	}
+
+	do := func(method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	laptop := login("laptop")
+	phone := login("phone")
+	tablet := login("tablet")
+
+	var list struct {
+		Sessions []SessionResponsePayload `json:"sessions"`
+	}
+
+	rr := do(http.MethodGet, "/users/me/sessions", laptop)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %d", len(list.Sessions))
+	}
+
+	var phoneID string
+	for _, session := range list.Sessions {
+		if session.UserAgent == "phone" {
+			phoneID = session.ID
+		}
+		if session.Current != (session.UserAgent == "laptop") {
+			t.Errorf("unexpected current flag for session %q", session.UserAgent)
+		}
+	}
+
+	if rr := do(http.MethodDelete, "/users/me/sessions/"+phoneID, laptop); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if rr := do(http.MethodGet, "/users/me/sessions", phone); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected revoked session to be unauthorized, got %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/users/me/sessions/"+phoneID, laptop); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	cli, err := issuer.Issue(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := do(http.MethodDelete, "/users/me/sessions", laptop); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	for _, cookie := range []*http.Cookie{laptop, tablet} {
+		if rr := do(http.MethodGet, "/users/me/sessions", cookie); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected revoked session to be unauthorized, got %d", rr.Code)
+		}
+	}
+	if _, err := issuer.Refresh(context.Background(), cli.RefreshToken); !errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		t.Errorf("expected refresh tokens to be revoked too, got %v", err)
+	}
+}
+
+func TestUserService_LoginRotatesSession(t *testing.T) {
+	manager := newSessionManager()
+	service := NewService(Deps{Logger: zap.NewExample(), Store: &MockUserStore{}, Redis: &MockCacheStore{}, Sessions: manager, Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard)})
+
+	rr := httptest.NewRecorder()
+	if _, err := manager.Create(rr, httptest.NewRequest(http.MethodPost, "/users/login", nil), 1); err != nil {
+		t.Fatal(err)
+	}
+	planted := rr.Result().Cookies()[0]
+
+	marshalled, err := json.Marshal(LoginUserPayload{Email: "example@email.com", Password: "MyPassword"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(marshalled))
+	req.AddCookie(planted)
+	rr = httptest.NewRecorder()
+	service.loginUser(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	issued := rr.Result().Cookies()[0]
+	if issued.Value == planted.Value {
+		t.Fatal("expected login to issue a new session token")
+	}
+
+	if _, err := manager.Get(req.Context(), planted.Value); !errors.Is(err, sessions.ErrSessionNotFound) {
+		t.Errorf("expected previous session to be destroyed, got %v", err)
+	}
+	if _, err := manager.Get(req.Context(), issued.Value); err != nil {
+		t.Errorf("expected new session to be valid, got %v", err)
+	}
+}
+
+func newSessionManager() *sessions.SessionManager {
+	cfg := &config.SessionConfig{}
+	if err := config.LoadFrom(func(key string) (string, bool) {
+		return "0123456789abcdef0123456789abcdef", key == "SESSION_SECRETS"
+	}, "SESSION_", cfg); err != nil {
+		panic(err)
+	}
+	return sessions.NewSessionManager(sessions.NewInMemoryStore(time.Minute), cfg)
+}
+
+func TestUserService_LoginWithTOTP(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &models.User{TOTPSecret: secret, TOTPEnabled: true}
+	u.ID = 1
+	u.Password, err = auth.HashPassword("MyPassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := newSessionManager()
+	service := NewService(Deps{Logger: zap.NewExample(), Store: &MockSingleUserStore{user: u}, Redis: &MockCacheStore{}, Sessions: manager, Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard)})
+
+	marshalled, err := json.Marshal(LoginUserPayload{Email: "example@email.com", Password: "MyPassword"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	service.loginUser(rr, httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(marshalled)))
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+	}
+
+	pending := rr.Result().Cookies()[0]
+	session, err := manager.Get(context.Background(), pending.Value)
+	if err != nil || !session.MFAPending {
+		t.Fatalf("expected an MFA pending session, got %v, %v", session, err)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := func() *httptest.ResponseRecorder {
+		marshalled, err := json.Marshal(MFACodePayload{Code: code})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/users/mfa/challenge", bytes.NewBuffer(marshalled))
+		req.AddCookie(pending)
+
+		rr := httptest.NewRecorder()
+		service.challengeMFA(rr, req)
+		return rr
+	}
+
+	rr = challenge()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	session, err = manager.Get(context.Background(), rr.Result().Cookies()[0].Value)
+	if err != nil || session.MFAPending {
+		t.Errorf("expected a full session, got %v, %v", session, err)
+	}
+
+	if _, err := manager.Get(context.Background(), pending.Value); !errors.Is(err, sessions.ErrSessionNotFound) {
+		t.Errorf("expected pending session token to be invalidated, got %v", err)
+	}
+
+	// Replaying the code on a new pending session must fail
+	rr = httptest.NewRecorder()
+	service.loginUser(rr, httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(marshalled)))
+	pending = rr.Result().Cookies()[0]
+
+	if rr = challenge(); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected replayed code to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestUserService_ResetPassword(t *testing.T) {
+	u := &models.User{Email: "example@email.com", Name: "José"}
+	u.ID = 1
+
+	manager := newSessionManager()
+	issuer := newIssuer(t)
+	tokens := newTokenService()
+	var outbox bytes.Buffer
+	service := NewService(Deps{Logger: zap.NewExample(), Store: &MockSingleUserStore{user: u}, Redis: &MockCacheStore{}, Sessions: manager, Tokens: issuer, Passwords: newPasswordPolicy(t), OneTime: tokens, Notifier: newNotifier(&outbox)})
+
+	rr := httptest.NewRecorder()
+	if _, err := manager.Create(rr, httptest.NewRequest(http.MethodPost, "/users/login", nil), int(u.ID)); err != nil {
+		t.Fatal(err)
+	}
+	existing := rr.Result().Cookies()[0]
+
+	pair, err := issuer.Issue(context.Background(), int(u.ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshalled, err := json.Marshal(ForgotPasswordPayload{Email: u.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	service.forgotPassword(rr, httptest.NewRequest(http.MethodPost, "/users/password/forgot", bytes.NewBuffer(marshalled)))
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+	}
+
+	match := regexp.MustCompile(`/reset-password\?token=([0-9a-f]+)`).FindStringSubmatch(outbox.String())
+	if match == nil {
+		t.Fatalf("expected a password reset link to be emailed, got %q", outbox.String())
+	}
+	token := match[1]
+
+	reset := func(token, password string) *httptest.ResponseRecorder {
+		marshalled, err := json.Marshal(ResetPasswordPayload{Token: token, Password: password})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		service.resetPassword(rr, httptest.NewRequest(http.MethodPost, "/users/password/reset", bytes.NewBuffer(marshalled)))
+		return rr
+	}
+
+	// A rejected password leaves the token usable
+	if rr := reset(token, "short"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	if rr := reset(token, "MyNewPassword"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if ok, _, err := auth.VerifyPassword(u.Password, "MyNewPassword"); !ok || err != nil {
+		t.Errorf("expected password to be updated, got %v, %v", ok, err)
+	}
+
+	if _, err := manager.Get(context.Background(), existing.Value); !errors.Is(err, sessions.ErrSessionNotFound) {
+		t.Errorf("expected existing sessions to be revoked, got %v", err)
+	}
+
+	if _, err := issuer.Refresh(context.Background(), pair.RefreshToken); !errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		t.Errorf("expected existing refresh tokens to be revoked, got %v", err)
+	}
+
+	if rr := reset(token, "MyOtherPassword"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected used token to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// Tokens are bound to their purpose
+	verification, err := tokens.Issue(context.Background(), onetime.EmailVerification, int(u.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := reset(verification, "MyOtherPassword"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected email verification token to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func newIssuer(t *testing.T) *jwt.Issuer {
+	redis, _ := redistest.New(t)
+	cfg := &config.JWTConfig{Issuer: "go-plate", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour, KeyPrefix: "refresh:"}
+	return jwt.NewIssuer(jwt.NewStaticKeySource(jwt.NewHS256Key([]byte("secret"))), redis, cfg)
+}
+
+func newNotifier(w io.Writer) *Notifier {
+	return NewNotifier(mail.NewFileMailer(w, "go-plate <no-reply@example.com>"), "http://localhost:3000")
+}
+
+func newTokenService() *onetime.TokenService {
+	return onetime.NewTokenService(onetime.NewInMemoryTokenStore(time.Minute), config.NewOneTimeTokenConfig())
+}
+
+func newPasswordPolicy(t *testing.T) *auth.PasswordPolicy {
+	cfg := config.NewPasswordConfig()
+	cfg.BreachedCorpusPath = "../../../data/breached_passwords"
+
+	policy, err := auth.NewPasswordPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestUserService_LoginRehashesLegacyPassword(t *testing.T) {
+	legacyHash, err := auth.NewBcryptHasher(bcrypt.DefaultCost).Hash("MyPassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &MockLegacyHashUserStore{hash: legacyHash}
+	service := NewService(Deps{Logger: zap.NewExample(), Store: store, Redis: &MockCacheStore{}, Sessions: newSessionManager(), Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard)})
+
+	marshalled, err := json.Marshal(LoginUserPayload{Email: "example@email.com", Password: "MyPassword"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	service.loginUser(rr, httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewBuffer(marshalled)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if !strings.HasPrefix(store.hash, "$argon2id$") {
+		t.Fatalf("expected password to be rehashed with argon2id, got %q", store.hash)
+	}
+
+	if ok, needsRehash, err := auth.VerifyPassword(store.hash, "MyPassword"); !ok || needsRehash || err != nil {
+		t.Errorf("expected rehashed password to verify, got ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+}
+
+func TestUserService_APIKeys(t *testing.T) {
+	manager := apikeys.NewAPIKeyManager(&MockAPIKeyStore{}, config.NewAPIKeyConfig())
+	service := NewService(Deps{Logger: zap.NewExample(), Store: &MockUserStore{}, Redis: &MockCacheStore{}, Sessions: newSessionManager(), Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard), APIKeys: manager})
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: 1, Method: auth.MethodSession})
+
+	marshalled, err := json.Marshal(CreateAPIKeyPayload{Name: "CI", Scopes: []string{"posts:write"}, ExpiresInDays: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	service.createAPIKey(rr, httptest.NewRequest(http.MethodPost, "/users/me/api-keys", bytes.NewBuffer(marshalled)).WithContext(ctx))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	var created CreateAPIKeyResponse
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(created.Key, created.Prefix+"_") {
+		t.Fatalf("expected key %q to start with its prefix %q", created.Key, created.Prefix)
+	}
+
+	protected := middleware.APIKeyMiddleware(manager)(middleware.RequireAPIKeyScope("posts:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.MustFromContext(r.Context())
+		w.Write([]byte(strconv.Itoa(principal.UserID)))
+	})))
+
+	authenticate := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/posts", nil)
+		req.Header.Set(header, value)
+
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := authenticate("X-API-Key", created.Key); rr.Code != http.StatusOK || rr.Body.String() != "1" {
+		t.Errorf("expected key to authenticate user 1, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := authenticate("Authorization", "Bearer "+created.Key); rr.Code != http.StatusOK {
+		t.Errorf("expected key to authenticate as a bearer token, got %d", rr.Code)
+	}
+	if rr := authenticate("X-API-Key", created.Key[:len(created.Key)-1]+"x"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected tampered key to be rejected with %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	unscoped, _, err := manager.Issue(context.Background(), 1, "read only", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := authenticate("X-API-Key", unscoped); rr.Code != http.StatusForbidden {
+		t.Errorf("expected key without scope to be rejected with %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/api-keys/"+strconv.Itoa(int(created.ID)), nil).WithContext(ctx)
+	req.SetPathValue("id", strconv.Itoa(int(created.ID)))
+
+	rr = httptest.NewRecorder()
+	service.revokeAPIKey(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if rr := authenticate("X-API-Key", created.Key); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected revoked key to be rejected with %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestUserService_OIDCLogin(t *testing.T) {
+	provider := oidctest.NewProvider("go-plate", "client-secret")
+	defer provider.Close()
+
+	client, err := oidc.NewClient(context.Background(), &config.OIDCConfig{
+		IssuerURL:    provider.Issuer(),
+		ClientID:     "go-plate",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8080/api/v1/users/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		PostLoginURL: "/app",
+		CookieName:   "oidc_auth",
+		StateTTL:     time.Minute,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifiedAt := time.Now()
+	store := &MockOIDCUserStore{identities: make(map[string]*models.User)}
+	store.add(&models.User{Email: "linked@example.com", EmailVerifiedAt: &verifiedAt})
+	store.add(&models.User{Email: "unverified@example.com"})
+	store.add(&models.User{Email: "mfa@example.com", EmailVerifiedAt: &verifiedAt, TOTPEnabled: true})
+
+	manager := newSessionManager()
+	service := NewService(Deps{Logger: zap.NewExample(), Store: store, Redis: &MockCacheStore{}, Sessions: manager, Passwords: newPasswordPolicy(t), OneTime: newTokenService(), Notifier: newNotifier(io.Discard), OIDC: client})
+
+	// Runs the whole flow through the mock provider, returning the callback response
+	login := func(tamper func(callback *http.Request)) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		service.oidcLogin(rr, httptest.NewRequest(http.MethodGet, "/users/oidc/login", nil))
+		if rr.Code != http.StatusFound {
+			t.Fatalf("expected login to redirect with %d, got %d", http.StatusFound, rr.Code)
+		}
+
+		callbackURL, err := provider.Authorize(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		callback := httptest.NewRequest(http.MethodGet, callbackURL.String(), nil)
+		for _, cookie := range rr.Result().Cookies() {
+			callback.AddCookie(cookie)
+		}
+		if tamper != nil {
+			tamper(callback)
+		}
+
+		rr = httptest.NewRecorder()
+		service.oidcCallback(rr, callback)
+		return rr
+	}
+
+	sessionUser := func(rr *httptest.ResponseRecorder) *sessions.Session {
+		for _, cookie := range rr.Result().Cookies() {
+			if cookie.Name != "oidc_auth" && cookie.Value != "" {
+				session, err := manager.Get(context.Background(), cookie.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return session
+			}
+		}
+		t.Fatal("expected a session cookie")
+		return nil
+	}
+
+	provider.SetUser(oidctest.User{Subject: "new", Email: "New@Example.com", EmailVerified: true, Name: "New User"})
+	rr := login(nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/app" {
+		t.Fatalf("expected redirect to /app, got %d %q: %s", rr.Code, rr.Header().Get("Location"), rr.Body.String())
+	}
+
+	registered := store.users[len(store.users)-1]
+	if registered.Email != "new@example.com" || registered.Name != "New User" || registered.EmailVerifiedAt == nil {
+		t.Errorf("expected a verified user to be registered, got %+v", registered)
+	}
+	if session := sessionUser(rr); session.UserID != int(registered.ID) || session.MFAPending {
+		t.Errorf("expected a session for user %d, got %+v", registered.ID, session)
+	}
+
+	users := len(store.users)
+	if rr := login(nil); rr.Code != http.StatusFound || sessionUser(rr).UserID != int(registered.ID) || len(store.users) != users {
+		t.Errorf("expected the same identity to log in as user %d without registering again", registered.ID)
+	}
+
+	provider.SetUser(oidctest.User{Subject: "linked", Email: "linked@example.com", EmailVerified: true})
+	if rr := login(nil); rr.Code != http.StatusFound || sessionUser(rr).UserID != 1 || store.identities[provider.Issuer()+"|linked"] == nil {
+		t.Errorf("expected the identity to be linked to the existing user, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	provider.SetUser(oidctest.User{Subject: "unverified", Email: "unverified@example.com", EmailVerified: true})
+	if rr := login(nil); rr.Code != http.StatusConflict {
+		t.Errorf("expected linking to an unverified account to fail with %d, got %d", http.StatusConflict, rr.Code)
+	}
+
+	provider.SetUser(oidctest.User{Subject: "unasserted", Email: "unasserted@example.com", EmailVerified: false})
+	if rr := login(nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected an unverified provider email to fail with %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	provider.SetUser(oidctest.User{Subject: "mfa", Email: "mfa@example.com", EmailVerified: true})
+	if rr := login(nil); rr.Code != http.StatusFound || rr.Header().Get("Location") != "/app?mfa=required" || !sessionUser(rr).MFAPending {
+		t.Errorf("expected a pending MFA session, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = login(func(callback *http.Request) {
+		query := callback.URL.Query()
+		query.Set("state", "forged")
+		callback.URL.RawQuery = query.Encode()
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a forged state to fail with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	provider.Deny("access_denied")
+	if rr := login(nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a denied login to fail with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
 type MockUserStore struct{}
 
 func (s *MockUserStore) CreateUser(user *models.User) (*models.User, error) {
@@ -139,6 +702,123 @@ func (s *MockUserStore) GetUserByID(id int) (*models.User, error) {
 	return nil, nil
 }
 
+func (s *MockUserStore) UpdateUserPassword(user *models.User, hashedPassword string) error {
+	return nil
+}
+
+func (s *MockUserStore) MarkEmailVerified(user *models.User) error {
+	return nil
+}
+
+func (s *MockUserStore) UpdateUserTOTP(user *models.User) error {
+	return nil
+}
+
+func (s *MockUserStore) UseTOTPCounter(user *models.User, counter int64) (bool, error) {
+	return true, nil
+}
+
+func (s *MockUserStore) UseRecoveryCode(user *models.User, remaining string) (bool, error) {
+	return true, nil
+}
+
+func (s *MockUserStore) GetUserByIdentity(issuer, subject string) (*models.User, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *MockUserStore) LinkIdentity(user *models.User, identity *models.UserIdentity) error {
+	return nil
+}
+
+func (s *MockUserStore) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (*models.User, error) {
+	return user, nil
+}
+
+type MockLegacyHashUserStore struct {
+	MockUserStore
+	hash string
+}
+
+func (s *MockLegacyHashUserStore) GetUserByEmail(email string) (*models.User, error) {
+	u := &models.User{Password: s.hash}
+	u.ID = 1
+	return u, nil
+}
+
+func (s *MockLegacyHashUserStore) UpdateUserPassword(user *models.User, hashedPassword string) error {
+	s.hash = hashedPassword
+	return nil
+}
+
+type MockSingleUserStore struct {
+	MockUserStore
+	user *models.User
+}
+
+func (s *MockSingleUserStore) GetUserByEmail(email string) (*models.User, error) {
+	return s.user, nil
+}
+
+func (s *MockSingleUserStore) GetUserByID(id int) (*models.User, error) {
+	return s.user, nil
+}
+
+func (s *MockSingleUserStore) UpdateUserPassword(user *models.User, hashedPassword string) error {
+	s.user.Password = hashedPassword
+	return nil
+}
+
+func (s *MockSingleUserStore) MarkEmailVerified(user *models.User) error {
+	now := time.Now()
+	s.user.EmailVerifiedAt = &now
+	return nil
+}
+
+func (s *MockSingleUserStore) UseTOTPCounter(user *models.User, counter int64) (bool, error) {
+	if counter <= s.user.TOTPLastCounter {
+		return false, nil
+	}
+	s.user.TOTPLastCounter = counter
+	return true, nil
+}
+
+type MockOIDCUserStore struct {
+	MockUserStore
+	users      []*models.User
+	identities map[string]*models.User
+}
+
+func (s *MockOIDCUserStore) add(user *models.User) *models.User {
+	user.ID = uint(len(s.users) + 1)
+	s.users = append(s.users, user)
+	return user
+}
+
+func (s *MockOIDCUserStore) GetUserByEmail(email string) (*models.User, error) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *MockOIDCUserStore) GetUserByIdentity(issuer, subject string) (*models.User, error) {
+	if user, ok := s.identities[issuer+"|"+subject]; ok {
+		return user, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *MockOIDCUserStore) LinkIdentity(user *models.User, identity *models.UserIdentity) error {
+	s.identities[identity.Issuer+"|"+identity.Subject] = user
+	return nil
+}
+
+func (s *MockOIDCUserStore) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (*models.User, error) {
+	return s.add(user), s.LinkIdentity(user, identity)
+}
+
 type MockCacheStore struct{}
 
 func (s *MockCacheStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
@@ -147,5 +827,47 @@ func (s *MockCacheStore) Set(ctx context.Context, key string, value interface{},
 func (s *MockCacheStore) Get(ctx context.Context, key string) (string, error)           { return "", nil }
 func (s *MockCacheStore) SAdd(ctx context.Context, key string, value interface{}) error { return nil }
 func (s *MockCacheStore) SRem(ctx context.Context, key string, value interface{}) error { return nil }
+func (s *MockCacheStore) SMembers(ctx context.Context, key string) ([]string, error)    { return nil, nil }
 func (s *MockCacheStore) Del(ctx context.Context, key string) (int64, error)            { return 1, nil }
+func (s *MockCacheStore) Ping(ctx context.Context) error                                { return nil }
 func (s *MockCacheStore) GetNativeInstance() interface{}                                { return nil }
+func (s *MockCacheStore) Close() error                                                  { return nil }
+
+type MockAPIKeyStore struct {
+	keys []*apikeys.APIKey
+}
+
+func (s *MockAPIKeyStore) Create(ctx context.Context, key *apikeys.APIKey) error {
+	key.ID = uint(len(s.keys) + 1)
+	key.CreatedAt = time.Now()
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+func (s *MockAPIKeyStore) GetByPrefix(ctx context.Context, prefix string) (*apikeys.APIKey, error) {
+	for _, key := range s.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, apikeys.ErrAPIKeyNotFound
+}
+
+func (s *MockAPIKeyStore) ListForUser(ctx context.Context, userID uint) ([]*apikeys.APIKey, error) {
+	return s.keys, nil
+}
+
+func (s *MockAPIKeyStore) Revoke(ctx context.Context, userID, id uint, at time.Time) error {
+	for _, key := range s.keys {
+		if key.ID == id && key.UserID == userID && key.RevokedAt == nil {
+			key.RevokedAt = &at
+			return nil
+		}
+	}
+	return apikeys.ErrAPIKeyNotFound
+}
+
+func (s *MockAPIKeyStore) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return nil
+}
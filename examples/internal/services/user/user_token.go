@@ -0,0 +1,130 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/utils"
+	"go.uber.org/zap"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// @Summary Create access token
+// @Description Authenticates a user and issues an access token and a refresh token, for clients that can not use the session cookie. Users with two-factor authentication must also send a code or recovery code.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param user body LoginUserPayload true "Login credentials"
+// @Success 200 {object} jwt.TokenPair "Token pair"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} utils.ErrorResponse "Invalid credentials, or second factor required"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/token [post]
+func (s *Service) createToken(w http.ResponseWriter, r *http.Request) {
+	var user LoginUserPayload
+	u, ok := s.authenticate(w, r, &user)
+	if !ok {
+		return
+	}
+
+	if u.TOTPEnabled {
+		if user.Code == "" && user.RecoveryCode == "" {
+			utils.WriteError(w, http.StatusUnauthorized, errMFARequired)
+			return
+		}
+
+		if !s.verifySecondFactor(w, u, MFACodePayload{Code: user.Code, RecoveryCode: user.RecoveryCode}) {
+			return
+		}
+	}
+
+	pair, err := s.tokens.Issue(r.Context(), int(u.ID), nil)
+	if err != nil {
+		s.logger.Error("Error issuing tokens", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pair)
+}
+
+// @Summary Refresh access token
+// @Description Exchanges a refresh token for a new token pair. Refresh tokens are single use, reusing one revokes every token issued from the same login.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param token body RefreshTokenPayload true "Refresh token"
+// @Success 200 {object} jwt.TokenPair "Token pair"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} utils.ErrorResponse "Invalid refresh token"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/token/refresh [post]
+func (s *Service) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if !s.parseRefreshTokenPayload(w, r, &payload) {
+		return
+	}
+
+	pair, err := s.tokens.Refresh(r.Context(), payload.RefreshToken)
+	if errors.Is(err, jwt.ErrRefreshTokenReused) {
+		s.logger.Warn("Refresh token reuse detected, token family revoked")
+		utils.WriteError(w, http.StatusUnauthorized, jwt.ErrInvalidRefreshToken)
+		return
+	} else if errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	} else if err != nil {
+		s.logger.Error("Error refreshing tokens", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pair)
+}
+
+// @Summary Revoke refresh token
+// @Description Revokes a refresh token and every token issued from the same login.
+// @Tags Users
+// @Accept json
+// @Param token body RefreshTokenPayload true "Refresh token"
+// @Success 204 "Token revoked successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request payload"
+// @Failure 401 {object} utils.ErrorResponse "Invalid refresh token"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /v1/users/token/revoke [post]
+func (s *Service) revokeToken(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if !s.parseRefreshTokenPayload(w, r, &payload) {
+		return
+	}
+
+	err := s.tokens.Revoke(r.Context(), payload.RefreshToken)
+	if errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	} else if err != nil {
+		s.logger.Error("Error revoking tokens", zap.Error(err))
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) parseRefreshTokenPayload(w http.ResponseWriter, r *http.Request, payload *RefreshTokenPayload) bool {
+	if err := utils.ParseJSON(r, payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return false
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return false
+	}
+
+	return true
+}
@@ -1,12 +1,123 @@
 package user
 
+import (
+	"time"
+
+	"github.com/jose-lico/go-plate/apikeys"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/sessions"
+)
+
 type RegisterUserPayload struct {
 	Email    string `json:"email" validate:"required,min=6,max=254,email" example:"example@email.com"`
 	Name     string `json:"name" validate:"required,min=2,max=32" example:"John"`
-	Password string `json:"password" validate:"required,min=7,max=16" example:"password"`
+	Password string `json:"password" validate:"required" example:"correct-horse-battery-staple"`
+}
+
+type PasswordRejectedResponse struct {
+	Error   string                   `json:"error" example:"password does not meet requirements"`
+	Reasons []auth.PasswordViolation `json:"reasons"`
 }
 
 type LoginUserPayload struct {
 	Email    string `json:"email" validate:"required,email" example:"example@email.com"`
 	Password string `json:"password" validate:"required" example:"password"`
+
+	// Only used by /token for users with two-factor authentication, session logins use /mfa/challenge
+	Code         string `json:"code,omitempty" validate:"omitempty,numeric,len=6" example:"123456"`
+	RecoveryCode string `json:"recovery_code,omitempty" example:"abcde-fghjk"`
+}
+
+type MFARequiredResponse struct {
+	MFARequired bool `json:"mfa_required" example:"true"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required,numeric,len=6" example:"123456"`
+}
+
+type MFACodePayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6" example:"123456"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code" example:"abcde-fghjk"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	URI    string `json:"uri" example:"otpauth://totp/go-plate:example@email.com?secret=JBSWY3DPEHPK3PXP&issuer=go-plate"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email" example:"example@email.com"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required" example:"correct-horse-battery-staple"`
+}
+
+type VerifyEmailPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type SessionResponsePayload struct {
+	ID           string    `json:"id"`
+	UserAgent    string    `json:"user_agent"`
+	IPAddress    string    `json:"ip_address"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastAccessed time.Time `json:"last_accessed"`
+	Current      bool      `json:"current"`
+}
+
+func SessionToResponsePayload(s *sessions.Session, currentID string) SessionResponsePayload {
+	return SessionResponsePayload{
+		ID:           s.ID,
+		UserAgent:    s.UserAgent,
+		IPAddress:    s.IPAddress,
+		CreatedAt:    s.CreatedAt,
+		LastAccessed: s.LastAccessed,
+		Current:      s.ID == currentID,
+	}
+}
+
+type CreateAPIKeyPayload struct {
+	Name          string   `json:"name" validate:"required,max=64" example:"CI deploys"`
+	Scopes        []string `json:"scopes" validate:"max=16,dive,oneof=posts:write" example:"posts:write"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" validate:"omitempty,min=1,max=365" example:"90"`
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" example:"gp_abcdefgh"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateAPIKeyResponse struct {
+	Key string `json:"key" example:"gp_abcdefgh_0123456789abcdef"`
+	APIKeyResponse
+}
+
+func APIKeyToResponse(k *apikeys.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+	}
 }
@@ -2,22 +2,31 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/jose-lico/go-plate/api"
+	"github.com/jose-lico/go-plate/apikeys"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/auth/oidc"
+	"github.com/jose-lico/go-plate/auth/onetime"
+	"github.com/jose-lico/go-plate/authz"
 	"github.com/jose-lico/go-plate/config"
 	"github.com/jose-lico/go-plate/database"
 	"github.com/jose-lico/go-plate/examples/internal/services/post"
 	"github.com/jose-lico/go-plate/examples/internal/services/user"
+	"github.com/jose-lico/go-plate/flags"
 	"github.com/jose-lico/go-plate/logger"
+	"github.com/jose-lico/go-plate/mail"
 	"github.com/jose-lico/go-plate/middleware"
+	"github.com/jose-lico/go-plate/ratelimiting"
+	"github.com/jose-lico/go-plate/sessions"
 
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -26,6 +35,9 @@ import (
 	_ "github.com/jose-lico/go-plate/docs"
 )
 
+// Admins have every permission, including this one. API keys can't be issued with it as a scope, so only sessions and access tokens get it.
+const PermissionReadConfig authz.Permission = "config:read"
+
 // @title go-plate example API
 // @description This is an example API, that interacts with a postgres DB and redis cache.
 // @description It can create users, posts and handle sessions.
@@ -50,25 +62,95 @@ func main() {
 	zap.ReplaceGlobals(logger)
 	defer logger.Sync()
 
+	// Load the configuration of every component from files, env variables and flags, reporting all bad or missing variables at once
+	cliFlags, args, err := config.ParseFlags(os.Args[1:])
+	if err != nil {
+		logger.Fatal("Error parsing flags", zap.Error(err))
+	}
+
+	sources := &config.Sources{Profile: env, Flags: cliFlags}
+	cfg, report, err := config.NewConfig(sources)
+
+	// `config dump` prints the effective configuration and exits, without connecting to anything
+	if slices.Equal(args, []string{"config", "dump"}) {
+		os.Exit(dumpConfig(report, err))
+	}
+
+	if err != nil {
+		logger.Fatal("Error loading configuration", zap.Error(err))
+	}
+	for _, unused := range report.Unused {
+		logger.Warn("Unknown configuration variable", zap.String("variable", unused))
+	}
+	for _, warning := range report.Warnings {
+		logger.Warn("Suspicious configuration", zap.String("warning", warning))
+	}
+	logger.Debug("Loaded configuration", zap.String("sources", report.String()))
+
 	// Setup sql
-	sqlCFG := config.NewSQLConfig()
-	sql, err := database.NewSQLGormDB(sqlCFG, logger)
+	sql, err := database.NewSQLGormDB(&cfg.SQL, logger)
 	if err != nil {
 		logger.Fatal("Error connecting to SQL", zap.Error(err))
 	}
 
 	// Setup redis
-	redisCFG := config.NewRedisConfig()
-	redis, err := database.NewRedis(redisCFG, logger)
+	redis, err := database.NewRedis(&cfg.Redis, logger)
 	if err != nil {
 		logger.Fatal("Error connecting to Redis", zap.Error(err))
 	}
 
+	// Setup sessions
+	sessionManager := sessions.NewSessionManager(sessions.NewRedisStore(redis, cfg.Session.KeyPrefix), &cfg.Session)
+
+	// Setup tokens for clients that can't use session cookies
+	jwtKeys, err := jwt.NewKeySourceFromConfig(context.Background(), redis, &cfg.JWT)
+	if err != nil {
+		logger.Fatal("Error creating JWT keys", zap.Error(err))
+	}
+	tokenIssuer := jwt.NewIssuer(jwtKeys, redis, &cfg.JWT)
+
+	// Setup single use tokens for password reset and email verification
+	onetimeTokens := onetime.NewTokenService(onetime.NewRedisTokenStore(redis, cfg.OneTime.KeyPrefix), &cfg.OneTime)
+
+	// Setup outbound email, sent in the background
+	mailTransport, err := mail.NewTransport(env, &cfg.Mail)
+	if err != nil {
+		logger.Fatal("Error creating mail transport", zap.Error(err))
+	}
+	mailQueue := mail.NewQueue(mailTransport, &cfg.Mail)
+	notifier := user.NewNotifier(mailQueue, cfg.Mail.LinkBaseURL)
+
+	// Setup api keys for machine clients
+	apiKeyManager := apikeys.NewAPIKeyManager(apikeys.NewGormStore(sql), &cfg.APIKey)
+
+	// Setup login with an external identity provider, only when one is configured
+	var oidcClient *oidc.Client
+	if cfg.OIDC.IssuerURL != "" {
+		oidcClient, err = oidc.NewClient(context.Background(), &cfg.OIDC, nil)
+		if err != nil {
+			logger.Fatal("Error creating OIDC client", zap.Error(err))
+		}
+	}
+
+	// Setup password policy
+	passwordPolicy, err := auth.NewPasswordPolicy(&cfg.Password)
+	if err != nil {
+		logger.Fatal("Error creating password policy", zap.Error(err))
+	}
+
 	// Setup api server
-	cfg := config.NewAPIConfig()
-	api := api.NewAPIServer(cfg)
+	api := api.NewAPIServer(&cfg.API)
 	api.UseDefaultMiddleware(env, logger)
 
+	// Setup feature flags, only when a backend is configured
+	if cfg.Flags.Backend != "" {
+		flagStore := flags.NewFileStore(cfg.Flags.FilePath)
+		if cfg.Flags.Backend == "redis" {
+			flagStore = flags.NewRedisStore(redis, cfg.Flags.KeyPrefix)
+		}
+		api.Router.Use(flags.NewClient(flagStore, cfg.Flags.RefreshInterval).Middleware)
+	}
+
 	subRouter := chi.NewRouter()
 	api.Router.Mount("/api", subRouter)
 
@@ -79,45 +161,125 @@ func main() {
 	v1Router.Use(middleware.VersionURLMiddleware("v1"))
 	v2Router.Use(middleware.VersionURLMiddleware("v2"))
 
+	csrf := middleware.NewCSRF(&cfg.CSRF, cfg.API.AllowedOrigins, sessionManager)
+
+	// Setup rate limiters, their limits can be changed by reloading the config
+	authLimiter := ratelimiting.NewInMemoryTokenBucket(cfg.RateLimit.AuthRate, cfg.RateLimit.AuthCapacity, 10*time.Minute)
+	postsLimiter := ratelimiting.NewRedisTokenBucket("/posts", redis, cfg.RateLimit.PostsRate, cfg.RateLimit.PostsCapacity, 10*time.Minute)
+
+	// Reload the config on SIGHUP or when its files change, applying CORS origins and rate limits without a restart
+	watcher := config.NewWatcher(sources, cfg, report, cfg.API.ConfigPollInterval)
+	watcher.Subscribe(func(old, new *config.Config) {
+		api.UpdateCORS(&new.API)
+		csrf.SetAllowedOrigins(new.API.AllowedOrigins)
+
+		for limiter, limits := range map[ratelimiting.RateLimiter][2]float64{
+			authLimiter:  {new.RateLimit.AuthRate, new.RateLimit.AuthCapacity},
+			postsLimiter: {new.RateLimit.PostsRate, new.RateLimit.PostsCapacity},
+		} {
+			adjustable, ok := limiter.(ratelimiting.Adjustable)
+			if !ok {
+				logger.Warn("Rate limiter can't change its limits, restart to apply them", zap.String("limiter", fmt.Sprintf("%T", limiter)))
+				continue
+			}
+			if err := adjustable.SetLimits(limits[0], limits[1]); err != nil {
+				logger.Error("Error updating rate limits", zap.Error(err))
+			}
+		}
+
+		logger.Info("Reloaded configuration")
+	})
+
+	// SIGHUP terminates the process until it is registered, so register it before anything starts
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	go watcher.RunWithSignals(watchCtx, hangup)
+	api.OnShutdown("config", func(ctx context.Context) error {
+		stopWatching()
+		signal.Stop(hangup)
+		return nil
+	})
+
 	userStore := user.NewStore(sql)
-	userService := user.NewService(logger, userStore, redis)
+	userService := user.NewService(user.Deps{
+		Logger:    logger,
+		Store:     userStore,
+		Redis:     redis,
+		Sessions:  sessionManager,
+		Tokens:    tokenIssuer,
+		Passwords: passwordPolicy,
+		OneTime:   onetimeTokens,
+		Notifier:  notifier,
+		APIKeys:   apiKeyManager,
+		CSRF:      csrf,
+		OIDC:      oidcClient,
+		Limiter:   authLimiter,
+	})
 	userRouter := userService.RegisterRoutes(v1Router)
 
+	// Admins can do anything, users can write and manage their own posts
+	authorizer := authz.NewAuthorizer(authz.NewPolicy(map[authz.Role][]authz.Permission{
+		authz.RoleAdmin: {authz.AllPermissions},
+		authz.RoleUser:  {post.PermissionWritePosts},
+	}), user.NewRoleResolver(userStore))
+
 	postStore := post.NewStore(sql)
-	postServer := post.NewService(logger, postStore, redis)
+	postServer := post.NewService(post.Deps{
+		Logger:   logger,
+		Store:    postStore,
+		Redis:    redis,
+		Sessions: sessionManager,
+		Tokens:   tokenIssuer,
+		APIKeys:  apiKeyManager,
+		Authz:    authorizer,
+		CSRF:     csrf,
+		Limiter:  postsLimiter,
+	})
 	postServer.RegisterRoutes(v1Router, v2Router, userRouter)
 
+	// Effective configuration with its sources, for admins only
+	api.UseConfigEndpoint(watcher.Report,
+		middleware.SessionMiddleware(sessionManager),
+		middleware.APIKeyMiddleware(apiKeyManager),
+		middleware.BearerAuthMiddleware(tokenIssuer),
+		authorizer.Middleware,
+		authorizer.Require(PermissionReadConfig),
+	)
+
 	api.Router.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL(fmt.Sprintf("http://%s:%s/swagger/doc.json", cfg.Host, cfg.Port)),
+		httpSwagger.URL(fmt.Sprintf("http://%s:%s/swagger/doc.json", cfg.API.Host, cfg.API.Port)),
 	))
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-sigterm
-		logger.Info("Received termination signal, shutting down...")
-		stop()
-	}()
-
-	go func() {
-		logger.Info("Starting API server", zap.String("Address", api.Server.Addr))
-		if err := api.Server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Fatal("Failed ListenAndServe()", zap.Error(err))
-		}
-
-		logger.Info("Stopped serving new connections")
-	}()
+	if keyManager, ok := jwtKeys.(*jwt.KeyManager); ok {
+		api.UseJWKS(keyManager)
+	}
 
-	<-ctx.Done()
+	api.AddHealthCheck(database.NewSQLGormHealthCheck(sql), 0)
+	api.AddHealthCheck(database.NewRedisHealthCheck(redis), 0)
 
-	shutdownContext, shutdownCancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer shutdownCancel()
+	// Flush queued emails, dropping what is left once the shutdown timeout is reached
+	api.OnShutdown("mail", mailQueue.Close)
+	api.OnShutdown("postgres", func(ctx context.Context) error {
+		return database.CloseSQLGormDB(sql)
+	})
+	api.OnShutdown("redis", func(ctx context.Context) error {
+		return redis.Close()
+	})
 
-	if err := api.Server.Shutdown(shutdownContext); err != nil {
-		logger.Error("Server shutdown returned an error", zap.Error(err))
+	if err := api.Run(context.Background()); err != nil {
+		logger.Fatal("Error running API server", zap.Error(err))
 	}
+}
 
-	logger.Info("Server shutdown")
+// Prints the report of `config dump`, failing if the configuration is invalid
+func dumpConfig(report *config.Report, err error) int {
+	if report != nil {
+		fmt.Print(report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
@@ -33,19 +33,17 @@ func main() {
 		}
 	}
 
-	cfg := config.NewSQLConfig()
+	layers, err := (&config.Sources{Profile: env}).Layers()
+	if err != nil {
+		log.Fatalf("[FATAL] Error reading config files: %v", err)
+	}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s%s",
-		cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.DatabaseName,
-		cfg.SSLMode,
-		func() string {
-			if cfg.SSLMode == "verify-full" {
-				return fmt.Sprintf(" sslrootcert=%s", "cert will be here in the future")
-			}
-			return ""
-		}())
+	cfg := &config.SQLGormConfig{}
+	if _, err := config.LoadLayers(layers, "SQL_", cfg); err != nil {
+		log.Fatalf("[FATAL] Error loading configuration: %v", err)
+	}
 
-	db, err := sqlx.Open("postgres", dsn)
+	db, err := sqlx.Open("postgres", cfg.DSN())
 	if err != nil {
 		log.Fatalf("Could not connect to the database: %v\n", err)
 	}
@@ -0,0 +1 @@
+-- Intentionally a no-op: argon2id hashes are longer than 64 characters, narrowing the column would fail once any is stored
@@ -0,0 +1,2 @@
+ALTER TABLE users
+ALTER COLUMN password TYPE VARCHAR(255);
\ No newline at end of file
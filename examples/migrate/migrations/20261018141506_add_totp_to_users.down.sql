@@ -0,0 +1,5 @@
+ALTER TABLE users
+DROP COLUMN totp_secret,
+DROP COLUMN totp_enabled,
+DROP COLUMN totp_last_counter,
+DROP COLUMN recovery_codes;
\ No newline at end of file
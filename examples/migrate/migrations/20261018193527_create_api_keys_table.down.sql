@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS update_api_key_modtime ON api_keys;
+
+DROP INDEX IF EXISTS idx_api_keys_user_id;
+
+DROP TABLE IF EXISTS api_keys;
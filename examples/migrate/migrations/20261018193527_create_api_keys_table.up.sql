@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+
+    user_id INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    secret_hash VARCHAR(64) NOT NULL,
+    scopes TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+
+CREATE TRIGGER update_api_key_modtime
+    BEFORE UPDATE ON api_keys
+    FOR EACH ROW
+    EXECUTE PROCEDURE update_modified_column();
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS update_user_identity_modtime ON user_identities;
+
+DROP INDEX IF EXISTS idx_user_identities_user_id;
+DROP INDEX IF EXISTS idx_user_identities_issuer_subject;
+
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+
+    user_id INTEGER NOT NULL,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX idx_user_identities_issuer_subject ON user_identities(issuer, subject);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+CREATE TRIGGER update_user_identity_modtime
+    BEFORE UPDATE ON user_identities
+    FOR EACH ROW
+    EXECUTE PROCEDURE update_modified_column();
@@ -0,0 +1,177 @@
+package flags
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/authz"
+
+	"go.uber.org/zap"
+)
+
+type contextKey string
+
+const requestKey contextKey = "flags"
+
+// Serves flags from a store, reading them again once refreshInterval has passed.
+// If the store fails, the flags last read keep being served.
+type Client struct {
+	store           Store
+	refreshInterval time.Duration
+
+	mu          sync.Mutex
+	flags       map[string]*Flag
+	refreshedAt time.Time
+}
+
+func NewClient(store Store, refreshInterval time.Duration) *Client {
+	if store == nil || refreshInterval <= 0 {
+		zap.L().Fatal("Invalid parameters for flags Client")
+	}
+
+	return &Client{store: store, refreshInterval: refreshInterval}
+}
+
+// Current flags, refreshed from the store when stale
+func (c *Client) Flags(ctx context.Context) map[string]*Flag {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.flags != nil && time.Since(c.refreshedAt) < c.refreshInterval {
+		return c.flags
+	}
+
+	// Failures are only retried after the interval, not on every request
+	c.refreshedAt = time.Now()
+
+	flags, err := c.store.Flags(ctx)
+	if err != nil {
+		zap.L().Error("Error reading feature flags, serving the last ones read", zap.Error(err))
+		if c.flags == nil {
+			c.flags = make(map[string]*Flag)
+		}
+		return c.flags
+	}
+
+	c.flags = flags
+	return flags
+}
+
+func (c *Client) Evaluate(ctx context.Context, key string, subject Subject) Evaluation {
+	flag, ok := c.Flags(ctx)[key]
+	if !ok {
+		return Evaluation{Key: key, Reason: ReasonNotFound}
+	}
+	return flag.Evaluate(subject)
+}
+
+// Flags and evaluations of a single request, so a flag evaluates the same however many times it is checked
+type requestFlags struct {
+	flags map[string]*Flag
+
+	mu    sync.Mutex
+	cache map[cacheKey]Evaluation
+}
+
+// The same request is evaluated again once authenticated or once its roles are known
+type cacheKey struct {
+	flag      string
+	principal *auth.Principal
+	roles     bool
+}
+
+// Makes flags available to Enabled, Variant and All for the rest of the request.
+// It can run before authentication, flags are evaluated for the principal in the context they are checked with.
+func (c *Client) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rf := &requestFlags{flags: c.Flags(r.Context()), cache: make(map[cacheKey]Evaluation)}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestKey, rf)))
+	})
+}
+
+// Builds the subject of a request from its auth.Principal and, if authz.Authorizer.Middleware ran, its roles
+func SubjectFromContext(ctx context.Context) Subject {
+	subject := Subject{Attributes: make(map[string][]string)}
+
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return subject
+	}
+
+	subject.UserID = principal.UserID
+	subject.Attributes[AttributeUserID] = []string{strconv.Itoa(principal.UserID)}
+	subject.Attributes[AttributeAuthMethod] = []string{string(principal.Method)}
+	subject.Attributes[AttributeScope] = principal.Scopes
+
+	if roles, ok := ctx.Value(authz.Roles).([]authz.Role); ok {
+		for _, role := range roles {
+			subject.Attributes[AttributeRole] = append(subject.Attributes[AttributeRole], string(role))
+		}
+	}
+
+	return subject
+}
+
+// Evaluates a flag for the request of ctx, which must have passed through Client.Middleware.
+// Without it every flag is not found and serves no variant.
+func Evaluate(ctx context.Context, key string) Evaluation {
+	rf, ok := ctx.Value(requestKey).(*requestFlags)
+	if !ok {
+		return Evaluation{Key: key, Reason: ReasonNotFound}
+	}
+
+	principal, _ := auth.FromContext(ctx)
+	_, roles := ctx.Value(authz.Roles).([]authz.Role)
+	cacheKey := cacheKey{flag: key, principal: principal, roles: roles}
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if evaluation, ok := rf.cache[cacheKey]; ok {
+		return evaluation
+	}
+
+	evaluation := Evaluation{Key: key, Reason: ReasonNotFound}
+	if flag, ok := rf.flags[key]; ok {
+		evaluation = flag.Evaluate(SubjectFromContext(ctx))
+	}
+	rf.cache[cacheKey] = evaluation
+
+	return evaluation
+}
+
+// Whether a boolean flag is on for the request of ctx
+func Enabled(ctx context.Context, key string) bool {
+	return Evaluate(ctx, key).Enabled()
+}
+
+// Variant of a flag for the request of ctx, empty if the flag is not found
+func Variant(ctx context.Context, key string) string {
+	return Evaluate(ctx, key).Variant
+}
+
+// Every flag evaluated for the request of ctx, e.g. to hand them to a frontend
+func All(ctx context.Context) []Evaluation {
+	rf, ok := ctx.Value(requestKey).(*requestFlags)
+	if !ok {
+		return []Evaluation{}
+	}
+
+	keys := make([]string, 0, len(rf.flags))
+	for key := range rf.flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	evaluations := make([]Evaluation, len(keys))
+	for i, key := range keys {
+		evaluations[i] = Evaluate(ctx, key)
+	}
+
+	return evaluations
+}
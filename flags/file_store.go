@@ -0,0 +1,42 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Reads flags from a JSON file holding an array of flags, on every refresh of the Client
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) Store {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Flags(ctx context.Context) (map[string]*Flag, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flags file: %w", err)
+	}
+
+	var list []*Flag
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse flags file %s: %w", s.path, err)
+	}
+
+	flags := make(map[string]*Flag, len(list))
+	for _, flag := range list {
+		if err := flag.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := flags[flag.Key]; ok {
+			return nil, fmt.Errorf("%w: %s is defined twice", ErrInvalidFlag, flag.Key)
+		}
+		flags[flag.Key] = flag
+	}
+
+	return flags, nil
+}
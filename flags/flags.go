@@ -0,0 +1,212 @@
+package flags
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Variants of boolean flags, which are flags without Variants
+const (
+	VariantOn  = "on"
+	VariantOff = "off"
+)
+
+// Operators of conditions
+const (
+	OperatorIn    = "in"
+	OperatorNotIn = "not_in"
+)
+
+// Attributes conditions can target, taken from the auth.Principal and the roles set by authz.Authorizer.Middleware
+const (
+	AttributeUserID     = "user_id"
+	AttributeAuthMethod = "auth_method"
+	AttributeScope      = "scope"
+	AttributeRole       = "role"
+)
+
+// Why a flag evaluated to its variant
+const (
+	ReasonNotFound = "not_found" // Unknown flag, or no Client in the context
+	ReasonDisabled = "disabled"
+	ReasonRule     = "rule"
+	ReasonRollout  = "rollout"
+	ReasonDefault  = "default"
+)
+
+var ErrInvalidFlag = errors.New("invalid flag")
+
+// Where flags are read from
+type Store interface {
+	Flags(ctx context.Context) (map[string]*Flag, error)
+}
+
+// A boolean flag serves "on" or "off", a multivariant flag one of its Variants.
+// Rules are checked in order and the first matching one decides, a rule without conditions matches everyone.
+type Flag struct {
+	Key         string   `json:"key"`
+	Description string   `json:"description,omitempty"`
+	Enabled     bool     `json:"enabled"`            // Disabled flags serve OffVariant to everyone
+	Variants    []string `json:"variants,omitempty"` // Empty for boolean flags
+	Default     string   `json:"default,omitempty"`  // Served when no rule matches, "on" for boolean flags if empty
+	OffVariant  string   `json:"off_variant,omitempty"`
+	Rules       []Rule   `json:"rules,omitempty"`
+}
+
+type Rule struct {
+	Conditions []Condition `json:"conditions,omitempty"` // All must match
+	Variant    string      `json:"variant,omitempty"`
+	// Splits matching users between variants by percentage, instead of serving Variant.
+	// Requests without a user never match a rollout, so they fall through to the next rule.
+	Rollout []Weight `json:"rollout,omitempty"`
+}
+
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Values    []string `json:"values"`
+}
+
+type Weight struct {
+	Variant string `json:"variant"`
+	Percent int    `json:"percent"`
+}
+
+// Who a flag is evaluated for
+type Subject struct {
+	UserID     int // 0 for anonymous requests
+	Attributes map[string][]string
+}
+
+type Evaluation struct {
+	Key     string `json:"key"`
+	Variant string `json:"variant"`
+	Reason  string `json:"reason"`
+}
+
+func (e Evaluation) Enabled() bool {
+	return e.Variant == VariantOn
+}
+
+func (f *Flag) variants() []string {
+	if len(f.Variants) == 0 {
+		return []string{VariantOn, VariantOff}
+	}
+	return f.Variants
+}
+
+func (f *Flag) defaultVariant() string {
+	if f.Default == "" && len(f.Variants) == 0 {
+		return VariantOn
+	}
+	return f.Default
+}
+
+func (f *Flag) offVariant() string {
+	if f.OffVariant == "" && len(f.Variants) == 0 {
+		return VariantOff
+	}
+	return f.OffVariant
+}
+
+// Checks that every variant served is declared and rollouts add up to 100%
+func (f *Flag) Validate() error {
+	if f.Key == "" {
+		return fmt.Errorf("%w: missing key", ErrInvalidFlag)
+	}
+
+	variants := f.variants()
+	known := func(variant string) bool { return slices.Contains(variants, variant) }
+
+	if !known(f.defaultVariant()) || !known(f.offVariant()) {
+		return fmt.Errorf("%w: %s: default and off variants must be one of %v", ErrInvalidFlag, f.Key, variants)
+	}
+
+	for i, rule := range f.Rules {
+		for _, condition := range rule.Conditions {
+			if condition.Operator != OperatorIn && condition.Operator != OperatorNotIn {
+				return fmt.Errorf("%w: %s: rule %d has unknown operator %q", ErrInvalidFlag, f.Key, i, condition.Operator)
+			}
+		}
+
+		if len(rule.Rollout) == 0 {
+			if !known(rule.Variant) {
+				return fmt.Errorf("%w: %s: rule %d serves unknown variant %q", ErrInvalidFlag, f.Key, i, rule.Variant)
+			}
+			continue
+		}
+
+		total := 0
+		for _, weight := range rule.Rollout {
+			if !known(weight.Variant) || weight.Percent < 0 {
+				return fmt.Errorf("%w: %s: rule %d has invalid rollout to %q", ErrInvalidFlag, f.Key, i, weight.Variant)
+			}
+			total += weight.Percent
+		}
+		if total != 100 {
+			return fmt.Errorf("%w: %s: rule %d rollout adds up to %d%%", ErrInvalidFlag, f.Key, i, total)
+		}
+	}
+
+	return nil
+}
+
+func (f *Flag) Evaluate(subject Subject) Evaluation {
+	if !f.Enabled {
+		return Evaluation{Key: f.Key, Variant: f.offVariant(), Reason: ReasonDisabled}
+	}
+
+	for _, rule := range f.Rules {
+		if !rule.matches(subject) {
+			continue
+		}
+
+		if len(rule.Rollout) == 0 {
+			return Evaluation{Key: f.Key, Variant: rule.Variant, Reason: ReasonRule}
+		}
+
+		if subject.UserID != 0 {
+			return Evaluation{Key: f.Key, Variant: rollout(f.Key, subject.UserID, rule.Rollout), Reason: ReasonRollout}
+		}
+	}
+
+	return Evaluation{Key: f.Key, Variant: f.defaultVariant(), Reason: ReasonDefault}
+}
+
+func (r *Rule) matches(subject Subject) bool {
+	for _, condition := range r.Conditions {
+		found := false
+		for _, value := range subject.Attributes[condition.Attribute] {
+			if slices.Contains(condition.Values, value) {
+				found = true
+				break
+			}
+		}
+
+		if found != (condition.Operator == OperatorIn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A user always lands in the same bucket of a flag, so raising a percentage only adds users to a variant
+func rollout(key string, userID int, weights []Weight) string {
+	sum := sha256.Sum256([]byte(key + ":" + strconv.Itoa(userID)))
+	bucket := int(binary.BigEndian.Uint32(sum[:4]) % 100)
+
+	for _, weight := range weights {
+		if bucket < weight.Percent {
+			return weight.Variant
+		}
+		bucket -= weight.Percent
+	}
+
+	return weights[len(weights)-1].Variant
+}
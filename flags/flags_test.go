@@ -0,0 +1,313 @@
+package flags_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/authz"
+	"github.com/jose-lico/go-plate/flags"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func newFlag() *flags.Flag {
+	return &flags.Flag{
+		Key:      "checkout",
+		Enabled:  true,
+		Variants: []string{"old", "new", "beta"},
+		Default:  "old",
+		Rules: []flags.Rule{
+			{Conditions: []flags.Condition{{Attribute: flags.AttributeRole, Operator: flags.OperatorIn, Values: []string{"admin"}}}, Variant: "beta"},
+			{
+				Conditions: []flags.Condition{{Attribute: flags.AttributeAuthMethod, Operator: flags.OperatorNotIn, Values: []string{"api_key"}}},
+				Rollout:    []flags.Weight{{Variant: "new", Percent: 25}, {Variant: "old", Percent: 75}},
+			},
+		},
+		OffVariant: "old",
+	}
+}
+
+func subject(userID int, method string, roles ...string) flags.Subject {
+	return flags.Subject{UserID: userID, Attributes: map[string][]string{flags.AttributeAuthMethod: {method}, flags.AttributeRole: roles}}
+}
+
+func TestFlag_Evaluate(t *testing.T) {
+	flag := newFlag()
+	if err := flag.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		subject flags.Subject
+		variant string
+		reason  string
+	}{
+		{name: "Targeted role", subject: subject(1, "session", "user", "admin"), variant: "beta", reason: flags.ReasonRule},
+		{name: "Excluded attribute", subject: subject(1, "api_key"), variant: "old", reason: flags.ReasonDefault},
+		{name: "Anonymous skips rollout", subject: flags.Subject{}, variant: "old", reason: flags.ReasonDefault},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if evaluation := flag.Evaluate(tt.subject); evaluation.Variant != tt.variant || evaluation.Reason != tt.reason {
+				t.Errorf("expected %s (%s), got %+v", tt.variant, tt.reason, evaluation)
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabled := newFlag()
+		disabled.Enabled = false
+		if evaluation := disabled.Evaluate(subject(1, "session", "admin")); evaluation.Variant != "old" || evaluation.Reason != flags.ReasonDisabled {
+			t.Errorf("expected the off variant, got %+v", evaluation)
+		}
+	})
+
+	t.Run("Boolean", func(t *testing.T) {
+		boolean := &flags.Flag{Key: "dark-mode", Enabled: true}
+		if err := boolean.Validate(); err != nil || !boolean.Evaluate(flags.Subject{}).Enabled() {
+			t.Errorf("expected an enabled boolean flag without rules to be on, got %v", err)
+		}
+	})
+}
+
+func TestFlag_Rollout(t *testing.T) {
+	flag := newFlag()
+
+	counts := make(map[string]int)
+	for userID := 1; userID <= 10000; userID++ {
+		evaluation := flag.Evaluate(subject(userID, "session"))
+		if again := flag.Evaluate(subject(userID, "session")); again != evaluation {
+			t.Fatalf("expected user %d to get the same variant, got %s and %s", userID, evaluation.Variant, again.Variant)
+		}
+		counts[evaluation.Variant]++
+	}
+
+	if counts["new"] < 2300 || counts["new"] > 2700 {
+		t.Errorf("expected about 25%% of users to get the new variant, got %d of 10000", counts["new"])
+	}
+
+	// Raising the percentage keeps users that already had the variant
+	raised := newFlag()
+	raised.Rules[1].Rollout = []flags.Weight{{Variant: "new", Percent: 50}, {Variant: "old", Percent: 50}}
+	for userID := 1; userID <= 1000; userID++ {
+		if flag.Evaluate(subject(userID, "session")).Variant == "new" && raised.Evaluate(subject(userID, "session")).Variant != "new" {
+			t.Fatalf("expected user %d to keep the new variant once rolled out further", userID)
+		}
+	}
+}
+
+func TestFlag_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(flag *flags.Flag)
+	}{
+		{name: "Missing key", modify: func(flag *flags.Flag) { flag.Key = "" }},
+		{name: "Unknown default", modify: func(flag *flags.Flag) { flag.Default = "newest" }},
+		{name: "Unknown rule variant", modify: func(flag *flags.Flag) { flag.Rules[0].Variant = "newest" }},
+		{name: "Unknown operator", modify: func(flag *flags.Flag) { flag.Rules[0].Conditions[0].Operator = "contains" }},
+		{name: "Rollout not 100%", modify: func(flag *flags.Flag) { flag.Rules[1].Rollout[1].Percent = 70 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag := newFlag()
+			tt.modify(flag)
+			if err := flag.Validate(); !errors.Is(err, flags.ErrInvalidFlag) {
+				t.Errorf("expected %v, got %v", flags.ErrInvalidFlag, err)
+			}
+		})
+	}
+}
+
+type countingStore struct {
+	mu    sync.Mutex
+	flags map[string]*flags.Flag
+	err   error
+	reads int
+}
+
+func (s *countingStore) Flags(ctx context.Context) (map[string]*flags.Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reads++
+	return s.flags, s.err
+}
+
+func TestClient_Middleware(t *testing.T) {
+	store := &countingStore{flags: map[string]*flags.Flag{"checkout": newFlag(), "dark-mode": {Key: "dark-mode", Enabled: true}}}
+	client := flags.NewClient(store, time.Hour)
+
+	var anonymous, admin, all []flags.Evaluation
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		anonymous = append(anonymous, flags.Evaluate(ctx, "checkout"), flags.Evaluate(ctx, "checkout"))
+
+		// Once authenticated and authorized further down the chain
+		ctx = auth.WithPrincipal(ctx, &auth.Principal{UserID: 1, Method: auth.MethodSession})
+		ctx = context.WithValue(ctx, authz.Roles, []authz.Role{authz.RoleAdmin})
+		admin = append(admin, flags.Evaluate(ctx, "checkout"))
+		all = flags.All(ctx)
+
+		if !flags.Enabled(ctx, "dark-mode") || flags.Variant(ctx, "unknown") != "" {
+			t.Error("expected dark-mode on and unknown flags to have no variant")
+		}
+	}))
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	if anonymous[0].Variant != "old" || admin[0].Variant != "beta" {
+		t.Errorf("expected anonymous and admin requests to be evaluated separately, got %+v and %+v", anonymous[0], admin[0])
+	}
+	if len(all) != 2 || all[0].Key != "checkout" || all[1].Key != "dark-mode" {
+		t.Errorf("expected every flag sorted by key, got %+v", all)
+	}
+	if store.reads != 1 {
+		t.Errorf("expected flags to be read once per refresh interval, got %d reads", store.reads)
+	}
+
+	if flags.Enabled(context.Background(), "dark-mode") {
+		t.Error("expected flags to be off without the middleware")
+	}
+}
+
+func TestClient_KeepsFlagsOnStoreError(t *testing.T) {
+	store := &countingStore{flags: map[string]*flags.Flag{"dark-mode": {Key: "dark-mode", Enabled: true}}}
+	client := flags.NewClient(store, time.Millisecond)
+
+	if !client.Evaluate(context.Background(), "dark-mode", flags.Subject{}).Enabled() {
+		t.Fatal("expected dark-mode to be on")
+	}
+
+	store.err = errors.New("store unavailable")
+	time.Sleep(5 * time.Millisecond)
+
+	if !client.Evaluate(context.Background(), "dark-mode", flags.Subject{}).Enabled() {
+		t.Error("expected the last flags read to be served while the store fails")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	if err := os.WriteFile(path, []byte(`[{"key": "dark-mode", "enabled": true}, {"key": "beta", "enabled": false}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := flags.NewFileStore(path).Flags(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || !read["dark-mode"].Enabled || read["beta"].Enabled {
+		t.Errorf("unexpected flags %+v", read)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"key": "dark-mode", "enabled": true, "default": "maybe"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flags.NewFileStore(path).Flags(context.Background()); !errors.Is(err, flags.ErrInvalidFlag) {
+		t.Errorf("expected %v, got %v", flags.ErrInvalidFlag, err)
+	}
+}
+
+// In-memory stand-in for database.RedisStore
+type memoryRedis struct {
+	values map[string]string
+	sets   map[string]map[string]bool
+}
+
+func newMemoryRedis() *memoryRedis {
+	return &memoryRedis{values: make(map[string]string), sets: make(map[string]map[string]bool)}
+}
+
+func (m *memoryRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	switch v := value.(type) {
+	case []byte:
+		m.values[key] = string(v)
+	default:
+		m.values[key] = v.(string)
+	}
+	return nil
+}
+
+func (m *memoryRedis) Get(ctx context.Context, key string) (string, error) {
+	value, ok := m.values[key]
+	if !ok {
+		return "", redis.Nil
+	}
+	return value, nil
+}
+
+func (m *memoryRedis) SAdd(ctx context.Context, key string, value interface{}) error {
+	if m.sets[key] == nil {
+		m.sets[key] = make(map[string]bool)
+	}
+	m.sets[key][value.(string)] = true
+	return nil
+}
+
+func (m *memoryRedis) SRem(ctx context.Context, key string, value interface{}) error {
+	delete(m.sets[key], value.(string))
+	return nil
+}
+
+func (m *memoryRedis) SMembers(ctx context.Context, key string) ([]string, error) {
+	members := make([]string, 0, len(m.sets[key]))
+	for member := range m.sets[key] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (m *memoryRedis) Del(ctx context.Context, key string) (int64, error) {
+	if _, ok := m.values[key]; !ok {
+		return 0, nil
+	}
+	delete(m.values, key)
+	return 1, nil
+}
+
+func (m *memoryRedis) Ping(ctx context.Context) error { return nil }
+func (m *memoryRedis) GetNativeInstance() interface{} { return nil }
+func (m *memoryRedis) Close() error                   { return nil }
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	store := flags.NewRedisStore(newMemoryRedis(), "flags:")
+
+	if err := store.Save(ctx, newFlag()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, &flags.Flag{Key: "dark-mode", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := newFlag()
+	invalid.Default = "newest"
+	if err := store.Save(ctx, invalid); !errors.Is(err, flags.ErrInvalidFlag) {
+		t.Errorf("expected invalid flags to be rejected, got %v", err)
+	}
+
+	if err := store.Delete(ctx, "dark-mode"); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := store.Flags(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || read["checkout"] == nil || len(read["checkout"].Rules) != 2 {
+		t.Errorf("unexpected flags %+v", read)
+	}
+}
@@ -0,0 +1,91 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jose-lico/go-plate/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Keeps each flag as JSON under prefix+"flag:"+key, with the keys of every flag in the set prefix+"index".
+// Flags saved by any instance reach the others on their next refresh.
+type RedisStore struct {
+	redis  database.RedisStore
+	prefix string
+}
+
+func NewRedisStore(redis database.RedisStore, prefix string) *RedisStore {
+	return &RedisStore{redis: redis, prefix: prefix}
+}
+
+func (s *RedisStore) Flags(ctx context.Context) (map[string]*Flag, error) {
+	keys, err := s.redis.SMembers(ctx, s.indexKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flags: %w", err)
+	}
+
+	flags := make(map[string]*Flag, len(keys))
+	for _, key := range keys {
+		flagJSON, err := s.redis.Get(ctx, s.flagKey(key))
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue // Deleted since listed
+			}
+			return nil, fmt.Errorf("failed to read flag: %w", err)
+		}
+
+		var flag Flag
+		if err := json.Unmarshal([]byte(flagJSON), &flag); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal flag %s: %w", key, err)
+		}
+		if err := flag.Validate(); err != nil {
+			return nil, err
+		}
+
+		flags[flag.Key] = &flag
+	}
+
+	return flags, nil
+}
+
+// Creates or replaces a flag
+func (s *RedisStore) Save(ctx context.Context, flag *Flag) error {
+	if err := flag.Validate(); err != nil {
+		return err
+	}
+
+	flagJSON, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flag: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.flagKey(flag.Key), flagJSON, 0); err != nil {
+		return fmt.Errorf("failed to save flag: %w", err)
+	}
+
+	if err := s.redis.SAdd(ctx, s.indexKey(), flag.Key); err != nil {
+		return fmt.Errorf("failed to index flag: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.redis.Del(ctx, s.flagKey(key)); err != nil {
+		return fmt.Errorf("failed to delete flag: %w", err)
+	}
+
+	return s.redis.SRem(ctx, s.indexKey(), key)
+}
+
+func (s *RedisStore) flagKey(key string) string {
+	return s.prefix + "flag:" + key
+}
+
+func (s *RedisStore) indexKey() string {
+	return s.prefix + "index"
+}
@@ -1,6 +1,7 @@
 module github.com/jose-lico/go-plate
 
-go 1.22.0
+go 1.23.0
+
 toolchain go1.24.1
 
 require github.com/go-chi/chi/v5 v5.1.0
@@ -8,6 +9,8 @@ require github.com/go-chi/chi/v5 v5.1.0
 require github.com/joho/godotenv v1.5.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/alicebob/miniredis/v2 v2.39.0
 	github.com/go-playground/validator/v10 v10.22.1
 	github.com/golang-migrate/migrate/v4 v4.18.1
 	github.com/jmoiron/sqlx v1.4.0
@@ -17,6 +20,7 @@ require (
 	github.com/swaggo/http-swagger v1.3.4
 	go.uber.org/zap v1.27.0
 	golang.org/x/crypto v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -39,13 +43,13 @@ require (
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/swaggo/files v1.0.1 // indirect
 	github.com/swaggo/swag v1.16.3 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/net v0.36.0 // indirect
 	golang.org/x/sync v0.11.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/tools v0.25.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
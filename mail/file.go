@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer writes messages to w in a readable form instead of sending them, for local development
+type FileMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewFileMailer(w io.Writer, from string) Mailer {
+	return &FileMailer{w: w, from: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	msg = withDefaultSender(msg, m.from)
+
+	if _, _, err := parseAddresses(msg); err != nil {
+		return err
+	}
+
+	body := msg.Text
+	if body == "" {
+		body = msg.HTML
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "-----\nDate: %s\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n",
+		time.Now().Format(time.RFC1123Z), msg.From, strings.Join(msg.To, ", "), msg.Subject, body)
+	if err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
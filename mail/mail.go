@@ -0,0 +1,201 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+
+	netmail "net/mail"
+)
+
+var (
+	ErrNoRecipients = errors.New("message has no recipients")
+)
+
+// Message is an email with a plain text body, an HTML body, or both. An empty From uses the mailer's default sender.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Creates the transport selected by cfg.Transport, defaulting to the file transport (stdout) when env is LOCAL
+func NewTransport(env string, cfg *config.MailConfig) (Mailer, error) {
+	transport := cfg.Transport
+	if transport == "" {
+		if env == "LOCAL" {
+			transport = "file"
+		} else {
+			transport = "smtp"
+		}
+	}
+
+	switch transport {
+	case "smtp":
+		return NewSMTPMailer(cfg, nil), nil
+	case "file":
+		if cfg.FilePath == "" {
+			return NewFileMailer(os.Stdout, cfg.From), nil
+		}
+
+		file, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open mail file: %w", err)
+		}
+		return NewFileMailer(file, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail transport %q", transport)
+	}
+}
+
+func withDefaultSender(msg *Message, from string) *Message {
+	if msg.From != "" {
+		return msg
+	}
+
+	withFrom := *msg
+	withFrom.From = from
+	return &withFrom
+}
+
+// Validates and parses the sender and recipient addresses of msg
+func parseAddresses(msg *Message) (*netmail.Address, []*netmail.Address, error) {
+	from, err := netmail.ParseAddress(msg.From)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid sender %q: %w", msg.From, err)
+	}
+
+	if len(msg.To) == 0 {
+		return nil, nil, ErrNoRecipients
+	}
+
+	to := make([]*netmail.Address, len(msg.To))
+	for i, addr := range msg.To {
+		to[i], err = netmail.ParseAddress(addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+	}
+
+	return from, to, nil
+}
+
+// Builds the RFC 5322 message, as multipart/alternative when it has both a text and an HTML body
+func build(msg *Message, from *netmail.Address, to []*netmail.Address) ([]byte, error) {
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, errors.New("subject must not contain line breaks")
+	}
+
+	messageID, err := newMessageID(from)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]string, len(to))
+	for i, addr := range to {
+		recipients[i] = addr.String()
+	}
+
+	var body bytes.Buffer
+	var contentType string
+
+	if msg.Text != "" && msg.HTML != "" {
+		mw := multipart.NewWriter(&body)
+		contentType = "multipart/alternative; boundary=" + mw.Boundary()
+
+		for _, part := range []struct{ contentType, content string }{
+			{"text/plain; charset=UTF-8", msg.Text},
+			{"text/html; charset=UTF-8", msg.HTML},
+		} {
+			w, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := writeQuotedPrintable(w, part.content); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	} else {
+		content := msg.Text
+		contentType = "text/plain; charset=UTF-8"
+		if msg.Text == "" {
+			content = msg.HTML
+			contentType = "text/html; charset=UTF-8"
+		}
+
+		if err := writeQuotedPrintable(&body, content); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", strings.Join(recipients, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", contentType},
+	}
+	if !strings.HasPrefix(contentType, "multipart/") {
+		headers = append(headers, [2]string{"Content-Transfer-Encoding", "quoted-printable"})
+	}
+
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], header[1])
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func newMessageID(from *netmail.Address) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate message id: %w", err)
+	}
+
+	_, domain, ok := strings.Cut(from.Address, "@")
+	if !ok {
+		domain = "localhost"
+	}
+
+	return "<" + hex.EncodeToString(b[:]) + "@" + domain + ">", nil
+}
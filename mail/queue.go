@@ -0,0 +1,135 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+
+	"go.uber.org/zap"
+)
+
+const sendTimeout = 30 * time.Second
+
+var (
+	ErrQueueFull   = errors.New("mail queue is full")
+	ErrQueueClosed = errors.New("mail queue is closed")
+)
+
+// Queue sends messages in the background through another Mailer, retrying failed sends with exponential backoff.
+// Send only enqueues the message, so delivery failures are logged instead of returned.
+type Queue struct {
+	mailer     Mailer
+	jobs       chan *Message
+	maxRetries int
+	backoff    time.Duration
+
+	mu       sync.RWMutex
+	closed   bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewQueue(mailer Mailer, cfg *config.MailConfig) *Queue {
+	if cfg.QueueSize <= 0 || cfg.Workers <= 0 || cfg.MaxRetries < 0 || cfg.RetryBackoff <= 0 {
+		zap.L().Fatal("Invalid parameters for Queue")
+	}
+
+	q := &Queue{
+		mailer:     mailer,
+		jobs:       make(chan *Message, cfg.QueueSize),
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.RetryBackoff,
+		stop:       make(chan struct{}),
+	}
+
+	q.wg.Add(cfg.Workers)
+	for range cfg.Workers {
+		go q.work()
+	}
+
+	return q
+}
+
+func (q *Queue) Send(ctx context.Context, msg *Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.jobs <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Stops accepting messages and waits for queued ones to be sent. Messages still pending when ctx is done are dropped.
+// Safe to call more than once, e.g. from a shutdown hook and a deferred call.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.stopOnce.Do(func() { close(q.stop) })
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for msg := range q.jobs {
+		q.deliver(msg)
+	}
+}
+
+func (q *Queue) deliver(msg *Message) {
+	backoff := q.backoff
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := q.mailer.Send(ctx, msg)
+		cancel()
+
+		if err == nil {
+			return
+		}
+
+		if attempt == q.maxRetries {
+			zap.L().Error("Failed to send email, giving up",
+				zap.Error(err), zap.Strings("to", msg.To), zap.String("subject", msg.Subject), zap.Int("attempts", attempt+1))
+			return
+		}
+
+		zap.L().Warn("Failed to send email, retrying",
+			zap.Error(err), zap.Strings("to", msg.To), zap.String("subject", msg.Subject), zap.Duration("backoff", backoff))
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-q.stop:
+			zap.L().Error("Dropping email on shutdown", zap.Strings("to", msg.To), zap.String("subject", msg.Subject))
+			return
+		}
+	}
+}
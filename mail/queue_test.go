@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+// Blocks every send until released
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg *Message) error {
+	<-m.release
+	return nil
+}
+
+func TestQueue_CloseTwiceAfterTimeout(t *testing.T) {
+	mailer := &blockingMailer{release: make(chan struct{})}
+	defer close(mailer.release)
+
+	queue := NewQueue(mailer, &config.MailConfig{QueueSize: 1, Workers: 1, MaxRetries: 3, RetryBackoff: time.Second})
+
+	if err := queue.Send(context.Background(), &Message{To: []string{"user@example.com"}, Subject: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both a shutdown hook and a deferred call may close the queue once their context expired
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		if err := queue.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		cancel()
+	}
+
+	if err := queue.Send(context.Background(), &Message{}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected %v, got %v", ErrQueueClosed, err)
+	}
+}
@@ -0,0 +1,116 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+var (
+	ErrStartTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+)
+
+type SMTPMailer struct {
+	cfg       *config.MailConfig
+	tlsConfig *tls.Config
+}
+
+// tlsConfig is optional, by default the server certificate is verified against the system roots
+func NewSMTPMailer(cfg *config.MailConfig, tlsConfig *tls.Config) Mailer {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: cfg.SMTPHost}
+	}
+
+	return &SMTPMailer{cfg: cfg, tlsConfig: tlsConfig}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	msg = withDefaultSender(msg, m.cfg.From)
+
+	from, to, err := parseAddresses(msg)
+	if err != nil {
+		return err
+	}
+
+	data, err := build(msg, from, to)
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start smtp session: %w", err)
+	}
+	defer client.Close()
+
+	if m.cfg.SMTPTLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported
+		}
+		if err := client.StartTLS(m.tlsConfig); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	// PlainAuth refuses to send credentials over an unencrypted connection to anything but localhost
+	if m.cfg.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("failed to add recipient: %w", err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start data: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(m.cfg.SMTPHost, m.cfg.SMTPPort)
+
+	var conn net.Conn
+	var err error
+
+	if m.cfg.SMTPTLS == "tls" {
+		conn, err = (&tls.Dialer{Config: m.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	return conn, nil
+}
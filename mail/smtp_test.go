@@ -0,0 +1,240 @@
+package mail
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/config"
+)
+
+type fakeMessage struct {
+	from          string
+	to            []string
+	data          string
+	tls           bool
+	authenticated bool
+}
+
+// Minimal SMTP server accepting a single session, enough to exercise net/smtp
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	startTLS  bool
+	username  string
+	password  string
+	messages  chan fakeMessage
+}
+
+func newFakeSMTPServer(t *testing.T, startTLS bool) (*fakeSMTPServer, *tls.Config) {
+	serverTLS, clientTLS := newTestCertificate(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeSMTPServer{
+		listener:  listener,
+		tlsConfig: serverTLS,
+		startTLS:  startTLS,
+		username:  "user",
+		password:  "secret",
+		messages:  make(chan fakeMessage, 1),
+	}
+
+	go s.serve()
+	return s, clientTLS
+}
+
+func (s *fakeSMTPServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { conn.Close() }() // conn is replaced on STARTTLS
+
+	tp := textproto.NewConn(conn)
+	msg := fakeMessage{}
+
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-fake")
+			if s.startTLS && !msg.tls {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			msg.tls = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			if string(credentials) != "\x00"+s.username+"\x00"+s.password {
+				tp.PrintfLine("535 Authentication failed")
+				continue
+			}
+			msg.authenticated = true
+			tp.PrintfLine("235 Authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			tp.PrintfLine("250 OK")
+			s.messages <- msg
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func newTestCertificate(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+
+	return server, client
+}
+
+func newTestMailConfig(port string) *config.MailConfig {
+	cfg := config.NewMailConfig()
+	cfg.From = "go-plate <no-reply@example.com>"
+	cfg.SMTPHost = "127.0.0.1"
+	cfg.SMTPPort = port
+	cfg.SMTPUsername = "user"
+	cfg.SMTPPassword = "secret"
+	cfg.SMTPTLS = "starttls"
+	return cfg
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server, clientTLS := newFakeSMTPServer(t, true)
+	mailer := NewSMTPMailer(newTestMailConfig(server.port()), clientTLS)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := mailer.Send(ctx, &Message{
+		To:      []string{"José <jose@example.com>", "other@example.com"},
+		Subject: "Olá",
+		Text:    "Hello in text",
+		HTML:    "<p>Hello in html</p>",
+	})
+	if err != nil {
+		t.Fatalf("expected send to succeed, got %v", err)
+	}
+
+	msg := <-server.messages
+
+	if !msg.tls || !msg.authenticated {
+		t.Errorf("expected session to use STARTTLS and auth, got tls %v, auth %v", msg.tls, msg.authenticated)
+	}
+	if msg.from != "no-reply@example.com" {
+		t.Errorf("expected envelope sender no-reply@example.com, got %q", msg.from)
+	}
+	if strings.Join(msg.to, ",") != "jose@example.com,other@example.com" {
+		t.Errorf("expected envelope recipients, got %v", msg.to)
+	}
+
+	for _, expected := range []string{
+		"Subject: =?utf-8?q?Ol=C3=A1?=",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Hello in text",
+		"Content-Type: text/html; charset=UTF-8",
+		"<p>Hello in html</p>",
+	} {
+		if !strings.Contains(msg.data, expected) {
+			t.Errorf("expected message to contain %q, got:\n%s", expected, msg.data)
+		}
+	}
+}
+
+func TestSMTPMailer_RequiresStartTLS(t *testing.T) {
+	server, clientTLS := newFakeSMTPServer(t, false)
+	mailer := NewSMTPMailer(newTestMailConfig(server.port()), clientTLS)
+
+	err := mailer.Send(context.Background(), &Message{To: []string{"jose@example.com"}, Subject: "Hi", Text: "Hi"})
+	if !errors.Is(err, ErrStartTLSUnsupported) {
+		t.Errorf("expected %v, got %v", ErrStartTLSUnsupported, err)
+	}
+}
+
+func TestSMTPMailer_RejectsHeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer(newTestMailConfig("25"), nil)
+
+	err := mailer.Send(context.Background(), &Message{To: []string{"jose@example.com"}, Subject: "Hi\r\nBcc: victim@example.com", Text: "Hi"})
+	if err == nil {
+		t.Error("expected subject with line breaks to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("email template not found")
+)
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates renders emails from Go templates. Each email <name> has a <name>.txt text template, which must define
+// the subject with {{define "subject"}}...{{end}}, and an optional <name>.html template for the HTML body.
+type Templates struct {
+	emails map[string]*emailTemplate
+}
+
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	files, err := fs.Glob(fsys, "*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{emails: make(map[string]*emailTemplate)}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file, ".txt")
+
+		text, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("template %s does not define a subject", file)
+		}
+
+		email := &emailTemplate{text: text}
+
+		htmlFile := name + ".html"
+		if _, err := fs.Stat(fsys, htmlFile); err == nil {
+			email.html, err = htmltemplate.ParseFS(fsys, htmlFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", htmlFile, err)
+			}
+		}
+
+		t.emails[name] = email
+	}
+
+	return t, nil
+}
+
+// Renders the subject and bodies of the email name. The recipients are left to the caller.
+func (t *Templates) Render(name string, data any) (*Message, error) {
+	email, ok := t.emails[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	var subject, text, html bytes.Buffer
+
+	if err := email.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject of %s: %w", name, err)
+	}
+	if err := email.text.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return nil, fmt.Errorf("failed to render text of %s: %w", name, err)
+	}
+	if email.html != nil {
+		if err := email.html.ExecuteTemplate(&html, name+".html", data); err != nil {
+			return nil, fmt.Errorf("failed to render html of %s: %w", name, err)
+		}
+	}
+
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jose-lico/go-plate/apikeys"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/utils"
+)
+
+const APIKey contextKey = "apiKey"
+
+// Authenticates requests carrying an API key in `X-API-Key` or `Authorization: Bearer`, setting the auth.Principal like SessionMiddleware
+// plus the key itself under APIKey. Bearer values that are not API keys are left for BearerAuthMiddleware, so it must be mounted after this one.
+// Requests without an API key are passed through untouched, requests with an invalid one are rejected.
+func APIKeyMiddleware(manager *apikeys.APIKeyManager) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get("X-API-Key")
+			if value == "" {
+				if token, ok := bearerToken(r); ok && manager.IsAPIKey(token) {
+					value = token
+				}
+			}
+
+			if value == "" {
+				next.ServeHTTP(w, r.WithContext(withDeprecatedKeys(r.Context(), nil)))
+				return
+			}
+
+			key, err := manager.Authenticate(r.Context(), value)
+			if errors.Is(err, apikeys.ErrInvalidAPIKey) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+				return
+			}
+
+			principal := &auth.Principal{
+				UserID:    int(key.UserID),
+				Method:    auth.MethodAPIKey,
+				SessionID: key.Prefix,
+				Scopes:    key.Scopes,
+			}
+			if key.ExpiresAt != nil {
+				principal.ExpiresAt = *key.ExpiresAt
+			}
+
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			ctx = context.WithValue(ctx, APIKey, key)
+			ctx = withDeprecatedKeys(ctx, principalSession(principal, key.CreatedAt, r))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Rejects requests authenticated by an API key, or a scoped access token, lacking scope. Sessions are not restricted by scopes.
+func RequireAPIKeyScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if principal, ok := auth.FromContext(r.Context()); ok && !principal.Allows(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/apikeys"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+	"github.com/jose-lico/go-plate/config"
+)
+
+type mockAPIKeyStore struct {
+	keys []*apikeys.APIKey
+}
+
+func (s *mockAPIKeyStore) Create(ctx context.Context, key *apikeys.APIKey) error {
+	key.ID = uint(len(s.keys) + 1)
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+func (s *mockAPIKeyStore) GetByPrefix(ctx context.Context, prefix string) (*apikeys.APIKey, error) {
+	for _, key := range s.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, apikeys.ErrAPIKeyNotFound
+}
+
+func (s *mockAPIKeyStore) ListForUser(ctx context.Context, userID uint) ([]*apikeys.APIKey, error) {
+	return s.keys, nil
+}
+
+func (s *mockAPIKeyStore) Revoke(ctx context.Context, userID, id uint, at time.Time) error {
+	for _, key := range s.keys {
+		if key.ID == id && key.UserID == userID {
+			key.RevokedAt = &at
+			return nil
+		}
+	}
+	return apikeys.ErrAPIKeyNotFound
+}
+
+func (s *mockAPIKeyStore) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return nil
+}
+
+// Accepts "valid-jwt" as an access token of user 2, and "scoped-jwt" as one limited to posts:read
+type mockVerifier struct{}
+
+func (v mockVerifier) Verify(token string) (*jwt.Claims, error) {
+	claims := &jwt.Claims{Subject: "2", ID: "jti", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+
+	switch token {
+	case "valid-jwt":
+		return claims, nil
+	case "scoped-jwt":
+		claims.Extra = map[string]any{"scope": "posts:read"}
+		return claims, nil
+	default:
+		return nil, jwt.ErrInvalidSignature
+	}
+}
+
+// Serves the principal's method, or "anonymous"
+func principalHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := auth.FromContext(r.Context()); ok {
+			w.Write([]byte(principal.Method))
+			return
+		}
+		w.Write([]byte("anonymous"))
+	})
+}
+
+func TestAPIKeyMiddleware_BearerOrdering(t *testing.T) {
+	manager := apikeys.NewAPIKeyManager(&mockAPIKeyStore{}, &config.APIKeyConfig{Prefix: "gp", TouchInterval: time.Minute})
+	ctx := context.Background()
+
+	key, _, err := manager.Issue(ctx, 1, "ci", []string{"posts:read"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, record, err := manager.Issue(ctx, 1, "old", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Revoke(ctx, 1, record.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// API keys are checked first, bearer tokens that are not API keys are left to BearerAuthMiddleware
+	handler := APIKeyMiddleware(manager)(BearerAuthMiddleware(mockVerifier{})(principalHandler()))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		method  string
+	}{
+		{name: "No credentials", status: http.StatusOK, method: "anonymous"},
+		{name: "X-API-Key", headers: map[string]string{"X-API-Key": key}, status: http.StatusOK, method: string(auth.MethodAPIKey)},
+		{name: "API key as bearer", headers: map[string]string{"Authorization": "Bearer " + key}, status: http.StatusOK, method: string(auth.MethodAPIKey)},
+		{name: "Access token", headers: map[string]string{"Authorization": "Bearer valid-jwt"}, status: http.StatusOK, method: string(auth.MethodBearer)},
+		{name: "Invalid access token", headers: map[string]string{"Authorization": "Bearer invalid-jwt"}, status: http.StatusUnauthorized},
+		// The API key authenticates the request, BearerAuthMiddleware must not reject it for the other header
+		{name: "X-API-Key with invalid bearer", headers: map[string]string{"X-API-Key": key, "Authorization": "Bearer invalid-jwt"}, status: http.StatusOK, method: string(auth.MethodAPIKey)},
+		{name: "Invalid API key", headers: map[string]string{"X-API-Key": key + "0"}, status: http.StatusUnauthorized},
+		{name: "Invalid API key as bearer", headers: map[string]string{"Authorization": "Bearer gp_unknown_secret"}, status: http.StatusUnauthorized},
+		{name: "Revoked API key", headers: map[string]string{"X-API-Key": revoked}, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusUnauthorized && !strings.Contains(rr.Header().Get("WWW-Authenticate"), "invalid_token") {
+				t.Errorf("expected an invalid_token challenge, got %q", rr.Header().Get("WWW-Authenticate"))
+			}
+			if tt.method != "" && rr.Body.String() != tt.method {
+				t.Errorf("expected method %s, got %s", tt.method, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestBearerAuthMiddleware_Scopes(t *testing.T) {
+	for token, scopes := range map[string][]string{"valid-jwt": nil, "scoped-jwt": {"posts:read"}} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		var principal *auth.Principal
+		BearerAuthMiddleware(mockVerifier{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal = auth.MustFromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		if principal == nil || (principal.Scopes == nil) != (scopes == nil) || !slices.Equal(principal.Scopes, scopes) {
+			t.Errorf("%s: expected scopes %v, got %+v", token, scopes, principal)
+		}
+	}
+}
+
+func TestAPIKeyMiddleware_StoreError(t *testing.T) {
+	manager := apikeys.NewAPIKeyManager(&failingAPIKeyStore{}, &config.APIKeyConfig{Prefix: "gp", TouchInterval: time.Minute})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "gp_id_secret")
+
+	rr := httptest.NewRecorder()
+	APIKeyMiddleware(manager)(principalHandler()).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+type failingAPIKeyStore struct {
+	mockAPIKeyStore
+}
+
+func (s *failingAPIKeyStore) GetByPrefix(ctx context.Context, prefix string) (*apikeys.APIKey, error) {
+	return nil, errors.New("database is down")
+}
+
+func TestRequireAPIKeyScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		status    int
+	}{
+		{name: "Unauthenticated", status: http.StatusOK},
+		{name: "Session", principal: &auth.Principal{UserID: 1, Method: auth.MethodSession}, status: http.StatusOK},
+		{name: "Bearer", principal: &auth.Principal{UserID: 1, Method: auth.MethodBearer}, status: http.StatusOK},
+		{name: "Bearer with scope", principal: &auth.Principal{UserID: 1, Method: auth.MethodBearer, Scopes: []string{"posts:write"}}, status: http.StatusOK},
+		{name: "Bearer without scope", principal: &auth.Principal{UserID: 1, Method: auth.MethodBearer, Scopes: []string{}}, status: http.StatusForbidden},
+		{name: "API key with scope", principal: &auth.Principal{UserID: 1, Method: auth.MethodAPIKey, Scopes: []string{"posts:write"}}, status: http.StatusOK},
+		{name: "API key without scope", principal: &auth.Principal{UserID: 1, Method: auth.MethodAPIKey, Scopes: []string{"posts:read"}}, status: http.StatusForbidden},
+	}
+
+	handler := RequireAPIKeyScope("posts:write")(principalHandler())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusForbidden && !strings.Contains(rr.Header().Get("WWW-Authenticate"), `scope="posts:write"`) {
+				t.Errorf("expected an insufficient_scope challenge, got %q", rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// Handlers not yet migrated to auth.FromContext keep working for a release
+func TestDeprecatedContextKeys(t *testing.T) {
+	manager := apikeys.NewAPIKeyManager(&mockAPIKeyStore{}, &config.APIKeyConfig{Prefix: "gp", TouchInterval: time.Minute})
+	key, record, err := manager.Issue(context.Background(), 1, "ci", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		header        string
+		value         string
+		authenticated bool
+		session       Session
+	}{
+		{name: "No credentials"},
+		{name: "API key", header: "X-API-Key", value: key, authenticated: true, session: Session{ID: record.Prefix, UserID: 1}},
+		{name: "Access token", header: "Authorization", value: "Bearer valid-jwt", authenticated: true, session: Session{ID: "jti", UserID: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+
+			var authenticated, set bool
+			var session Session
+			handler := APIKeyMiddleware(manager)(BearerAuthMiddleware(mockVerifier{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authenticated, set = r.Context().Value(IsAuthenticated).(bool)
+				session, _ = r.Context().Value(SessionInfo).(Session)
+			})))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !set || authenticated != tt.authenticated {
+				t.Errorf("expected IsAuthenticated %v, got %v (set: %v)", tt.authenticated, authenticated, set)
+			}
+			if session.ID != tt.session.ID || session.UserID != tt.session.UserID {
+				t.Errorf("expected session %s of user %d, got %+v", tt.session.ID, tt.session.UserID, session)
+			}
+		})
+	}
+}
+
+func TestDeprecatedContextKeys_Session(t *testing.T) {
+	_, manager := newTestCSRF("synchronizer")
+	cookie, principal := newTestSession(t, manager)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+
+	var session Session
+	SessionMiddleware(manager)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authenticated, _ := r.Context().Value(IsAuthenticated).(bool); !authenticated {
+			t.Error("expected IsAuthenticated to be true")
+		}
+		session, _ = r.Context().Value(SessionInfo).(Session)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if session.ID != principal.SessionID || session.UserID != principal.UserID {
+		t.Errorf("expected the stored session, got %+v", session)
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/auth/jwt"
+)
+
+// Authenticates requests carrying an `Authorization: Bearer` access token, setting the auth.Principal like SessionMiddleware.
+// Requests without a bearer token, or already authenticated by APIKeyMiddleware, are passed through untouched, requests with an invalid one are rejected.
+// A `scope` claim limits the token to those scopes, see auth.Principal.Allows.
+func BearerAuthMiddleware(verifier jwt.TokenVerifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if principal, ok := auth.FromContext(r.Context()); ok && principal.Method == auth.MethodAPIKey {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := bearerToken(r)
+			if !ok {
+				next.ServeHTTP(w, r.WithContext(withDeprecatedKeys(r.Context(), nil)))
+				return
+			}
+
+			claims, err := verifier.Verify(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			userID, err := claims.UserID()
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			principal := &auth.Principal{
+				UserID:    userID,
+				Method:    auth.MethodBearer,
+				SessionID: claims.ID,
+				ExpiresAt: claims.ExpiresAtTime(),
+			}
+
+			// Space separated, as in RFC 9068. An empty claim still limits the token, to no scopes at all.
+			if scope, ok := claims.Extra["scope"].(string); ok {
+				principal.Scopes = append([]string{}, strings.Fields(scope)...)
+			}
+
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			ctx = withDeprecatedKeys(ctx, principalSession(principal, claims.IssuedAtTime(), r))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/config"
+	"github.com/jose-lico/go-plate/sessions"
+	"github.com/jose-lico/go-plate/utils"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCSRFOriginMismatch = errors.New("cross-origin request rejected")
+	ErrCSRFTokenInvalid   = errors.New("missing or invalid csrf token")
+)
+
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token" example:"4f2c...e91a"`
+}
+
+// Protects cookie authenticated routes against cross-site request forgery. Mount it after the authentication middleware.
+//
+// Unsafe requests must come from the request's own origin or one of allowedOrigins, checked through Origin, falling back to Referer.
+// Requests authenticated by a session must also echo the CSRF token in a header or form field.
+// Bearer and API key requests are exempt, browsers never attach those credentials on their own.
+type CSRF struct {
+	cfg            *config.CSRFConfig
+	sessions       *sessions.SessionManager
+	allowedOrigins atomic.Pointer[map[string]bool]
+}
+
+func NewCSRF(cfg *config.CSRFConfig, allowedOrigins []string, sessions *sessions.SessionManager) *CSRF {
+	switch cfg.Mode {
+	case "synchronizer":
+		if sessions == nil {
+			zap.L().Fatal("Synchronizer CSRF mode requires a SessionManager")
+		}
+	case "double-submit":
+		if cfg.Secret == "" {
+			zap.L().Fatal("Double submit CSRF mode requires a secret")
+		}
+	default:
+		zap.L().Fatal("Invalid parameters for CSRF", zap.String("mode", cfg.Mode))
+	}
+
+	c := &CSRF{cfg: cfg, sessions: sessions}
+	c.SetAllowedOrigins(allowedOrigins)
+
+	return c
+}
+
+// Replaces the trusted origins, e.g. when the config is reloaded. Safe to call while serving.
+func (c *CSRF) SetAllowedOrigins(allowedOrigins []string) {
+	origins := make(map[string]bool)
+
+	// A CORS wildcard does not make every origin trusted, only the listed ones are
+	for _, origin := range allowedOrigins {
+		if origin = strings.TrimSpace(origin); origin != "" && origin != "*" {
+			origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+
+	c.allowedOrigins.Store(&origins)
+}
+
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, authenticated := auth.FromContext(r.Context())
+		if isSafeMethod(r.Method) || (authenticated && principal.Method != auth.MethodSession) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !c.originAllowed(r) {
+			utils.WriteError(w, http.StatusForbidden, ErrCSRFOriginMismatch)
+			return
+		}
+
+		// Without a session there are no ambient credentials to forge a request with
+		if !authenticated {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		valid, err := c.verify(r, principal)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+			return
+		}
+		if !valid {
+			utils.WriteError(w, http.StatusForbidden, ErrCSRFTokenInvalid)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Responds with the CSRF token of the session for SPAs to send back, also setting it as a cookie in double submit mode.
+// Mount it behind SessionMiddleware.
+func (c *CSRF) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok || principal.Method != auth.MethodSession {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var token string
+	var err error
+
+	if c.cfg.Mode == "synchronizer" {
+		token, err = c.sessions.CSRFToken(r)
+	} else {
+		token, err = c.newDoubleSubmitToken(principal.SessionID)
+		if err == nil {
+			c.setCookie(w, token)
+		}
+	}
+
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrGenericInternalError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, &CSRFTokenResponse{CSRFToken: token})
+}
+
+func (c *CSRF) verify(r *http.Request, principal *auth.Principal) (bool, error) {
+	sent := r.Header.Get(c.cfg.HeaderName)
+	if sent == "" {
+		sent = r.PostFormValue(c.cfg.FormField)
+	}
+	if sent == "" {
+		return false, nil
+	}
+
+	if c.cfg.Mode == "synchronizer" {
+		expected, err := c.sessions.CSRFToken(r)
+		if errors.Is(err, sessions.ErrSessionNotFound) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		return subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1, nil
+	}
+
+	cookie, err := r.Cookie(c.cfg.CookieName)
+	if err != nil {
+		return false, nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(cookie.Value)) == 1 && c.validDoubleSubmitToken(sent, principal.SessionID), nil
+}
+
+// Double submit tokens are <random>.<signature>, signed together with the session ID,
+// so a cookie planted by a sibling subdomain or left over from another session is rejected
+func (c *CSRF) newDoubleSubmitToken(sessionID string) (string, error) {
+	random, err := auth.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	return random + "." + c.sign(sessionID, random), nil
+}
+
+func (c *CSRF) validDoubleSubmitToken(token, sessionID string) bool {
+	random, signature, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(c.sign(sessionID, random)))
+}
+
+func (c *CSRF) sign(sessionID, random string) string {
+	mac := hmac.New(sha256.New, []byte(c.cfg.Secret))
+	mac.Write([]byte(sessionID + "." + random))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Requests without Origin or Referer are allowed through to the token check, some clients and privacy settings strip both
+func (c *CSRF) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false // Includes the opaque "null" origin
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return (*c.allowedOrigins.Load())[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
+
+// Not HttpOnly, so scripts on the page can read it and echo it in the header
+func (c *CSRF) setCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.cfg.CookieName,
+		Value:    token,
+		Path:     c.cfg.CookiePath,
+		Domain:   c.cfg.CookieDomain,
+		Secure:   c.cfg.CookieSecure,
+		SameSite: sameSite(c.cfg.CookieSameSite),
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func sameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/config"
+	"github.com/jose-lico/go-plate/sessions"
+)
+
+func newTestCSRF(mode string, allowedOrigins ...string) (*CSRF, *sessions.SessionManager) {
+	sessionCfg := &config.SessionConfig{}
+	if err := config.LoadFrom(func(key string) (string, bool) {
+		return "0123456789abcdef0123456789abcdef", key == "SESSION_SECRETS"
+	}, "SESSION_", sessionCfg); err != nil {
+		panic(err)
+	}
+	manager := sessions.NewSessionManager(sessions.NewInMemoryStore(time.Minute), sessionCfg)
+
+	cfg := config.NewCSRFConfig()
+	cfg.Mode = mode
+	cfg.Secret = "csrf-secret"
+
+	return NewCSRF(cfg, allowedOrigins, manager), manager
+}
+
+// Logs a user in, returning its session cookie and principal
+func newTestSession(t *testing.T, manager *sessions.SessionManager) (*http.Cookie, *auth.Principal) {
+	rr := httptest.NewRecorder()
+	session, err := manager.Create(rr, httptest.NewRequest(http.MethodPost, "/users/login", nil), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr.Result().Cookies()[0], &auth.Principal{UserID: 1, Method: auth.MethodSession, SessionID: session.ID}
+}
+
+func serveCSRF(csrf *CSRF, r *http.Request, principal *auth.Principal) *httptest.ResponseRecorder {
+	if principal != nil {
+		r = r.WithContext(auth.WithPrincipal(r.Context(), principal))
+	}
+
+	rr := httptest.NewRecorder()
+	csrf.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rr, r)
+	return rr
+}
+
+// Requests go to http://example.com, httptest's default host
+func TestCSRF_Origin(t *testing.T) {
+	csrf, _ := newTestCSRF("synchronizer", "https://App.example.org/", "*")
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{name: "No Origin or Referer", method: http.MethodPost, status: http.StatusOK},
+		{name: "Same origin", method: http.MethodPost, headers: map[string]string{"Origin": "http://example.com"}, status: http.StatusOK},
+		{name: "Allowed origin", method: http.MethodPost, headers: map[string]string{"Origin": "https://app.example.org"}, status: http.StatusOK},
+		{name: "Other origin", method: http.MethodPost, headers: map[string]string{"Origin": "https://evil.example.net"}, status: http.StatusForbidden},
+		{name: "Allowed host over another scheme", method: http.MethodPost, headers: map[string]string{"Origin": "http://app.example.org"}, status: http.StatusForbidden},
+		{name: "Opaque null origin", method: http.MethodPost, headers: map[string]string{"Origin": "null"}, status: http.StatusForbidden},
+		{name: "Same origin Referer", method: http.MethodPost, headers: map[string]string{"Referer": "http://example.com/posts"}, status: http.StatusOK},
+		{name: "Other Referer", method: http.MethodPost, headers: map[string]string{"Referer": "https://evil.example.net/form"}, status: http.StatusForbidden},
+		{name: "Relative Referer", method: http.MethodPost, headers: map[string]string{"Referer": "/posts"}, status: http.StatusForbidden},
+		{name: "Origin is checked before Referer", method: http.MethodPost, headers: map[string]string{"Origin": "https://evil.example.net", "Referer": "http://example.com/posts"}, status: http.StatusForbidden},
+		{name: "Safe method", method: http.MethodGet, headers: map[string]string{"Origin": "https://evil.example.net"}, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/posts", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			if rr := serveCSRF(csrf, r, nil); rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+
+	// Origins can be replaced while serving, e.g. on config reload
+	csrf.SetAllowedOrigins([]string{"https://evil.example.net"})
+
+	r := httptest.NewRequest(http.MethodPost, "/posts", nil)
+	r.Header.Set("Origin", "https://evil.example.net")
+	if rr := serveCSRF(csrf, r, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected the new origin to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestCSRF_Synchronizer(t *testing.T) {
+	csrf, manager := newTestCSRF("synchronizer")
+	cookie, principal := newTestSession(t, manager)
+
+	r := httptest.NewRequest(http.MethodGet, "/csrf", nil)
+	r.AddCookie(cookie)
+	token, err := manager.CSRFToken(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		form   string
+		origin string
+		status int
+	}{
+		{name: "Missing token", status: http.StatusForbidden},
+		{name: "Wrong token", header: strings.Repeat("0", len(token)), status: http.StatusForbidden},
+		{name: "Header", header: token, status: http.StatusOK},
+		{name: "Form field", form: token, status: http.StatusOK},
+		{name: "Valid token from another origin", header: token, origin: "https://evil.example.net", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(url.Values{"csrf_token": {tt.form}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(cookie)
+			if tt.header != "" {
+				r.Header.Set("X-CSRF-Token", tt.header)
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			if rr := serveCSRF(csrf, r, principal); rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestCSRF_DoubleSubmit(t *testing.T) {
+	csrf, manager := newTestCSRF("double-submit")
+	sessionCookie, principal := newTestSession(t, manager)
+
+	issue := func(principal *auth.Principal) (string, *http.Cookie) {
+		r := httptest.NewRequest(http.MethodGet, "/csrf", nil)
+		rr := httptest.NewRecorder()
+		csrf.TokenHandler(rr, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response CSRFTokenResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response.CSRFToken, rr.Result().Cookies()[0]
+	}
+
+	token, cookie := issue(principal)
+	if cookie.Value != token || cookie.HttpOnly {
+		t.Fatalf("expected the token in a cookie readable by scripts, got %+v", cookie)
+	}
+
+	other, otherCookie := issue(&auth.Principal{UserID: 1, Method: auth.MethodSession, SessionID: "other-session"})
+
+	tests := []struct {
+		name   string
+		header string
+		cookie *http.Cookie
+		status int
+	}{
+		{name: "Header and cookie", header: token, cookie: cookie, status: http.StatusOK},
+		{name: "Missing cookie", header: token, status: http.StatusForbidden},
+		{name: "Missing header", cookie: cookie, status: http.StatusForbidden},
+		{name: "Mismatch", header: token, cookie: &http.Cookie{Name: cookie.Name, Value: other}, status: http.StatusForbidden},
+		// A cookie planted by a sibling subdomain, or left from another session, is signed for another session
+		{name: "Token of another session", header: other, cookie: otherCookie, status: http.StatusForbidden},
+		{name: "Unsigned token", header: "random", cookie: &http.Cookie{Name: cookie.Name, Value: "random"}, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/posts", nil)
+			r.AddCookie(sessionCookie)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			if tt.header != "" {
+				r.Header.Set("X-CSRF-Token", tt.header)
+			}
+
+			if rr := serveCSRF(csrf, r, principal); rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+// Browsers never attach bearer tokens or API keys on their own, so those requests need neither a token nor a trusted origin
+func TestCSRF_ExemptMethods(t *testing.T) {
+	for _, mode := range []string{"synchronizer", "double-submit"} {
+		csrf, _ := newTestCSRF(mode)
+
+		for _, method := range []auth.AuthMethod{auth.MethodBearer, auth.MethodAPIKey} {
+			r := httptest.NewRequest(http.MethodDelete, "/posts/1", nil)
+			r.Header.Set("Origin", "https://evil.example.net")
+
+			if rr := serveCSRF(csrf, r, &auth.Principal{UserID: 1, Method: method}); rr.Code != http.StatusOK {
+				t.Errorf("%s, %s: expected status code %d, got %d", mode, method, http.StatusOK, rr.Code)
+			}
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/csrf", nil)
+		rr := httptest.NewRecorder()
+		csrf.TokenHandler(rr, r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{UserID: 1, Method: auth.MethodBearer})))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected tokens only for sessions, got %d", mode, rr.Code)
+		}
+	}
+}
+
+// A login waiting for its second factor is only accepted by MFAPendingSessionMiddleware, which makes the CSRF middleware check its token
+func TestCSRF_MFAPendingSession(t *testing.T) {
+	csrf, manager := newTestCSRF("synchronizer")
+
+	rr := httptest.NewRecorder()
+	if _, err := manager.CreateMFAPending(rr, httptest.NewRequest(http.MethodPost, "/users/login", nil), 1); err != nil {
+		t.Fatal(err)
+	}
+	cookie := rr.Result().Cookies()[0]
+
+	r := httptest.NewRequest(http.MethodGet, "/users/csrf-token", nil)
+	r.AddCookie(cookie)
+	token, err := manager.CSRFToken(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		token      string
+		status     int
+	}{
+		{name: "Full session required", middleware: SessionMiddlewareBlocking(manager), token: token, status: http.StatusUnauthorized},
+		{name: "Missing token", middleware: MFAPendingSessionMiddleware(manager), status: http.StatusForbidden},
+		{name: "Valid token", middleware: MFAPendingSessionMiddleware(manager), token: token, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/users/mfa/challenge", nil)
+			r.AddCookie(cookie)
+			if tt.token != "" {
+				r.Header.Set("X-CSRF-Token", tt.token)
+			}
+
+			rr := httptest.NewRecorder()
+			tt.middleware(csrf.Middleware(ok)).ServeHTTP(rr, r)
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
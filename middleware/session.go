@@ -2,70 +2,41 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/jose-lico/go-plate/database"
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/sessions"
 	"github.com/jose-lico/go-plate/utils"
-
-	go_redis "github.com/redis/go-redis/v9"
 )
 
 type contextKey string
 
+const Token contextKey = "token"
+
+// Deprecated: use auth.FromContext. Still set by every auth middleware until the next release.
 const IsAuthenticated contextKey = "isAuthenticated"
+
+// Deprecated: use auth.FromContext. Still set by every auth middleware until the next release,
+// to the session or, for API keys and access tokens, a Session built from the auth.Principal.
 const SessionInfo contextKey = "sessionInfo"
-const Token contextKey = "token"
 
-type Session struct {
-	UserID       int       `json:"user_id"`
-	Expiration   time.Time `json:"expiration"`
-	CreatedAt    time.Time `json:"created_at"`
-	LastAccessed time.Time `json:"last_accessed"`
-	IPAddress    string    `json:"ip_address,omitempty"`
-	UserAgent    string    `json:"user_agent,omitempty"`
-}
+// Deprecated: use sessions.Session.
+type Session = sessions.Session
 
-func SessionMiddleware(redis database.RedisStore) func(next http.Handler) http.Handler {
+func SessionMiddleware(manager *sessions.SessionManager) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), IsAuthenticated, false)
-
-			cookie, err := r.Cookie("session")
-			if err == nil {
-				sessionToken := cookie.Value
-
-				sessionJSON, err := redis.Get(r.Context(), "session:"+sessionToken)
-				if err == nil {
-					var session Session
-					err := json.Unmarshal([]byte(sessionJSON), &session)
-
-					if err != nil {
-						utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to unmarshal session"))
-						return
-					}
-
-					ctx = context.WithValue(ctx, Token, "session:"+sessionToken)
-					ctx = context.WithValue(ctx, IsAuthenticated, true)
-					ctx = context.WithValue(ctx, SessionInfo, session)
-				} else if err == go_redis.Nil {
-					http.SetCookie(w, &http.Cookie{
-						Name:     "session",
-						Value:    "",
-						Path:     "/",
-						Expires:  time.Unix(0, 0),
-						MaxAge:   -1,
-						HttpOnly: true,
-						Secure:   true,
-						SameSite: http.SameSiteStrictMode,
-						Domain:   "",
-					})
-				} else {
-					utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to read session from cache"))
-					return
-				}
+			ctx, ok, err := loadSession(r.Context(), manager, w, r, false)
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			if !ok {
+				ctx = withDeprecatedKeys(ctx, nil)
 			}
 
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -73,49 +44,90 @@ func SessionMiddleware(redis database.RedisStore) func(next http.Handler) http.H
 	}
 }
 
-func SessionMiddlewareBlocking(redis database.RedisStore) func(next http.Handler) http.Handler {
+func SessionMiddlewareBlocking(manager *sessions.SessionManager) func(next http.Handler) http.Handler {
+	return sessionMiddlewareBlocking(manager, false)
+}
+
+// Like SessionMiddlewareBlocking, also accepting sessions still waiting for their second factor, so the CSRF middleware
+// checks requests made with them. Only mount it on the routes completing the second factor.
+func MFAPendingSessionMiddleware(manager *sessions.SessionManager) func(next http.Handler) http.Handler {
+	return sessionMiddlewareBlocking(manager, true)
+}
+
+func sessionMiddlewareBlocking(manager *sessions.SessionManager, allowMFAPending bool) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-
-			cookie, err := r.Cookie("session")
-			if err == nil {
-				sessionToken := cookie.Value
-
-				sessionJSON, err := redis.Get(r.Context(), "session:"+sessionToken)
-				if err == nil {
-					var session Session
-					err := json.Unmarshal([]byte(sessionJSON), &session)
-
-					if err != nil {
-						utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to unmarshal session"))
-						return
-					}
-
-					ctx = context.WithValue(ctx, Token, "session:"+sessionToken)
-					ctx = context.WithValue(ctx, IsAuthenticated, true)
-					ctx = context.WithValue(ctx, SessionInfo, session)
-					next.ServeHTTP(w, r.WithContext(ctx))
-					return
-				} else if err == go_redis.Nil {
-					http.SetCookie(w, &http.Cookie{
-						Name:     "session",
-						Value:    "",
-						Path:     "/",
-						Expires:  time.Unix(0, 0),
-						MaxAge:   -1,
-						HttpOnly: true,
-						Secure:   true,
-						SameSite: http.SameSiteStrictMode,
-						Domain:   "",
-					})
-				} else {
-					utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to read session from cache"))
-					return
-				}
+			ctx, ok, err := loadSession(r.Context(), manager, w, r, allowMFAPending)
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err)
+				return
 			}
 
-			w.WriteHeader(http.StatusUnauthorized)
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// Populates ctx with the session identified by the request cookie, clearing the cookie if the session no longer exists.
+func loadSession(ctx context.Context, manager *sessions.SessionManager, w http.ResponseWriter, r *http.Request, allowMFAPending bool) (context.Context, bool, error) {
+	token, ok := manager.Token(r)
+	if !ok {
+		return ctx, false, nil
+	}
+
+	session, err := manager.Get(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, sessions.ErrSessionNotFound) {
+			manager.ClearCookie(w)
+			return ctx, false, nil
+		}
+		return ctx, false, fmt.Errorf("failed to read session from cache")
+	}
+
+	// Only the second factor challenge may use an MFA pending session
+	if session.MFAPending && !allowMFAPending {
+		return ctx, false, nil
+	}
+
+	ctx = context.WithValue(ctx, Token, token)
+	ctx = auth.WithPrincipal(ctx, &auth.Principal{
+		UserID:    session.UserID,
+		Method:    auth.MethodSession,
+		SessionID: session.ID,
+		ExpiresAt: session.Expiration,
+	})
+	ctx = withDeprecatedKeys(ctx, session)
+
+	return ctx, true, nil
+}
+
+// Sets IsAuthenticated and SessionInfo for handlers not yet reading the auth.Principal. A nil session leaves
+// IsAuthenticated alone if an earlier auth middleware already set it.
+func withDeprecatedKeys(ctx context.Context, session *Session) context.Context {
+	if session == nil {
+		if _, exists := ctx.Value(IsAuthenticated).(bool); !exists {
+			ctx = context.WithValue(ctx, IsAuthenticated, false)
+		}
+		return ctx
+	}
+
+	ctx = context.WithValue(ctx, IsAuthenticated, true)
+	return context.WithValue(ctx, SessionInfo, *session)
+}
+
+// The Session SessionInfo held for credentials other than sessions
+func principalSession(principal *auth.Principal, createdAt time.Time, r *http.Request) *Session {
+	return &Session{
+		ID:           principal.SessionID,
+		UserID:       principal.UserID,
+		Expiration:   principal.ExpiresAt,
+		CreatedAt:    createdAt,
+		LastAccessed: time.Now(),
+		UserAgent:    r.Header.Get("User-Agent"),
+	}
+}
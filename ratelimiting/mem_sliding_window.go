@@ -110,6 +110,19 @@ func (swc *InMemorySlidingWindowCounter) Allow(key string) (bool, time.Duration,
 	return true, 0, nil
 }
 
+// The counter has no burst capacity, rate is the number of requests allowed per window and capacity is ignored
+func (swc *InMemorySlidingWindowCounter) SetLimits(rate, capacity float64) error {
+	if rate < 1 {
+		return ErrInvalidLimits
+	}
+
+	swc.mu.Lock()
+	defer swc.mu.Unlock()
+
+	swc.rate = int(rate)
+	return nil
+}
+
 func (swc *InMemorySlidingWindowCounter) getSubWindowIndex(t time.Time) int {
 	return int(t.UnixNano()/swc.subWindowSize.Nanoseconds()) % swc.numSubWindows
 }
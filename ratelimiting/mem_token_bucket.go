@@ -59,6 +59,18 @@ func (tb *InMemoryTokenBucket) Allow(key string) (bool, time.Duration, error) {
 	return false, retryAfter, nil
 }
 
+func (tb *InMemoryTokenBucket) SetLimits(rate, capacity float64) error {
+	if rate <= 0 || capacity <= 0 {
+		return ErrInvalidLimits
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.rate, tb.capacity = rate, capacity
+	return nil
+}
+
 func (tb *InMemoryTokenBucket) cleanup() {
 	for range time.Tick(tb.cleanupEvery) {
 		tb.mu.Lock()
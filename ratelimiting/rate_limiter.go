@@ -1,9 +1,19 @@
 package ratelimiting
 
 import (
+	"errors"
 	"time"
 )
 
 type RateLimiter interface {
 	Allow(string) (bool, time.Duration, error)
 }
+
+// Implemented by limiters whose limits can change while running, e.g. when the config is reloaded.
+// Keys keep the state they have, only their refill and cap change.
+type Adjustable interface {
+	RateLimiter
+	SetLimits(rate, capacity float64) error
+}
+
+var ErrInvalidLimits = errors.New("invalid rate limits")
@@ -0,0 +1,96 @@
+package ratelimiting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/database/redistest"
+)
+
+// Number of requests allowed out of attempts made in a row
+func allowed(t *testing.T, limiter RateLimiter, key string, attempts int) int {
+	t.Helper()
+
+	count := 0
+	for i := 0; i < attempts; i++ {
+		ok, _, err := limiter.Allow(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+type testLimiter struct {
+	Adjustable
+	// Limits allowing n requests in a row, refilling too slowly for it to matter
+	limits func(n int) (rate, capacity float64)
+}
+
+func tokenBucketLimits(n int) (float64, float64) {
+	return 0.001, float64(n)
+}
+
+// Every limiter starts allowing 2 requests in a row
+func newTestLimiters(t *testing.T) map[string]testLimiter {
+	redis, _ := redistest.New(t)
+
+	return map[string]testLimiter{
+		"InMemoryTokenBucket": {NewInMemoryTokenBucket(0.001, 2, time.Minute).(Adjustable), tokenBucketLimits},
+		"InMemorySlidingWindowCounter": {NewInMemorySlidingWindowCounter(2, time.Hour, time.Minute, time.Minute).(Adjustable), func(n int) (float64, float64) {
+			return float64(n), 0
+		}},
+		"RedisTokenBucket": {NewRedisTokenBucket("test", redis, 0.001, 2, time.Minute).(Adjustable), tokenBucketLimits},
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	for name, limiter := range newTestLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			if count := allowed(t, limiter, "before", 5); count != 2 {
+				t.Fatalf("expected 2 requests allowed, got %d", count)
+			}
+
+			if err := limiter.SetLimits(limiter.limits(4)); err != nil {
+				t.Fatal(err)
+			}
+			if count := allowed(t, limiter, "raised", 6); count != 4 {
+				t.Errorf("expected 4 requests allowed after raising the limits, got %d", count)
+			}
+
+			if err := limiter.SetLimits(limiter.limits(1)); err != nil {
+				t.Fatal(err)
+			}
+			if count := allowed(t, limiter, "lowered", 3); count != 1 {
+				t.Errorf("expected 1 request allowed after lowering the limits, got %d", count)
+			}
+		})
+	}
+}
+
+func TestSetLimits_Invalid(t *testing.T) {
+	invalid := map[string][][2]float64{
+		"InMemoryTokenBucket":          {{0, 2}, {-1, 2}, {1, 0}, {1, -1}},
+		"InMemorySlidingWindowCounter": {{0, 2}, {0.5, 2}, {-1, 2}},
+		"RedisTokenBucket":             {{0, 2}, {-1, 2}, {1, 0}, {1, -1}},
+	}
+
+	for name, limiter := range newTestLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, limits := range invalid[name] {
+				if err := limiter.SetLimits(limits[0], limits[1]); !errors.Is(err, ErrInvalidLimits) {
+					t.Errorf("%v: expected %v, got %v", limits, ErrInvalidLimits, err)
+				}
+			}
+
+			// The previous limits are kept
+			if count := allowed(t, limiter, "key", 5); count != 2 {
+				t.Errorf("expected 2 requests allowed, got %d", count)
+			}
+		})
+	}
+}
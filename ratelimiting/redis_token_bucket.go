@@ -3,6 +3,7 @@ package ratelimiting
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/jose-lico/go-plate/database"
@@ -13,6 +14,7 @@ import (
 
 type RedisTokenBucket struct {
 	redis         database.RedisStore
+	mu            sync.RWMutex
 	rate          float64
 	capacity      float64
 	keyExpiration time.Duration
@@ -53,7 +55,10 @@ func (tb *RedisTokenBucket) checkBucket(key string) (bool, time.Duration, error)
 
 	now := float64(time.Now().UnixNano()) / 1e9
 	keys := []string{tb.getRedisKey(key)}
+
+	tb.mu.RLock()
 	args := []interface{}{tb.rate, tb.capacity, now, int(tb.keyExpiration.Seconds())}
+	tb.mu.RUnlock()
 
 	result, err := script.Run(tb.ctx, tb.redis.GetNativeInstance().(*redis.Client), keys, args...).Result()
 	if err != nil {
@@ -81,6 +86,19 @@ func (tb *RedisTokenBucket) checkBucket(key string) (bool, time.Duration, error)
 	return allowed == 1, time.Duration(retryAfterSeconds), nil
 }
 
+// Applies to every instance sharing the limiter ID only once they are all updated
+func (tb *RedisTokenBucket) SetLimits(rate, capacity float64) error {
+	if rate <= 0 || capacity <= 0 {
+		return ErrInvalidLimits
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.rate, tb.capacity = rate, capacity
+	return nil
+}
+
 func (tb *RedisTokenBucket) getRedisKey(key string) string {
 	return fmt.Sprintf("ratelimit:token_bucket:%s:%s", tb.limiterID, key)
 }
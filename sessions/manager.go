@@ -0,0 +1,378 @@
+package sessions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jose-lico/go-plate/auth"
+	"github.com/jose-lico/go-plate/config"
+
+	"go.uber.org/zap"
+)
+
+// SessionManager owns session tokens and cookies. Middlewares and handlers should go through it
+// instead of touching the SessionStore directly.
+type SessionManager struct {
+	store SessionStore
+	cfg   *config.SessionConfig
+}
+
+func NewSessionManager(store SessionStore, cfg *config.SessionConfig) *SessionManager {
+	if len(cfg.Secrets) == 0 {
+		zap.L().Fatal("SessionManager requires at least one secret")
+	}
+
+	return &SessionManager{store: store, cfg: cfg}
+}
+
+// Creates a new session for the user and sets the session cookie. Does not write the response status.
+// Any session presented by the client is replaced, so a token planted before login cannot be reused (session fixation).
+func (m *SessionManager) Create(w http.ResponseWriter, r *http.Request, userID int) (*Session, error) {
+	return m.create(w, r, userID, false)
+}
+
+// Creates a short-lived session, lasting MFATimeout, for a user that still has to verify a second factor.
+// The session middleware treats it as unauthenticated until CompleteMFA is called.
+func (m *SessionManager) CreateMFAPending(w http.ResponseWriter, r *http.Request, userID int) (*Session, error) {
+	return m.create(w, r, userID, true)
+}
+
+func (m *SessionManager) create(w http.ResponseWriter, r *http.Request, userID int, mfaPending bool) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	csrfToken, err := auth.GenerateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate csrf token: %w", err)
+	}
+
+	now := time.Now()
+
+	session := &Session{
+		ID:           id,
+		UserID:       userID,
+		CreatedAt:    now,
+		LastAccessed: now,
+		IPAddress:    clientIP(r),
+		UserAgent:    r.Header.Get("User-Agent"),
+		MFAPending:   mfaPending,
+		CSRFToken:    csrfToken,
+	}
+	session.Expiration = m.expiration(session, now)
+
+	var oldKey string
+	if oldToken, ok := m.Token(r); ok {
+		oldKey, _, err = m.find(r.Context(), oldToken)
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return nil, err
+		}
+	}
+
+	err = m.issue(w, r, oldKey, session)
+	if errors.Is(err, ErrSessionNotFound) {
+		// The old session ended meanwhile, there is nothing left to replace
+		err = m.issue(w, r, "", session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Issues a new token for the current session, migrating its data and invalidating the old token.
+// Handlers should call it after privilege changes such as a password change or role elevation.
+func (m *SessionManager) Rotate(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	oldToken, ok := m.Token(r)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	oldKey, session, err := m.load(r.Context(), oldToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.issue(w, r, oldKey, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Upgrades the MFA pending session of the request to a full session once the second factor has been verified.
+// A new token is issued and the session timeouts start over, as if the session had just been created.
+func (m *SessionManager) CompleteMFA(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	oldToken, ok := m.Token(r)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	oldKey, session, err := m.load(r.Context(), oldToken)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	session.MFAPending = false
+	session.CreatedAt = now
+	session.LastAccessed = now
+	session.Expiration = m.expiration(session, now)
+
+	if err := m.issue(w, r, oldKey, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Stores session under a fresh token, replacing oldKey if set, and sets the session cookie
+func (m *SessionManager) issue(w http.ResponseWriter, r *http.Request, oldKey string, session *Session) error {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	ttl := time.Until(session.Expiration)
+
+	if oldKey != "" {
+		err = m.store.Rotate(r.Context(), oldKey, m.key(token), session, ttl)
+	} else {
+		err = m.store.Create(r.Context(), m.key(token), session, ttl)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The cookie lives until the absolute deadline, idle expiry is enforced server side
+	m.SetCookie(w, token, m.deadline(session))
+
+	return nil
+}
+
+// Returns the session token sent by the client, if any.
+func (m *SessionManager) Token(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(m.cfg.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+
+	return cookie.Value, true
+}
+
+// Returns the session for token, extending its idle expiration if it has not been touched for TouchInterval.
+// Sessions past their idle or absolute timeout are destroyed and reported as ErrSessionNotFound.
+func (m *SessionManager) Get(ctx context.Context, token string) (*Session, error) {
+	_, session, err := m.load(ctx, token)
+	return session, err
+}
+
+func (m *SessionManager) load(ctx context.Context, token string) (string, *Session, error) {
+	key, session, err := m.find(ctx, token)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+
+	if !now.Before(session.Expiration) || !now.Before(m.deadline(session)) {
+		if err := m.store.Destroy(ctx, key); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrSessionNotFound
+	}
+
+	// MFA pending sessions are not extended by activity
+	if !session.MFAPending && now.Sub(session.LastAccessed) >= m.cfg.TouchInterval {
+		session.LastAccessed = now
+		session.Expiration = m.expiration(session, now)
+
+		if err := m.store.Touch(ctx, key, session, session.Expiration.Sub(now)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return key, session, nil
+}
+
+// Finds the store key of token by trying every configured secret, newest first.
+// Live sessions found under a previous secret are re-keyed with the active one, so secrets can be rotated without logging everyone out.
+func (m *SessionManager) find(ctx context.Context, token string) (string, *Session, error) {
+	for i, secret := range m.cfg.Secrets {
+		key := hashToken(secret, token)
+
+		session, err := m.store.Get(ctx, key)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue
+		} else if err != nil {
+			return "", nil, err
+		}
+
+		if ttl := time.Until(session.Expiration); i > 0 && ttl > 0 {
+			activeKey := m.key(token)
+			if err := m.store.Rotate(ctx, key, activeKey, session, ttl); err != nil {
+				return "", nil, err
+			}
+			key = activeKey
+		}
+
+		return key, session, nil
+	}
+
+	return "", nil, ErrSessionNotFound
+}
+
+// Returns the synchronizer CSRF token of the request's session. Sessions created before tokens existed get one on first use.
+func (m *SessionManager) CSRFToken(r *http.Request) (string, error) {
+	token, ok := m.Token(r)
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+
+	key, session, err := m.load(r.Context(), token)
+	if err != nil {
+		return "", err
+	}
+
+	if session.CSRFToken == "" {
+		if session.CSRFToken, err = auth.GenerateToken(); err != nil {
+			return "", fmt.Errorf("failed to generate csrf token: %w", err)
+		}
+
+		if err := m.store.Touch(r.Context(), key, session, time.Until(session.Expiration)); err != nil {
+			return "", err
+		}
+	}
+
+	return session.CSRFToken, nil
+}
+
+// Destroys the session identified by the request cookie, if any, and clears the cookie.
+func (m *SessionManager) Destroy(w http.ResponseWriter, r *http.Request) error {
+	m.ClearCookie(w)
+
+	token, ok := m.Token(r)
+	if !ok {
+		return nil
+	}
+
+	key, _, err := m.find(r.Context(), token)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.Destroy(r.Context(), key)
+}
+
+func (m *SessionManager) DestroyAllForUser(ctx context.Context, userID int) error {
+	return m.store.DestroyAllForUser(ctx, userID)
+}
+
+func (m *SessionManager) ListForUser(ctx context.Context, userID int) ([]*Session, error) {
+	return m.store.ListForUser(ctx, userID)
+}
+
+// Destroys one of the user's sessions by its public ID. Returns ErrSessionNotFound if the user has no such session.
+func (m *SessionManager) DestroyByID(ctx context.Context, userID int, id string) error {
+	return m.store.DestroyByID(ctx, userID, id)
+}
+
+func (m *SessionManager) SetCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Value:    token,
+		Path:     m.cfg.CookiePath,
+		Domain:   m.cfg.CookieDomain,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   m.cfg.CookieSecure,
+		SameSite: m.sameSite(),
+	})
+}
+
+func (m *SessionManager) ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Value:    "",
+		Path:     m.cfg.CookiePath,
+		Domain:   m.cfg.CookieDomain,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.cfg.CookieSecure,
+		SameSite: m.sameSite(),
+	})
+}
+
+// Idle expiration counted from now, capped by the absolute deadline
+func (m *SessionManager) expiration(session *Session, now time.Time) time.Time {
+	timeout := m.cfg.IdleTimeout
+	if session.MFAPending {
+		timeout = m.cfg.MFATimeout
+	}
+
+	expiration := now.Add(timeout)
+	if deadline := m.deadline(session); expiration.After(deadline) {
+		return deadline
+	}
+
+	return expiration
+}
+
+func (m *SessionManager) deadline(session *Session) time.Time {
+	return session.CreatedAt.Add(m.cfg.AbsoluteTimeout)
+}
+
+// Store key of token under the active secret
+func (m *SessionManager) key(token string) string {
+	return hashToken(m.cfg.Secrets[0], token)
+}
+
+// Tokens are never stored, only their keyed hash, so read access to the store does not allow hijacking sessions
+func hashToken(secret, token string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (m *SessionManager) sameSite() http.SameSite {
+	switch strings.ToLower(m.cfg.CookieSameSite) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,185 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type memSession struct {
+	session Session
+	expires time.Time
+}
+
+type InMemoryStore struct {
+	mu           sync.Mutex
+	sessions     map[string]*memSession
+	users        map[int]map[string]struct{}
+	cleanupEvery time.Duration
+}
+
+func NewInMemoryStore(cleanupInterval time.Duration) SessionStore {
+	if cleanupInterval <= 0 {
+		zap.L().Fatal("Invalid parameters for InMemoryStore")
+	}
+
+	s := &InMemoryStore{
+		sessions:     make(map[string]*memSession),
+		users:        make(map[int]map[string]struct{}),
+		cleanupEvery: cleanupInterval,
+	}
+
+	go s.cleanup()
+	return s
+}
+
+func (s *InMemoryStore) Create(ctx context.Context, key string, session *Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.create(key, session, ttl)
+
+	return nil
+}
+
+func (s *InMemoryStore) Rotate(ctx context.Context, oldKey, newKey string, session *Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ms, exists := s.sessions[oldKey]; !exists || time.Now().After(ms.expires) {
+		return ErrSessionNotFound
+	}
+
+	s.delete(oldKey)
+	s.create(newKey, session, ttl)
+
+	return nil
+}
+
+// Must be called with the lock held
+func (s *InMemoryStore) create(key string, session *Session, ttl time.Duration) {
+	s.sessions[key] = &memSession{session: *session, expires: time.Now().Add(ttl)}
+
+	if _, exists := s.users[session.UserID]; !exists {
+		s.users[session.UserID] = make(map[string]struct{})
+	}
+	s.users[session.UserID][key] = struct{}{}
+}
+
+func (s *InMemoryStore) Get(ctx context.Context, key string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, exists := s.sessions[key]
+	if !exists || time.Now().After(ms.expires) {
+		return nil, ErrSessionNotFound
+	}
+
+	session := ms.session
+	return &session, nil
+}
+
+func (s *InMemoryStore) Touch(ctx context.Context, key string, session *Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, exists := s.sessions[key]
+	if !exists {
+		return ErrSessionNotFound
+	}
+
+	ms.session = *session
+	ms.expires = time.Now().Add(ttl)
+
+	return nil
+}
+
+func (s *InMemoryStore) Destroy(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delete(key)
+
+	return nil
+}
+
+func (s *InMemoryStore) DestroyAllForUser(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.users[userID] {
+		delete(s.sessions, key)
+	}
+	delete(s.users, userID)
+
+	return nil
+}
+
+func (s *InMemoryStore) ListForUser(ctx context.Context, userID int) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sessions := make([]*Session, 0, len(s.users[userID]))
+
+	for key := range s.users[userID] {
+		ms := s.sessions[key]
+		if now.After(ms.expires) {
+			continue
+		}
+
+		session := ms.session
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, nil
+}
+
+func (s *InMemoryStore) DestroyByID(ctx context.Context, userID int, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for key := range s.users[userID] {
+		ms := s.sessions[key]
+		if ms.session.ID == id && !now.After(ms.expires) {
+			s.delete(key)
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+// Must be called with the lock held
+func (s *InMemoryStore) delete(key string) {
+	ms, exists := s.sessions[key]
+	if !exists {
+		return
+	}
+
+	delete(s.sessions, key)
+
+	if keys, exists := s.users[ms.session.UserID]; exists {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(s.users, ms.session.UserID)
+		}
+	}
+}
+
+func (s *InMemoryStore) cleanup() {
+	for range time.Tick(s.cleanupEvery) {
+		s.mu.Lock()
+		now := time.Now()
+		for key, ms := range s.sessions {
+			if now.After(ms.expires) {
+				s.delete(key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
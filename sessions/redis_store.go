@@ -0,0 +1,317 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jose-lico/go-plate/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Scripts declare every key they touch, which is enough for key-aware proxies. On Redis Cluster they also need all keys
+// in one slot, so use a prefix with a hash tag, e.g. "{session}:", as a user's index and sessions are read together.
+type RedisStore struct {
+	redis  database.RedisStore
+	prefix string
+}
+
+func NewRedisStore(redis database.RedisStore, prefix string) SessionStore {
+	return &RedisStore{redis: redis, prefix: prefix}
+}
+
+// Also drops expired sessions from the user's index, and keeps the index alive as long as its longest session
+func (s *RedisStore) Create(ctx context.Context, key string, session *Session, ttl time.Duration) error {
+	marshalled, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	// Sessions added to the index meanwhile are pruned on a later create
+	members, err := s.redis.SMembers(ctx, s.userKey(session.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to list user sessions: %w", err)
+	}
+
+	keys := append([]string{s.sessionKey(key), s.userKey(session.UserID)}, s.sessionKeys(members)...)
+	args := append([]any{marshalled, ttlMillis(ttl), key}, stringsToAny(members)...)
+	if err := createScript.Run(ctx, s.client(), keys, args...).Err(); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (*Session, error) {
+	sessionJSON, err := s.redis.Get(ctx, s.sessionKey(key))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(sessionJSON), &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// Only updates a session that still exists, so a session destroyed meanwhile is not brought back
+func (s *RedisStore) Touch(ctx context.Context, key string, session *Session, ttl time.Duration) error {
+	marshalled, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	keys := []string{s.sessionKey(key), s.userKey(session.UserID)}
+	touched, err := touchScript.Run(ctx, s.client(), keys, marshalled, ttlMillis(ttl)).Int()
+	if err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	if touched == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *RedisStore) Destroy(ctx context.Context, key string) error {
+	session, err := s.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if _, err := s.redis.Del(ctx, s.sessionKey(key)); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return s.redis.SRem(ctx, s.userKey(session.UserID), key)
+}
+
+// Atomic, so a session rotated or created meanwhile is either revoked too or created after.
+// The script only deletes when no session joined the index since it was read, otherwise it is read again.
+func (s *RedisStore) DestroyAllForUser(ctx context.Context, userID int) error {
+	userKey := s.userKey(userID)
+
+	for attempt := 0; attempt < maxDestroyAllAttempts; attempt++ {
+		members, err := s.redis.SMembers(ctx, userKey)
+		if err != nil {
+			return fmt.Errorf("failed to list user sessions: %w", err)
+		}
+
+		keys := append([]string{userKey}, s.sessionKeys(members)...)
+		destroyed, err := destroyAllScript.Run(ctx, s.client(), keys, stringsToAny(members)...).Int()
+		if err != nil {
+			return fmt.Errorf("failed to delete user sessions: %w", err)
+		}
+		if destroyed == 1 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to delete user sessions: sessions kept being created after %d attempts", maxDestroyAllAttempts)
+}
+
+func (s *RedisStore) ListForUser(ctx context.Context, userID int) ([]*Session, error) {
+	keys, err := s.redis.SMembers(ctx, s.userKey(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user sessions: %w", err)
+	}
+
+	sessions := make([]*Session, 0, len(keys))
+
+	for _, key := range keys {
+		session, err := s.Get(ctx, key)
+		if errors.Is(err, ErrSessionNotFound) {
+			// Session expired, drop it from the index
+			s.redis.SRem(ctx, s.userKey(userID), key)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (s *RedisStore) DestroyByID(ctx context.Context, userID int, id string) error {
+	keys, err := s.redis.SMembers(ctx, s.userKey(userID))
+	if err != nil {
+		return fmt.Errorf("failed to list user sessions: %w", err)
+	}
+
+	for _, key := range keys {
+		session, err := s.Get(ctx, key)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if session.ID == id {
+			return s.Destroy(ctx, key)
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+// Fails with ErrSessionNotFound, storing nothing, if oldKey no longer exists
+func (s *RedisStore) Rotate(ctx context.Context, oldKey, newKey string, session *Session, ttl time.Duration) error {
+	marshalled, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	// Read to find the index to remove it from, a key never changes user so only its existence is checked again
+	old, err := s.Get(ctx, oldKey)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{s.sessionKey(oldKey), s.sessionKey(newKey), s.userKey(session.UserID), s.userKey(old.UserID)}
+	rotated, err := rotateScript.Run(ctx, s.client(), keys, marshalled, ttlMillis(ttl), oldKey, newKey).Int()
+	if err != nil {
+		return fmt.Errorf("failed to rotate session: %w", err)
+	}
+	if rotated == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *RedisStore) client() *redis.Client {
+	return s.redis.GetNativeInstance().(*redis.Client)
+}
+
+func (s *RedisStore) sessionKey(key string) string {
+	return s.prefix + key
+}
+
+func (s *RedisStore) sessionKeys(keys []string) []string {
+	sessionKeys := make([]string, len(keys))
+	for i, key := range keys {
+		sessionKeys[i] = s.sessionKey(key)
+	}
+	return sessionKeys
+}
+
+func (s *RedisStore) userKey(userID int) string {
+	return s.prefix + "user:" + strconv.Itoa(userID)
+}
+
+func stringsToAny(values []string) []any {
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+// PX rejects 0, sessions about to expire are kept for a millisecond
+func ttlMillis(ttl time.Duration) int64 {
+	return max(ttl.Milliseconds(), 1)
+}
+
+const maxDestroyAllAttempts = 5
+
+var (
+	createScript     = redis.NewScript(luaCreateSession)
+	touchScript      = redis.NewScript(luaTouchSession)
+	rotateScript     = redis.NewScript(luaRotateSession)
+	destroyAllScript = redis.NewScript(luaDestroyAllSessions)
+)
+
+var luaCreateSession = `
+local session_key = KEYS[1]
+local user_key = KEYS[2]
+local ttl = tonumber(ARGV[2])
+
+redis.call("SET", session_key, ARGV[1], "PX", ttl)
+
+-- KEYS[3..] are the sessions of the index, named by ARGV[4..]
+for i = 3, #KEYS do
+    if redis.call("EXISTS", KEYS[i]) == 0 then
+        redis.call("SREM", user_key, ARGV[i + 1])
+    end
+end
+
+redis.call("SADD", user_key, ARGV[3])
+
+if redis.call("PTTL", user_key) < ttl then
+    redis.call("PEXPIRE", user_key, ttl)
+end
+
+return 1
+`
+
+var luaTouchSession = `
+local user_key = KEYS[2]
+local ttl = tonumber(ARGV[2])
+
+if not redis.call("SET", KEYS[1], ARGV[1], "PX", ttl, "XX") then
+    return 0
+end
+
+if redis.call("PTTL", user_key) < ttl then
+    redis.call("PEXPIRE", user_key, ttl)
+end
+
+return 1
+`
+
+var luaRotateSession = `
+local user_key = KEYS[3]
+local ttl = tonumber(ARGV[2])
+
+if redis.call("EXISTS", KEYS[1]) == 0 then
+    return 0
+end
+
+redis.call("DEL", KEYS[1])
+redis.call("SREM", KEYS[4], ARGV[3])
+
+redis.call("SET", KEYS[2], ARGV[1], "PX", ttl)
+redis.call("SADD", user_key, ARGV[4])
+
+if redis.call("PTTL", user_key) < ttl then
+    redis.call("PEXPIRE", user_key, ttl)
+end
+
+return 1
+`
+
+var luaDestroyAllSessions = `
+local read = {}
+for _, member in ipairs(ARGV) do
+    read[member] = true
+end
+
+-- A session added since the index was read has no key in KEYS
+for _, member in ipairs(redis.call("SMEMBERS", KEYS[1])) do
+    if not read[member] then
+        return 0
+    end
+end
+
+for i = 2, #KEYS do
+    redis.call("DEL", KEYS[i])
+end
+
+redis.call("DEL", KEYS[1])
+
+return 1
+`
@@ -0,0 +1,39 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+type Session struct {
+	ID           string    `json:"id"` // Public identifier, safe to expose unlike the session token
+	UserID       int       `json:"user_id"`
+	Expiration   time.Time `json:"expiration"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastAccessed time.Time `json:"last_accessed"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	MFAPending   bool      `json:"mfa_pending,omitempty"` // Password verified, second factor still required
+	CSRFToken    string    `json:"csrf_token,omitempty"`  // Synchronizer token, see SessionManager.CSRFToken
+}
+
+// Sessions are stored under a key derived by the SessionManager from the session token.
+// Get returns ErrSessionNotFound for unknown or expired keys.
+// Touch only updates a session that still exists, returning ErrSessionNotFound otherwise, so it never revives a destroyed session.
+// Rotate atomically stores session under newKey and deletes oldKey. If oldKey no longer exists it stores nothing and returns ErrSessionNotFound,
+// so rotating a session that was revoked meanwhile does not bring it back.
+type SessionStore interface {
+	Create(ctx context.Context, key string, session *Session, ttl time.Duration) error
+	Get(ctx context.Context, key string) (*Session, error)
+	Touch(ctx context.Context, key string, session *Session, ttl time.Duration) error
+	Destroy(ctx context.Context, key string) error
+	DestroyAllForUser(ctx context.Context, userID int) error
+	ListForUser(ctx context.Context, userID int) ([]*Session, error)
+	DestroyByID(ctx context.Context, userID int, id string) error
+	Rotate(ctx context.Context, oldKey, newKey string, session *Session, ttl time.Duration) error
+}
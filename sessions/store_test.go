@@ -0,0 +1,334 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jose-lico/go-plate/database/redistest"
+)
+
+// Every SessionStore must pass these, whatever its backend
+func forEachStore(t *testing.T, test func(t *testing.T, store SessionStore)) {
+	redis, _ := redistest.New(t)
+
+	stores := map[string]SessionStore{
+		"InMemoryStore": NewInMemoryStore(time.Minute),
+		"RedisStore":    NewRedisStore(redis, "session:"),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			test(t, store)
+		})
+	}
+}
+
+func newTestSession(id string, userID int) *Session {
+	now := time.Now().Truncate(time.Second)
+	return &Session{ID: id, UserID: userID, CreatedAt: now, LastAccessed: now, Expiration: now.Add(time.Hour)}
+}
+
+func TestSessionStore_CreateGet(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SessionStore) {
+		ctx := context.Background()
+
+		if err := store.Create(ctx, "key", newTestSession("id", 1), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := store.Get(ctx, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.ID != "id" || session.UserID != 1 {
+			t.Errorf("unexpected session %+v", session)
+		}
+
+		if _, err := store.Get(ctx, "unknown"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected %v, got %v", ErrSessionNotFound, err)
+		}
+	})
+}
+
+func TestSessionStore_Touch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SessionStore) {
+		ctx := context.Background()
+
+		session := newTestSession("id", 1)
+		if err := store.Create(ctx, "key", session, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		session.CSRFToken = "token"
+		if err := store.Touch(ctx, "key", session, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if touched, err := store.Get(ctx, "key"); err != nil || touched.CSRFToken != "token" {
+			t.Errorf("expected the session to be updated, got %+v, %v", touched, err)
+		}
+
+		if err := store.Touch(ctx, "unknown", session, time.Hour); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected %v, got %v", ErrSessionNotFound, err)
+		}
+		if _, err := store.Get(ctx, "unknown"); !errors.Is(err, ErrSessionNotFound) {
+			t.Error("expected Touch not to create a session")
+		}
+	})
+}
+
+// A request that loaded the session before it was revoked must not bring it back
+func TestSessionStore_TouchAfterRevocation(t *testing.T) {
+	revocations := map[string]func(ctx context.Context, store SessionStore) error{
+		"Destroy":           func(ctx context.Context, store SessionStore) error { return store.Destroy(ctx, "key") },
+		"DestroyAllForUser": func(ctx context.Context, store SessionStore) error { return store.DestroyAllForUser(ctx, 1) },
+		"DestroyByID":       func(ctx context.Context, store SessionStore) error { return store.DestroyByID(ctx, 1, "id") },
+	}
+
+	for name, revoke := range revocations {
+		t.Run(name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store SessionStore) {
+				ctx := context.Background()
+
+				session := newTestSession("id", 1)
+				if err := store.Create(ctx, "key", session, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := revoke(ctx, store); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := store.Touch(ctx, "key", session, time.Hour); !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("expected %v, got %v", ErrSessionNotFound, err)
+				}
+				if _, err := store.Get(ctx, "key"); !errors.Is(err, ErrSessionNotFound) {
+					t.Error("expected the revoked session to stay revoked")
+				}
+			})
+		})
+	}
+}
+
+func TestSessionStore_ListAndDestroy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SessionStore) {
+		ctx := context.Background()
+
+		for key, session := range map[string]*Session{
+			"a": newTestSession("a", 1),
+			"b": newTestSession("b", 1),
+			"c": newTestSession("c", 2),
+		} {
+			if err := store.Create(ctx, key, session, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if sessions, err := store.ListForUser(ctx, 1); err != nil || len(sessions) != 2 {
+			t.Fatalf("expected 2 sessions, got %d, %v", len(sessions), err)
+		}
+
+		if err := store.DestroyByID(ctx, 2, "a"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected sessions of other users not to be found, got %v", err)
+		}
+
+		if err := store.DestroyByID(ctx, 1, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if sessions, _ := store.ListForUser(ctx, 1); len(sessions) != 1 || sessions[0].ID != "b" {
+			t.Errorf("expected only session b left, got %+v", sessions)
+		}
+
+		if err := store.DestroyAllForUser(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if sessions, _ := store.ListForUser(ctx, 1); len(sessions) != 0 {
+			t.Errorf("expected no sessions left, got %d", len(sessions))
+		}
+		if _, err := store.Get(ctx, "c"); err != nil {
+			t.Errorf("expected sessions of other users to be kept, got %v", err)
+		}
+
+		if err := store.Destroy(ctx, "unknown"); err != nil {
+			t.Errorf("expected destroying an unknown session to succeed, got %v", err)
+		}
+	})
+}
+
+func TestSessionStore_Rotate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SessionStore) {
+		ctx := context.Background()
+
+		if err := store.Create(ctx, "old", newTestSession("old", 1), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Rotate(ctx, "old", "new", newTestSession("new", 1), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Get(ctx, "old"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected the old key to be gone, got %v", err)
+		}
+		if session, err := store.Get(ctx, "new"); err != nil || session.ID != "new" {
+			t.Errorf("expected the session under the new key, got %+v, %v", session, err)
+		}
+		if sessions, _ := store.ListForUser(ctx, 1); len(sessions) != 1 || sessions[0].ID != "new" {
+			t.Errorf("expected only the new session listed, got %+v", sessions)
+		}
+
+		// Logging in as someone else replaces the previous user's session
+		if err := store.Rotate(ctx, "new", "other", newTestSession("other", 2), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if sessions, _ := store.ListForUser(ctx, 1); len(sessions) != 0 {
+			t.Errorf("expected no sessions left for the previous user, got %+v", sessions)
+		}
+		if sessions, _ := store.ListForUser(ctx, 2); len(sessions) != 1 {
+			t.Errorf("expected the session listed for the new user, got %+v", sessions)
+		}
+	})
+}
+
+func TestSessionStore_RotateRevoked(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SessionStore) {
+		ctx := context.Background()
+
+		if err := store.Rotate(ctx, "unknown", "new", newTestSession("new", 1), time.Hour); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected %v, got %v", ErrSessionNotFound, err)
+		}
+
+		if err := store.Create(ctx, "old", newTestSession("old", 1), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DestroyAllForUser(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Rotate(ctx, "old", "new", newTestSession("new", 1), time.Hour); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected %v, got %v", ErrSessionNotFound, err)
+		}
+		if _, err := store.Get(ctx, "new"); !errors.Is(err, ErrSessionNotFound) {
+			t.Error("expected rotating a revoked session not to bring it back")
+		}
+	})
+}
+
+// Whichever runs first, no session survives logging out everywhere
+func TestSessionStore_RotateRacingDestroyAll(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SessionStore) {
+		ctx := context.Background()
+
+		for i := 0; i < 50; i++ {
+			oldKey, newKey := fmt.Sprintf("old-%d", i), fmt.Sprintf("new-%d", i)
+			if err := store.Create(ctx, oldKey, newTestSession(oldKey, 1), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if err := store.Rotate(ctx, oldKey, newKey, newTestSession(newKey, 1), time.Hour); err != nil && !errors.Is(err, ErrSessionNotFound) {
+					t.Error(err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if err := store.DestroyAllForUser(ctx, 1); err != nil {
+					t.Error(err)
+				}
+			}()
+			wg.Wait()
+
+			if _, err := store.Get(ctx, newKey); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("expected the rotated session to be revoked, got %v", err)
+			}
+		}
+	})
+}
+
+func TestRedisStore_UserIndex(t *testing.T) {
+	redis, server := redistest.New(t)
+	store := NewRedisStore(redis, "session:")
+	ctx := context.Background()
+
+	if err := store.Create(ctx, "short", newTestSession("short", 1), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, "long", newTestSession("long", 1), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := server.TTL("session:user:1"); ttl != time.Hour {
+		t.Errorf("expected the index to live as long as its longest session, got %v", ttl)
+	}
+
+	server.FastForward(2 * time.Minute)
+
+	if err := store.Create(ctx, "new", newTestSession("new", 1), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := server.Members("session:user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Errorf("expected expired sessions to be pruned from the index, got %v", members)
+	}
+	if ttl := server.TTL("session:user:1"); ttl != time.Hour-2*time.Minute {
+		t.Errorf("expected a shorter session not to cut the index TTL, got %v", ttl)
+	}
+
+	server.FastForward(time.Hour)
+
+	if server.Exists("session:user:1") {
+		t.Error("expected the index to expire with its last session")
+	}
+}
+
+// Redis Cluster and key-aware proxies route scripts by their KEYS, so no script may touch another key
+func TestRedisStore_ScriptKeys(t *testing.T) {
+	redis, server := redistest.NewCheckingScriptKeys(t)
+	store := NewRedisStore(redis, "session:")
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.Create(ctx, key, newTestSession(key, 1), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pruning expired sessions from the index on create
+	server.FastForward(2 * time.Minute)
+	if err := store.Create(ctx, "d", newTestSession("d", 1), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Touch(ctx, "d", newTestSession("d", 1), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the old session from another user's index
+	if err := store.Rotate(ctx, "d", "e", newTestSession("e", 2), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, "f", newTestSession("f", 2), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DestroyAllForUser(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"e", "f"} {
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected %s to be destroyed, got %v", key, err)
+		}
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Errorf("expected no keys left, got %v", keys)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
@@ -40,6 +41,7 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+// Deprecated: use config.Load
 func GetEnvAsBool(env string) bool {
 	envValue := os.Getenv(env)
 
@@ -58,6 +60,7 @@ func GetEnvAsBool(env string) bool {
 	return value
 }
 
+// Deprecated: use config.Load
 func GetEnvAsInt(env string) int {
 	envValue := os.Getenv(env)
 
@@ -75,3 +78,22 @@ func GetEnvAsInt(env string) int {
 
 	return value
 }
+
+// Deprecated: use config.Load
+func GetEnvAsDuration(env string) time.Duration {
+	envValue := os.Getenv(env)
+
+	if envValue == "" {
+		return 0
+	}
+
+	value, err := time.ParseDuration(envValue)
+
+	if err != nil {
+		zap.L().Warn("Error parsing env variable to duration",
+			zap.String("env", env),
+			zap.String("value", envValue))
+	}
+
+	return value
+}